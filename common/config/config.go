@@ -144,11 +144,12 @@ var (
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
 
-var EnableMetric = env.Bool("ENABLE_METRIC", false)
-var MetricQueueSize = env.Int("METRIC_QUEUE_SIZE", 10)
-var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.8)
-var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
-var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
+// Circuit breaker of each channel and model, the former ENABLE_METRIC and METRIC_ variables still apply
+var CircuitBreakerEnabled = env.Bool("CIRCUIT_BREAKER_ENABLED", env.Bool("ENABLE_METRIC", false))
+var CircuitBreakerWindowSize = env.Int("CIRCUIT_BREAKER_WINDOW_SIZE", env.Int("METRIC_QUEUE_SIZE", 10)) // requests
+var CircuitBreakerSuccessRateThreshold = env.Float64("CIRCUIT_BREAKER_SUCCESS_RATE_THRESHOLD", env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.8))
+var CircuitBreakerCooldown = env.Int("CIRCUIT_BREAKER_COOLDOWN", 60)           // seconds before an open breaker lets a probe through
+var CircuitBreakerSyncFrequency = env.Int("CIRCUIT_BREAKER_SYNC_FREQUENCY", 5) // seconds, only with Redis
 
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
@@ -163,4 +164,47 @@ var UserContentRequestProxy = env.String("USER_CONTENT_REQUEST_PROXY", "")
 var UserContentRequestTimeout = env.Int("USER_CONTENT_REQUEST_TIMEOUT", 30)
 
 var EnforceIncludeUsage = env.Bool("ENFORCE_INCLUDE_USAGE", false)
+
+// TokenizerDataDir holds the tokenizer files of non-OpenAI model families, e.g. llama3.tiktoken
+var TokenizerDataDir = env.String("TOKENIZER_DATA_DIR", "./data/tokenizers")
+
 var TestPrompt = env.String("TEST_PROMPT", "Output only your specific model name with no additional text.")
+
+// MaxImageUploadSize limits the request body of image edits and variations, unit is byte
+var MaxImageUploadSize = int64(env.Int("MAX_IMAGE_UPLOAD_SIZE", 20<<20))
+
+// Files API
+var FileStorageType = env.String("FILE_STORAGE_TYPE", "local")
+var FileStoragePath = env.String("FILE_STORAGE_PATH", "./data/files")
+var MaxFileSize = int64(env.Int("MAX_FILE_SIZE", 512<<20))              // unit is byte
+var UserFileStorageLimit = int64(env.Int("USER_FILE_STORAGE_LIMIT", 0)) // unit is byte, 0 means unlimited
+var FileIsolationByToken = env.Bool("FILE_ISOLATION_BY_TOKEN", false)
+
+// Batch API
+var BatchConcurrency = env.Int("BATCH_CONCURRENCY", 4)      // requests of one batch running at the same time
+var BatchPollInterval = env.Int("BATCH_POLL_INTERVAL", 10)  // unit is second
+var BatchMaxRequests = env.Int("BATCH_MAX_REQUESTS", 50000) // lines allowed in one input file
+var BatchDiscountRatio = 1.0                                // multiplied into the ratio of batch requests
+
+// Response cache
+var ResponseCacheEnabled = false
+var ResponseCacheRatio = 0.1                                                  // multiplied into the ratio of cache hits
+var ResponseCacheTTL = env.Int("RESPONSE_CACHE_TTL", 3600)                    // unit is second
+var ResponseCacheMaxSize = env.Int("RESPONSE_CACHE_MAX_SIZE", 1<<20)          // unit is byte, larger responses are not cached
+var ResponseCacheMemoryLimit = env.Int("RESPONSE_CACHE_MEMORY_LIMIT", 64<<20) // unit is byte, the least recently used responses cached in memory are evicted beyond it
+
+// Idempotency-Key
+var IdempotencyKeyTTL = env.Int("IDEMPOTENCY_KEY_TTL", 24*60*60)        // unit is second
+var IdempotencyWaitTimeout = env.Int("IDEMPOTENCY_WAIT_TIMEOUT", 10*60) // unit is second, how long a duplicate waits for the request in flight
+var IdempotencyMaxSize = env.Int("IDEMPOTENCY_MAX_SIZE", 1<<20)         // unit is byte, larger responses release the key instead of being stored
+
+// Stream failover
+var StreamFailoverEnabled = false
+var StreamFailoverTimes = env.Int("STREAM_FAILOVER_TIMES", 2) // channels tried to continue an interrupted stream
+
+// Channel limits
+var ChannelQueueTimeout = env.Int("CHANNEL_QUEUE_TIMEOUT", 10) // unit is second, how long a request waits when every channel is at its limits
+
+// Responses API
+var ResponsesStoreDefault = env.Bool("RESPONSES_STORE_DEFAULT", true)  // used when a request does not set store
+var ResponsesMaxChainDepth = env.Int("RESPONSES_MAX_CHAIN_DEPTH", 100) // stored turns followed by previous_response_id
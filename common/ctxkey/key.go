@@ -21,4 +21,26 @@ const (
 	AvailableModels   = "available_models"
 	KeyRequestBody    = "key_request_body"
 	SystemPrompt      = "system_prompt"
+	// TokenKey is the key of the token, which looks the token up in the cache
+	TokenKey = "token_key"
+	// InboundRequestBody keeps the original body of requests converted by a protocol bridge
+	InboundRequestBody = "inbound_request_body"
+	// InboundRequestURL keeps the original URL of requests converted by a protocol bridge
+	InboundRequestURL = "inbound_request_url"
+	// BatchId marks requests executed on behalf of a batch
+	BatchId = "batch_id"
+	// ContextStrategy is the context truncation strategy of the token
+	ContextStrategy = "context_strategy"
+	// Usage is the usage of a completed relay, which counts against the TPM limits
+	Usage = "usage"
+	// ResponseCacheRecorder records the response of a request for the response cache
+	ResponseCacheRecorder = "response_cache_recorder"
+	// UpstreamContext is the context of the upstream request when it can be canceled, e.g. a hedged request
+	UpstreamContext = "upstream_context"
+	// ChannelLease counts the request against the limits of its channel until it is released
+	ChannelLease = "channel_lease"
+	// ChannelSelectedAt is when the channel was selected, which tells the probe of a half-open circuit breaker
+	ChannelSelectedAt = "channel_selected_at"
+	// TokenRateLimits are the RPM, TPM and RPD limits of the token
+	TokenRateLimits = "token_rate_limits"
 )
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"io"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// BlobStore keeps the content of uploaded and generated files, addressed by key
+type BlobStore interface {
+	Put(key string, content io.Reader) (int64, error)
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+var Default BlobStore
+
+func Init() {
+	switch config.FileStorageType {
+	case "local", "":
+		Default = NewLocalStore(config.FileStoragePath)
+	default:
+		logger.FatalLog("unknown file storage type: " + config.FileStorageType)
+	}
+}
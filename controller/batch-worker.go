@@ -0,0 +1,481 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	maxBatchValidationErrors = 100
+	batchProgressInterval    = 5 * time.Second
+)
+
+type batchInputLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type batchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchOutputLine struct {
+	Id       string            `json:"id"`
+	CustomId string            `json:"custom_id"`
+	Response *batchResponse    `json:"response"`
+	Error    *model.BatchError `json:"error"`
+}
+
+type batchContextKey struct{}
+
+var (
+	batchEngine     *gin.Engine
+	batchEngineOnce sync.Once
+)
+
+// getBatchEngine returns an internal router running batch requests through the
+// same middlewares and relay handler as the public /v1 endpoints
+func getBatchEngine() *gin.Engine {
+	batchEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(middleware.RequestId(), setBatchContext(), middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.Distribute())
+		for endpoint := range model.BatchEndpoints {
+			engine.POST(endpoint, Relay)
+		}
+		batchEngine = engine
+	})
+	return batchEngine
+}
+
+func setBatchContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if batchId, ok := c.Request.Context().Value(batchContextKey{}).(string); ok {
+			c.Set(ctxkey.BatchId, batchId)
+		}
+		c.Next()
+	}
+}
+
+// StartBatchWorker picks up created batches and runs them one by one,
+// requests inside a batch run with config.BatchConcurrency
+func StartBatchWorker() {
+	if count, err := model.FailInterruptedBatches(); err != nil {
+		logger.SysError("failed to fail interrupted batches: " + err.Error())
+	} else if count > 0 {
+		logger.SysLog(fmt.Sprintf("marked %d interrupted batches as failed", count))
+	}
+	for {
+		batches, err := model.GetPendingBatches(10)
+		if err != nil {
+			logger.SysError("failed to get pending batches: " + err.Error())
+		}
+		for _, batch := range batches {
+			runBatch(batch)
+		}
+		if len(batches) == 0 {
+			time.Sleep(time.Duration(config.BatchPollInterval) * time.Second)
+		}
+	}
+}
+
+func parseBatchLine(line []byte, endpoint string) (*batchInputLine, string) {
+	var input batchInputLine
+	if err := json.Unmarshal(line, &input); err != nil {
+		return nil, "invalid JSON: " + err.Error()
+	}
+	if input.CustomId == "" {
+		return nil, "custom_id is required"
+	}
+	if input.Method != http.MethodPost {
+		return nil, "method must be POST"
+	}
+	if input.Url != endpoint {
+		return nil, fmt.Sprintf("url %s does not match the batch endpoint %s", input.Url, endpoint)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(input.Body, &body); err != nil || body == nil {
+		return nil, "body must be a JSON object"
+	}
+	if stream, _ := body["stream"].(bool); stream {
+		return nil, "stream is not supported in batches"
+	}
+	return &input, ""
+}
+
+// readBatchLines calls fn with every non-blank line of the file and its line number
+func readBatchLines(file *model.File, fn func(lineNo int, line []byte) bool) error {
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	reader := bufio.NewReader(content)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if !fn(lineNo, trimmed) {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func validateBatchInput(file *model.File, endpoint string) (int, []model.BatchError, error) {
+	total := 0
+	customIds := make(map[string]bool)
+	var validationErrors []model.BatchError
+	err := readBatchLines(file, func(lineNo int, line []byte) bool {
+		total++
+		input, message := parseBatchLine(line, endpoint)
+		if message == "" && customIds[input.CustomId] {
+			message = fmt.Sprintf("duplicate custom_id: %s", input.CustomId)
+		}
+		if message != "" {
+			validationErrors = append(validationErrors, model.BatchError{
+				Code:    "invalid_request",
+				Message: message,
+				Line:    &lineNo,
+			})
+			return len(validationErrors) < maxBatchValidationErrors
+		}
+		customIds[input.CustomId] = true
+		return true
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if total == 0 && len(validationErrors) == 0 {
+		validationErrors = append(validationErrors, model.BatchError{Code: "empty_file", Message: "the input file has no requests"})
+	}
+	if total > config.BatchMaxRequests {
+		validationErrors = append(validationErrors, model.BatchError{
+			Code:    "too_many_requests",
+			Message: fmt.Sprintf("the input file has %d requests, the limit is %d", total, config.BatchMaxRequests),
+		})
+	}
+	return total, validationErrors, nil
+}
+
+func failBatch(ctx context.Context, batch *model.Batch, fromStatus string, batchErrors []model.BatchError) {
+	logger.Warnf(ctx, "batch %s failed: %s", batch.Id, batchErrors[0].Message)
+	now := helper.GetTimestamp()
+	_, err := model.ClaimBatch(batch, fromStatus, &model.Batch{
+		Status:   model.BatchStatusFailed,
+		FailedAt: &now,
+		Errors:   &model.BatchErrors{Object: "list", Data: batchErrors},
+	})
+	if err != nil {
+		logger.Errorf(ctx, "failed to update batch %s: %s", batch.Id, err.Error())
+	}
+}
+
+func runBatch(batch *model.Batch) {
+	ctx := helper.SetRequestID(context.Background(), batch.Id)
+	now := helper.GetTimestamp()
+	if now > batch.ExpiresAt {
+		_, err := model.ClaimBatch(batch, model.BatchStatusValidating, &model.Batch{Status: model.BatchStatusExpired, ExpiredAt: &now})
+		if err != nil {
+			logger.Errorf(ctx, "failed to expire batch %s: %s", batch.Id, err.Error())
+		}
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(ctx, batch, model.BatchStatusValidating, []model.BatchError{{Code: "token_not_found", Message: "the token creating this batch no longer exists"}})
+		return
+	}
+	// the batch owner already passed the token isolation check when creating it
+	inputFile, err := model.GetFileById(batch.InputFileId, batch.UserId, 0)
+	if err != nil {
+		failBatch(ctx, batch, model.BatchStatusValidating, []model.BatchError{{Code: "input_file_not_found", Message: "the input file no longer exists"}})
+		return
+	}
+	total, validationErrors, err := validateBatchInput(inputFile, batch.Endpoint)
+	if err != nil {
+		validationErrors = []model.BatchError{{Code: "read_input_file_failed", Message: err.Error()}}
+	}
+	if len(validationErrors) > 0 {
+		failBatch(ctx, batch, model.BatchStatusValidating, validationErrors)
+		return
+	}
+	now = helper.GetTimestamp()
+	claimed, err := model.ClaimBatch(batch, model.BatchStatusValidating, &model.Batch{
+		Status:        model.BatchStatusInProgress,
+		InProgressAt:  &now,
+		RequestCounts: model.BatchRequestCounts{Total: total},
+	})
+	if err != nil {
+		logger.Errorf(ctx, "failed to start batch %s: %s", batch.Id, err.Error())
+		return
+	}
+	if !claimed {
+		// cancelled before the worker got to it
+		return
+	}
+	batch.RequestCounts.Total = total
+	logger.Infof(ctx, "batch %s started with %d requests", batch.Id, total)
+	executeBatch(ctx, batch, token, inputFile)
+}
+
+// batchResultFile collects result lines in a temporary file before they are stored as a user file
+type batchResultFile struct {
+	sync.Mutex
+	file  *os.File
+	lines int
+}
+
+func newBatchResultFile() (*batchResultFile, error) {
+	file, err := os.CreateTemp("", "batch-result-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &batchResultFile{file: file}, nil
+}
+
+func (f *batchResultFile) write(line *batchOutputLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	if _, err = f.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	f.lines++
+	return nil
+}
+
+// save stores the results as a file of the batch owner, it returns nil if there are none
+func (f *batchResultFile) save(batch *model.Batch, filename string) (*string, error) {
+	if f.lines == 0 {
+		return nil, nil
+	}
+	size, err := f.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		UserId:   batch.UserId,
+		TokenId:  batch.TokenId,
+		Bytes:    size,
+		Filename: filename,
+		Purpose:  model.FilePurposeBatchOutput,
+	}
+	if err = model.CreateFile(file, f.file); err != nil {
+		return nil, err
+	}
+	return &file.Id, nil
+}
+
+func (f *batchResultFile) close() {
+	_ = f.file.Close()
+	_ = os.Remove(f.file.Name())
+}
+
+func executeBatchRequest(ctx context.Context, batch *model.Batch, token *model.Token, input *batchInputLine) *batchOutputLine {
+	output := &batchOutputLine{
+		Id:       "batch_req_" + random.GetRandomString(24),
+		CustomId: input.CustomId,
+	}
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, batchContextKey{}, batch.Id), http.MethodPost, input.Url, bytes.NewReader(input.Body))
+	if err != nil {
+		output.Error = &model.BatchError{Code: "create_request_failed", Message: err.Error()}
+		return output
+	}
+	req.RemoteAddr = net.JoinHostPort(batch.ClientIp, "0")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	getBatchEngine().ServeHTTP(recorder, req)
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	output.Response = &batchResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(helper.RequestIdKey),
+		Body:       body,
+	}
+	return output
+}
+
+func executeBatch(ctx context.Context, batch *model.Batch, token *model.Token, inputFile *model.File) {
+	outputFile, err := newBatchResultFile()
+	if err != nil {
+		failBatch(ctx, batch, model.BatchStatusInProgress, []model.BatchError{{Code: "create_output_failed", Message: err.Error()}})
+		return
+	}
+	defer outputFile.close()
+	errorFile, err := newBatchResultFile()
+	if err != nil {
+		failBatch(ctx, batch, model.BatchStatusInProgress, []model.BatchError{{Code: "create_output_failed", Message: err.Error()}})
+		return
+	}
+	defer errorFile.close()
+
+	var completed, failed atomic.Int64
+	requestCounts := func() model.BatchRequestCounts {
+		return model.BatchRequestCounts{
+			Total:     batch.RequestCounts.Total,
+			Completed: int(completed.Load()),
+			Failed:    int(failed.Load()),
+		}
+	}
+
+	// report progress and watch for cancellation and expiry while requests are running
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	monitorExited := make(chan struct{})
+	stopStatus := ""
+	go func() {
+		defer close(monitorExited)
+		ticker := time.NewTicker(batchProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if err := model.UpdateBatchRequestCounts(batch.Id, requestCounts()); err != nil {
+				logger.Errorf(ctx, "failed to update request counts of batch %s: %s", batch.Id, err.Error())
+			}
+			if status, err := model.GetBatchStatus(batch.Id); err == nil && status == model.BatchStatusCancelling {
+				stopStatus = model.BatchStatusCancelled
+			} else if helper.GetTimestamp() > batch.ExpiresAt {
+				stopStatus = model.BatchStatusExpired
+			}
+			if stopStatus != "" {
+				close(stop)
+				return
+			}
+		}
+	}()
+
+	concurrency := config.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	readErr := readBatchLines(inputFile, func(lineNo int, line []byte) bool {
+		select {
+		case <-stop:
+			return false
+		case semaphore <- struct{}{}:
+		}
+		input, _ := parseBatchLine(line, batch.Endpoint)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			output := executeBatchRequest(ctx, batch, token, input)
+			resultFile := outputFile
+			if output.Error != nil || output.Response.StatusCode != http.StatusOK {
+				resultFile = errorFile
+				failed.Add(1)
+			} else {
+				completed.Add(1)
+			}
+			if err := resultFile.write(output); err != nil {
+				logger.Errorf(ctx, "failed to write result of batch %s: %s", batch.Id, err.Error())
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+	close(done)
+	<-monitorExited
+	if readErr != nil {
+		logger.Errorf(ctx, "failed to read input of batch %s: %s", batch.Id, readErr.Error())
+	}
+	if err = model.UpdateBatchRequestCounts(batch.Id, requestCounts()); err != nil {
+		logger.Errorf(ctx, "failed to update request counts of batch %s: %s", batch.Id, err.Error())
+	}
+	finalizeBatch(ctx, batch, stopStatus, outputFile, errorFile)
+}
+
+func finalizeBatch(ctx context.Context, batch *model.Batch, stopStatus string, outputFile *batchResultFile, errorFile *batchResultFile) {
+	fromStatus := model.BatchStatusCancelling
+	if stopStatus != model.BatchStatusCancelled {
+		now := helper.GetTimestamp()
+		claimed, err := model.ClaimBatch(batch, model.BatchStatusInProgress, &model.Batch{
+			Status:       model.BatchStatusFinalizing,
+			FinalizingAt: &now,
+		})
+		if err != nil {
+			logger.Errorf(ctx, "failed to finalize batch %s: %s", batch.Id, err.Error())
+			return
+		}
+		if claimed {
+			fromStatus = model.BatchStatusFinalizing
+		} else {
+			// cancelled after the last progress check
+			stopStatus = model.BatchStatusCancelled
+		}
+	}
+	outputFileId, err := outputFile.save(batch, fmt.Sprintf("%s_output.jsonl", batch.Id))
+	if err != nil {
+		failBatch(ctx, batch, fromStatus, []model.BatchError{{Code: "save_output_failed", Message: err.Error()}})
+		return
+	}
+	errorFileId, err := errorFile.save(batch, fmt.Sprintf("%s_error.jsonl", batch.Id))
+	if err != nil {
+		failBatch(ctx, batch, fromStatus, []model.BatchError{{Code: "save_output_failed", Message: err.Error()}})
+		return
+	}
+	now := helper.GetTimestamp()
+	updates := &model.Batch{OutputFileId: outputFileId, ErrorFileId: errorFileId}
+	switch stopStatus {
+	case model.BatchStatusCancelled:
+		updates.Status = model.BatchStatusCancelled
+		updates.CancelledAt = &now
+	case model.BatchStatusExpired:
+		updates.Status = model.BatchStatusExpired
+		updates.ExpiredAt = &now
+	default:
+		updates.Status = model.BatchStatusCompleted
+		updates.CompletedAt = &now
+	}
+	if _, err = model.ClaimBatch(batch, fromStatus, updates); err != nil {
+		logger.Errorf(ctx, "failed to complete batch %s: %s", batch.Id, err.Error())
+		return
+	}
+	logger.Infof(ctx, "batch %s %s", batch.Id, batch.Status)
+}
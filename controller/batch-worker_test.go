@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestExecuteBatchRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, memoryCacheEnabled, redisEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled
+	batchDiscountRatio, approximateTokenEnabled := config.BatchDiscountRatio, config.ApproximateTokenEnabled
+	defer func() {
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled = sqlitePath, memoryCacheEnabled, redisEnabled
+		config.BatchDiscountRatio, config.ApproximateTokenEnabled = batchDiscountRatio, approximateTokenEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	config.MemoryCacheEnabled = false
+	common.RedisEnabled = false
+	config.BatchDiscountRatio = 0.5
+	// the encoders of tiktoken are downloaded
+	config.ApproximateTokenEnabled = true
+	model.InitDB()
+	model.InitLogDB()
+	client.Init()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"chatcmpl","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000,"completion_tokens":1000,"total_tokens":2000}}`)
+	}))
+	defer upstream.Close()
+	channel := &model.Channel{Id: 1, Type: channeltype.OpenAI, Key: "key", Name: "channel", Models: "gpt-4o", Group: "default",
+		BaseURL: &upstream.URL, Status: model.ChannelStatusEnabled}
+	if err := channel.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Id: 1, Username: "user", Password: "12345678", Group: "default", Status: model.UserStatusEnabled, AffCode: "user", AccessToken: "user", Quota: 100000000}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	subnet := "10.0.0.0/8"
+	token := &model.Token{Id: 1, UserId: 1, Key: "batchtoken", Name: "token", Status: model.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true, Subnet: &subnet}
+	if err := model.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	input := &batchInputLine{CustomId: "1", Method: http.MethodPost, Url: "/v1/chat/completions",
+		Body: []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)}
+
+	// requests are made from the address the batch was created from
+	output := executeBatchRequest(context.Background(), &model.Batch{Id: "batch_outside", UserId: 1, TokenId: 1, ClientIp: "192.168.0.1"}, token, input)
+	if output.Response == nil || output.Response.StatusCode != http.StatusForbidden {
+		t.Errorf("batch created outside the subnet of the token should be rejected, got %+v", output.Response)
+	}
+	output = executeBatchRequest(context.Background(), &model.Batch{Id: "batch_inside", UserId: 1, TokenId: 1, ClientIp: "10.1.2.3"}, token, input)
+	if output.Response == nil || output.Response.StatusCode != http.StatusOK {
+		t.Fatalf("batch created inside the subnet of the token should succeed, got %+v", output.Response)
+	}
+
+	// the request is billed in the background, with the batch discount
+	var log model.Log
+	for i := 0; i < 100 && model.LOG_DB.Where("batch_id = ?", "batch_inside").First(&log).Error != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	ratio := billingratio.GetModelRatio("gpt-4o", channeltype.OpenAI) * billingratio.GetGroupRatio("default") * config.BatchDiscountRatio
+	quota := int(math.Ceil((1000 + 1000*billingratio.GetCompletionRatio("gpt-4o", channeltype.OpenAI)) * ratio))
+	if log.Quota != quota || !strings.Contains(log.Content, "0.50 (batch)") {
+		t.Errorf("batch request should be billed with the discount, got %d for %q, want %d", log.Quota, log.Content, quota)
+	}
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+const batchCompletionWindow = "24h"
+
+type createBatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func getRequestBatch(c *gin.Context) (*model.Batch, bool) {
+	batch, err := model.GetBatchById(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithOpenAIError(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "get_batch_failed", err.Error())
+		}
+		return nil, false
+	}
+	return batch, true
+}
+
+func CreateBatch(c *gin.Context) {
+	var req createBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !model.BatchEndpoints[req.Endpoint] {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("unsupported endpoint: %s", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be 24h")
+		return
+	}
+	file, err := model.GetFileById(req.InputFileId, c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		return
+	}
+	if file.Purpose != model.FilePurposeBatch {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_input_file", "the input file must be uploaded with purpose batch")
+		return
+	}
+	batch := &model.Batch{
+		UserId:           c.GetInt(ctxkey.Id),
+		TokenId:          c.GetInt(ctxkey.TokenId),
+		ClientIp:         c.ClientIP(),
+		Endpoint:         req.Endpoint,
+		InputFileId:      file.Id,
+		CompletionWindow: req.CompletionWindow,
+		ExpiresAt:        helper.GetTimestamp() + int64((24 * time.Hour).Seconds()),
+		Metadata:         req.Metadata,
+	}
+	if err = model.CreateBatch(batch); err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "create_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// fetch one more to know whether there is a next page
+	batches, err := model.GetUserBatches(c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "list_batches_failed", err.Error())
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     batches,
+		"has_more": hasMore,
+	}
+	if len(batches) > 0 {
+		response["first_id"] = batches[0].Id
+		response["last_id"] = batches[len(batches)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch, ok := getRequestBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+func CancelBatch(c *gin.Context) {
+	batch, ok := getRequestBatch(c)
+	if !ok {
+		return
+	}
+	now := helper.GetTimestamp()
+	var claimed bool
+	var err error
+	switch batch.Status {
+	case model.BatchStatusValidating:
+		// not picked up by the worker yet, nothing to wait for
+		claimed, err = model.ClaimBatch(batch, model.BatchStatusValidating, &model.Batch{
+			Status:       model.BatchStatusCancelled,
+			CancellingAt: &now,
+			CancelledAt:  &now,
+		})
+	case model.BatchStatusInProgress:
+		claimed, err = model.ClaimBatch(batch, model.BatchStatusInProgress, &model.Batch{
+			Status:       model.BatchStatusCancelling,
+			CancellingAt: &now,
+		})
+	case model.BatchStatusCancelling, model.BatchStatusCancelled:
+		c.JSON(http.StatusOK, batch)
+		return
+	}
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "cancel_batch_failed", err.Error())
+		return
+	}
+	if !claimed {
+		abortWithOpenAIError(c, http.StatusConflict, "batch_not_cancellable",
+			fmt.Sprintf("cannot cancel a batch with status %s", batch.Status))
+		return
+	}
+	batch, ok = getRequestBatch(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
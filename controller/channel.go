@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor/breaker"
+	"github.com/songquanpeng/one-api/relay/routing"
 	"net/http"
 	"strconv"
 	"strings"
@@ -170,3 +173,93 @@ func UpdateChannel(c *gin.Context) {
 	})
 	return
 }
+
+func GetChannelAbilities(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	abilities, err := model.GetAbilitiesByChannelId(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    abilities,
+	})
+}
+
+// UpdateAbilityWeight overrides the weight of a channel for one group and model,
+// a null weight falls back to the weight of the channel
+func UpdateAbilityWeight(c *gin.Context) {
+	ability := model.Ability{}
+	err := c.ShouldBindJSON(&ability)
+	if err == nil && (ability.ChannelId == 0 || ability.Group == "" || ability.Model == "") {
+		err = errors.New("channel_id, group and model are required")
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.UpdateAbilityWeight(ability.ChannelId, ability.Group, ability.Model, ability.Weight)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetChannelRoutingStats returns the latency and error rate the adaptive routing keeps
+// for each channel and model
+func GetChannelRoutingStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    routing.GetStats(),
+	})
+}
+
+// GetChannelBreakers returns the circuit breakers of the channels for each model
+func GetChannelBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    breaker.List(),
+	})
+}
+
+// ResetChannelBreakers closes the circuit breakers of a channel, for the model in the query
+// or for every model
+func ResetChannelBreakers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	breaker.Reset(id, c.Query("model"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/api-reference/files
+
+func abortWithOpenAIError(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": relaymodel.Error{
+			Message: helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func getRequestFile(c *gin.Context) (*model.File, bool) {
+	file, err := model.GetFileById(c.Param("id"), c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithOpenAIError(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "get_file_failed", err.Error())
+		}
+		return nil, false
+	}
+	return file, true
+}
+
+// maxFileFormOverhead is the room left for the rest of the form around the file
+const maxFileFormOverhead = 1 << 20
+
+func UploadFile(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxFileSize+maxFileFormOverhead)
+	if _, err := c.MultipartForm(); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			abortWithOpenAIError(c, http.StatusRequestEntityTooLarge, "file_too_large",
+				fmt.Sprintf("file is too large, the maximum size is %s", helper.Bytes2Size(config.MaxFileSize)))
+			return
+		}
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_form", err.Error())
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if !model.FilePurposes[purpose] {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("invalid purpose: %s", purpose))
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "file_missing", "file is required")
+		return
+	}
+	if fileHeader.Size > config.MaxFileSize {
+		abortWithOpenAIError(c, http.StatusRequestEntityTooLarge, "file_too_large",
+			fmt.Sprintf("file is too large, the maximum size is %s", helper.Bytes2Size(config.MaxFileSize)))
+		return
+	}
+	content, err := fileHeader.Open()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "read_file_failed", err.Error())
+		return
+	}
+	defer content.Close()
+	file := &model.File{
+		UserId:   c.GetInt(ctxkey.Id),
+		TokenId:  c.GetInt(ctxkey.TokenId),
+		Bytes:    fileHeader.Size,
+		Filename: fileHeader.Filename,
+		Purpose:  purpose,
+	}
+	if err = model.CreateFile(file, content); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to create file: %s", err.Error())
+		abortWithOpenAIError(c, http.StatusBadRequest, "create_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	// fetch one more to know whether there is a next page
+	files, err := model.GetUserFiles(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "list_files_failed", err.Error())
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     files,
+		"has_more": hasMore,
+	}
+	if len(files) > 0 {
+		response["first_id"] = files[0].Id
+		response["last_id"] = files[len(files)-1].Id
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file, ok := getRequestFile(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file, ok := getRequestFile(c)
+	if !ok {
+		return
+	}
+	content, err := file.Open()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "read_file_failed", err.Error())
+		return
+	}
+	defer content.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, content); err != nil {
+		logger.Errorf(c.Request.Context(), "failed to send content of file %s: %s", file.Id, err.Error())
+	}
+}
+
+func DeleteFile(c *gin.Context) {
+	file, ok := getRequestFile(c)
+	if !ok {
+		return
+	}
+	if err := file.Delete(); err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "delete_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.Id,
+		"object":  "file",
+		"deleted": true,
+	})
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func uploadFile(t *testing.T, userId int, purpose string, content string) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("purpose", purpose)
+	part, err := writer.CreateFormFile("file", "input.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.Set(ctxkey.Id, userId)
+	UploadFile(c)
+	return w
+}
+
+func TestUploadFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, redisEnabled := common.SQLitePath, common.RedisEnabled
+	fileStoragePath, maxFileSize, userFileStorageLimit := config.FileStoragePath, config.MaxFileSize, config.UserFileStorageLimit
+	defer func() {
+		common.SQLitePath, common.RedisEnabled = sqlitePath, redisEnabled
+		config.FileStoragePath, config.MaxFileSize, config.UserFileStorageLimit = fileStoragePath, maxFileSize, userFileStorageLimit
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	config.FileStoragePath = t.TempDir()
+	model.InitDB()
+	storage.Init()
+
+	config.MaxFileSize = 64
+	config.UserFileStorageLimit = 0
+	w := uploadFile(t, 1, "batch", `{"custom_id":"1"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload should succeed, got %d %s", w.Code, w.Body.String())
+	}
+	var file model.File
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil || file.Bytes != 17 || file.Purpose != "batch" {
+		t.Errorf("unexpected file: %+v, %v", file, err)
+	}
+
+	if w := uploadFile(t, 1, "unknown", "{}"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown purpose should be rejected, got %d", w.Code)
+	}
+	if w := uploadFile(t, 1, "batch", strings.Repeat("a", 65)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("file beyond the maximum size should be rejected, got %d", w.Code)
+	}
+	// the body is cut before it is read in full
+	if w := uploadFile(t, 1, "batch", strings.Repeat("a", maxFileFormOverhead+128)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body beyond the maximum size should be rejected, got %d", w.Code)
+	}
+
+	config.UserFileStorageLimit = 40
+	if w := uploadFile(t, 2, "batch", strings.Repeat("a", 30)); w.Code != http.StatusOK {
+		t.Fatalf("upload within the storage limit should succeed, got %d %s", w.Code, w.Body.String())
+	}
+	if w := uploadFile(t, 2, "batch", strings.Repeat("a", 20)); w.Code != http.StatusBadRequest {
+		t.Errorf("upload beyond the storage limit should be rejected, got %d", w.Code)
+	}
+	if used, err := model.GetUserFileBytes(2); err != nil || used != 30 {
+		t.Errorf("rejected upload should not be stored, %d bytes used, %v", used, err)
+	}
+}
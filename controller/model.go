@@ -6,13 +6,17 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
 	relay "github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/capability"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 )
 
 // https://platform.openai.com/docs/api-reference/models/list
@@ -40,6 +44,16 @@ type OpenAIModels struct {
 	Permission []OpenAIModelPermission `json:"permission"`
 	Root       string                  `json:"root"`
 	Parent     *string                 `json:"parent"`
+	// Capabilities is filled when listing, since the admin may override them at any time
+	Capabilities *capability.Capability `json:"capabilities,omitempty"`
+}
+
+// withCapabilities returns a copy of the model with its known capabilities
+func (m OpenAIModels) withCapabilities() OpenAIModels {
+	if modelCapability, ok := capability.Get(m.Id); ok {
+		m.Capabilities = &modelCapability
+	}
+	return m
 }
 
 var models []OpenAIModels
@@ -129,16 +143,20 @@ func ListAllModels(c *gin.Context) {
 	})
 }
 
-func ListModels(c *gin.Context) {
-	ctx := c.Request.Context()
-	var availableModels []string
+// getTokenAvailableModels returns the models the token may use, which are the
+// models of the user's group unless the token is limited to some of them
+func getTokenAvailableModels(c *gin.Context) []string {
 	if c.GetString(ctxkey.AvailableModels) != "" {
-		availableModels = strings.Split(c.GetString(ctxkey.AvailableModels), ",")
-	} else {
-		userId := c.GetInt(ctxkey.Id)
-		userGroup, _ := model.CacheGetUserGroup(userId)
-		availableModels, _ = model.CacheGetGroupModels(ctx, userGroup)
+		return strings.Split(c.GetString(ctxkey.AvailableModels), ",")
 	}
+	userId := c.GetInt(ctxkey.Id)
+	userGroup, _ := model.CacheGetUserGroup(userId)
+	availableModels, _ := model.CacheGetGroupModels(c.Request.Context(), userGroup)
+	return availableModels
+}
+
+func ListModels(c *gin.Context) {
+	availableModels := getTokenAvailableModels(c)
 	modelSet := make(map[string]bool)
 	for _, availableModel := range availableModels {
 		modelSet[availableModel] = true
@@ -147,7 +165,7 @@ func ListModels(c *gin.Context) {
 	for _, model := range models {
 		if _, ok := modelSet[model.Id]; ok {
 			modelSet[model.Id] = false
-			availableOpenAIModels = append(availableOpenAIModels, model)
+			availableOpenAIModels = append(availableOpenAIModels, model.withCapabilities())
 		}
 	}
 	for modelName, ok := range modelSet {
@@ -159,7 +177,7 @@ func ListModels(c *gin.Context) {
 				OwnedBy: "custom",
 				Root:    modelName,
 				Parent:  nil,
-			})
+			}.withCapabilities())
 		}
 	}
 	c.JSON(200, gin.H{
@@ -171,7 +189,7 @@ func ListModels(c *gin.Context) {
 func RetrieveModel(c *gin.Context) {
 	modelId := c.Param("model")
 	if model, ok := modelsMap[modelId]; ok {
-		c.JSON(200, model)
+		c.JSON(200, model.withCapabilities())
 	} else {
 		Error := relaymodel.Error{
 			Message: fmt.Sprintf("The model '%s' does not exist", modelId),
@@ -185,6 +203,22 @@ func RetrieveModel(c *gin.Context) {
 	}
 }
 
+// ListOllamaTags lists the available models in the format of the Ollama /api/tags endpoint
+func ListOllamaTags(c *gin.Context) {
+	availableModels := getTokenAvailableModels(c)
+	sort.Strings(availableModels)
+	modifiedAt := time.Unix(1626777600, 0).UTC().Format(time.RFC3339)
+	tags := make([]ollama.ModelTag, 0, len(availableModels))
+	for _, modelName := range availableModels {
+		tags = append(tags, ollama.ModelTag{
+			Name:       modelName,
+			Model:      modelName,
+			ModifiedAt: modifiedAt,
+		})
+	}
+	c.JSON(http.StatusOK, ollama.TagsResponse{Models: tags})
+}
+
 func GetUserAvailableModels(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.GetInt(ctxkey.Id)
@@ -205,9 +239,10 @@ func GetUserAvailableModels(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "",
-		"data":    models,
+		"success":      true,
+		"message":      "",
+		"data":         models,
+		"capabilities": capability.GetAll(models),
 	})
 	return
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
@@ -19,6 +20,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/routing"
 )
 
 // https://platform.openai.com/docs/api-reference/chat
@@ -26,7 +28,9 @@ import (
 func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err = controller.RelayImageHelper(c, relayMode)
 	case relaymode.AudioSpeech:
 		fallthrough
@@ -38,6 +42,20 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = controller.RelayProxyHelper(c, relayMode)
 	case relaymode.Responses:
 		err = controller.RelayResponsesHelper(c)
+	case relaymode.AnthropicMessages:
+		err = controller.RelayAnthropicMessagesHelper(c)
+	case relaymode.GeminiGenerateContent:
+		err = controller.RelayGeminiGenerateContentHelper(c)
+	case relaymode.Realtime:
+		err = controller.RelayRealtimeHelper(c)
+	case relaymode.OllamaChat,
+		relaymode.OllamaGenerate,
+		relaymode.OllamaEmbed:
+		err = controller.RelayOllamaHelper(c, relayMode)
+	case relaymode.Rerank:
+		err = controller.RelayRerankHelper(c)
+	case relaymode.Completions:
+		err = controller.RelayCompletionsHelper(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
@@ -53,15 +71,23 @@ func Relay(c *gin.Context) {
 	}
 	channelId := c.GetInt(ctxkey.ChannelId)
 	userId := c.GetInt(ctxkey.Id)
+	if served, bizErr := controller.ServeCachedResponse(c, relayMode); served {
+		if bizErr != nil {
+			renderRelayError(c, relayMode, bizErr)
+		}
+		return
+	}
+	originalModel := c.GetString(ctxkey.OriginalModel)
+	startTime := time.Now()
 	bizErr := relayHelper(c, relayMode)
+	recordOutcome(c, originalModel, startTime, bizErr)
 	if bizErr == nil {
-		monitor.Emit(channelId, true)
+		controller.StoreCachedResponse(c)
 		return
 	}
 	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
-	originalModel := c.GetString(ctxkey.OriginalModel)
 	go processChannelRelayError(ctx, userId, channelId, channelName, *bizErr)
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
@@ -70,20 +96,25 @@ func Relay(c *gin.Context) {
 		retryTimes = 0
 	}
 	for i := retryTimes; i > 0; i-- {
-		channel, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes)
+		channel, lease, err := dbmodel.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes)
 		if err != nil {
 			logger.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %+v", err)
 			break
 		}
 		logger.Infof(ctx, "using channel #%d to retry (remain times %d)", channel.Id, i)
 		if channel.Id == lastFailedChannelId {
+			lease.Release(0)
 			continue
 		}
 		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		middleware.SetChannelLease(c, lease)
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		startTime = time.Now()
 		bizErr = relayHelper(c, relayMode)
+		recordOutcome(c, originalModel, startTime, bizErr)
 		if bizErr == nil {
+			controller.StoreCachedResponse(c)
 			return
 		}
 		channelId := c.GetInt(ctxkey.ChannelId)
@@ -98,6 +129,34 @@ func Relay(c *gin.Context) {
 
 		// BUG: bizErr is in race condition
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		renderRelayError(c, relayMode, bizErr)
+	}
+}
+
+// renderRelayError writes the error in the format native to the inbound protocol
+func renderRelayError(c *gin.Context, relayMode int, bizErr *model.ErrorWithStatusCode) {
+	switch relayMode {
+	case relaymode.AnthropicMessages:
+		c.JSON(bizErr.StatusCode, gin.H{
+			"type": "error",
+			"error": gin.H{
+				"type":    controller.AnthropicErrorType(bizErr.StatusCode),
+				"message": bizErr.Error.Message,
+			},
+		})
+	case relaymode.GeminiGenerateContent:
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": gin.H{
+				"code":    bizErr.StatusCode,
+				"message": bizErr.Error.Message,
+				"status":  controller.GeminiErrorStatus(bizErr.StatusCode),
+			},
+		})
+	case relaymode.OllamaChat, relaymode.OllamaGenerate, relaymode.OllamaEmbed:
+		c.JSON(bizErr.StatusCode, gin.H{
+			"error": bizErr.Error.Message,
+		})
+	default:
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
@@ -123,13 +182,31 @@ func shouldRetry(c *gin.Context, statusCode int) bool {
 	return true
 }
 
+// recordOutcome feeds the outcome of a relayed request to the circuit breaker and the adaptive
+// routing of the channel, the one which answered for a hedged request. Errors which are the
+// fault of the request say nothing about the channel and are left out.
+func recordOutcome(c *gin.Context, originalModel string, startTime time.Time, bizErr *model.ErrorWithStatusCode) {
+	success := bizErr == nil
+	if !success {
+		switch {
+		case bizErr.StatusCode == http.StatusTooManyRequests,
+			bizErr.StatusCode == http.StatusUnauthorized,
+			bizErr.StatusCode == http.StatusForbidden,
+			bizErr.StatusCode/100 == 5:
+		default:
+			return
+		}
+	}
+	channelId := c.GetInt(ctxkey.ChannelId)
+	monitor.Emit(channelId, originalModel, c.GetTime(ctxkey.ChannelSelectedAt), success)
+	routing.RecordRequest(channelId, originalModel, time.Since(startTime), success)
+}
+
 func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, err model.ErrorWithStatusCode) {
 	logger.Errorf(ctx, "relay error (channel id %d, user id: %d): %s", channelId, userId, err.Message)
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
 	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
 		monitor.DisableChannel(channelId, channelName, err.Message)
-	} else {
-		monitor.Emit(channelId, false)
 	}
 }
 
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/controller"
+)
+
+// https://platform.openai.com/docs/api-reference/responses
+
+func RetrieveResponse(c *gin.Context) {
+	_, stored, err := controller.GetStoredResponse(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithOpenAIError(c, http.StatusNotFound, "response_not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusOK, stored.Response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	response, err := model.GetResponseById(c.Param("id"), c.GetInt(ctxkey.Id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			abortWithOpenAIError(c, http.StatusNotFound, "response_not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "get_response_failed", err.Error())
+		}
+		return
+	}
+	if err = response.Delete(); err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "delete_response_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      response.Id,
+		"object":  "response",
+		"deleted": true,
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/truncation"
 	"net/http"
 	"strconv"
 )
@@ -117,6 +118,12 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("invalid subnet: %s", err.Error())
 		}
 	}
+	if _, err := truncation.Parse(token.ContextStrategy); err != nil {
+		return fmt.Errorf("invalid context strategy: %s", err.Error())
+	}
+	if token.RPM < 0 || token.TPM < 0 || token.RPD < 0 {
+		return fmt.Errorf("rate limits cannot be negative")
+	}
 	return nil
 }
 
@@ -140,16 +147,20 @@ func AddToken(c *gin.Context) {
 	}
 
 	cleanToken := model.Token{
-		UserId:         c.GetInt(ctxkey.Id),
-		Name:           token.Name,
-		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Models:         token.Models,
-		Subnet:         token.Subnet,
+		UserId:          c.GetInt(ctxkey.Id),
+		Name:            token.Name,
+		Key:             random.GenerateKey(),
+		CreatedTime:     helper.GetTimestamp(),
+		AccessedTime:    helper.GetTimestamp(),
+		ExpiredTime:     token.ExpiredTime,
+		RemainQuota:     token.RemainQuota,
+		UnlimitedQuota:  token.UnlimitedQuota,
+		Models:          token.Models,
+		Subnet:          token.Subnet,
+		ContextStrategy: token.ContextStrategy,
+		RPM:             token.RPM,
+		TPM:             token.TPM,
+		RPD:             token.RPD,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -239,6 +250,10 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.ContextStrategy = token.ContextStrategy
+		cleanToken.RPM = token.RPM
+		cleanToken.TPM = token.TPM
+		cleanToken.RPD = token.RPD
 	}
 	err = cleanToken.Update()
 	if err != nil {
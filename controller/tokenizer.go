@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+)
+
+// GetTokenizerStats returns how close the local prompt token estimates of each
+// model family are to the usage reported upstream
+func GetTokenizerStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tokenizer.GetStats(),
+	})
+}
+
+// ResetTokenizerStats clears the tokenizer accuracy stats
+func ResetTokenizerStats(c *gin.Context) {
+	tokenizer.ResetStats()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "tokenizer stats reset successfully",
+	})
+}
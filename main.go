@@ -16,10 +16,12 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/monitor/breaker"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/router"
 )
@@ -99,11 +101,19 @@ func main() {
 		logger.SysLog("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
 		model.InitBatchUpdater()
 	}
-	if config.EnableMetric {
-		logger.SysLog("metric enabled, will disable channel if too much request failed")
+	if config.CircuitBreakerEnabled {
+		logger.SysLog("circuit breaker enabled, will stop sending requests to a channel for a model if too much request failed")
+		if common.RedisEnabled {
+			go breaker.SyncFromRedis(config.CircuitBreakerSyncFrequency)
+		}
 	}
 	openai.InitTokenEncoders()
 	client.Init()
+	storage.Init()
+	if config.IsMasterNode {
+		go controller.StartBatchWorker()
+		go model.CleanExpiredIdempotencyRecords(60 * 60)
+	}
 	
 	// Initialize performance monitoring
 	monitor.InitPprof()
@@ -1,13 +1,16 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/limit"
 	"net/http"
 	"strings"
 )
@@ -91,7 +94,7 @@ func RootAuth() func(c *gin.Context) {
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
-		key, channelId := parseAuthToken(c.Request.Header.Get("Authorization"))
+		key, channelId := parseAuthToken(getRawAuthToken(c))
 		token, err := model.ValidateUserToken(key)
 		if err != nil {
 			abortWithMessage(c, http.StatusUnauthorized, err.Error())
@@ -113,6 +116,11 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 		requestModel, err := getRequestModel(c)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			abortWithMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is too large (over %d bytes)", maxBytesErr.Limit))
+			return
+		}
 		if err != nil && shouldCheckModel(c) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
@@ -128,6 +136,9 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Set(ctxkey.TokenKey, key)
+		c.Set(ctxkey.ContextStrategy, token.ContextStrategy)
+		c.Set(ctxkey.TokenRateLimits, limit.RateLimits{RPM: token.RPM, TPM: token.TPM, RPD: token.RPD})
 		if channelId != "" {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, channelId)
@@ -141,11 +152,39 @@ func TokenAuth() func(c *gin.Context) {
 		if channelId := c.Param("channelid"); channelId != "" {
 			c.Set(ctxkey.SpecificChannelId, channelId)
 		}
-
 		c.Next()
 	}
 }
 
+const realtimeKeyProtocolPrefix = "openai-insecure-api-key."
+
+// getRawAuthToken reads the token from the Authorization header, falling back
+// to the headers used by native clients of other vendors.
+func getRawAuthToken(c *gin.Context) string {
+	if raw := c.Request.Header.Get("Authorization"); raw != "" {
+		return raw
+	}
+	// Anthropic SDKs send the key in x-api-key
+	if raw := c.Request.Header.Get("x-api-key"); raw != "" {
+		return raw
+	}
+	// Google GenAI SDKs send the key in x-goog-api-key or the key query parameter, the
+	// latter is only read on their /v1beta routes
+	if raw := c.Request.Header.Get("x-goog-api-key"); raw != "" {
+		return raw
+	}
+	// browsers cannot set headers on a WebSocket, the realtime SDKs pass the key as a subprotocol
+	for _, protocol := range websocket.Subprotocols(c.Request) {
+		if strings.HasPrefix(protocol, realtimeKeyProtocolPrefix) {
+			return strings.TrimPrefix(protocol, realtimeKeyProtocolPrefix)
+		}
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/") {
+		return c.Query("key")
+	}
+	return ""
+}
+
 func parseAuthToken(raw string) (string, string) {
 	key := strings.TrimSpace(raw)
 	if key == "" {
@@ -189,7 +228,14 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/chat/completions") {
 		return true
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/responses") {
+	// only creating a response needs a model, /v1/responses/{id} reads a stored one
+	if c.Request.URL.Path == "/v1/responses" {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/messages") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models") {
 		return true
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/images") {
@@ -198,5 +244,14 @@ func shouldCheckModel(c *gin.Context) bool {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/audio") {
 		return true
 	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		return true
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/rerank") {
+		return true
+	}
+	if c.Request.URL.Path == "/api/chat" || c.Request.URL.Path == "/api/generate" || c.Request.URL.Path == "/api/embed" {
+		return true
+	}
 	return false
 }
@@ -1,11 +1,17 @@
 package middleware
 
 import (
+	"bytes"
+	"errors"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
 )
 
 func TestShouldCheckModel(t *testing.T) {
@@ -31,6 +37,21 @@ func TestShouldCheckModel(t *testing.T) {
 			path:     "/v1/responses",
 			expected: true,
 		},
+		{
+			name:     "should not check model for stored /v1/responses/:id",
+			path:     "/v1/responses/resp_123",
+			expected: false,
+		},
+		{
+			name:     "should check model for /v1/messages",
+			path:     "/v1/messages",
+			expected: true,
+		},
+		{
+			name:     "should check model for /v1beta/models/:action",
+			path:     "/v1beta/models/gemini-2.0-flash:generateContent",
+			expected: true,
+		},
 		{
 			name:     "should check model for /v1/images/generations",
 			path:     "/v1/images/generations",
@@ -46,6 +67,26 @@ func TestShouldCheckModel(t *testing.T) {
 			path:     "/v1/audio/translations",
 			expected: true,
 		},
+		{
+			name:     "should check model for /v1/realtime",
+			path:     "/v1/realtime?model=gpt-4o-realtime-preview",
+			expected: true,
+		},
+		{
+			name:     "should check model for /v1/rerank",
+			path:     "/v1/rerank",
+			expected: true,
+		},
+		{
+			name:     "should check model for /api/chat",
+			path:     "/api/chat",
+			expected: true,
+		},
+		{
+			name:     "should not check model for /api/tags",
+			path:     "/api/tags",
+			expected: false,
+		},
 		{
 			name:     "should not check model for /v1/models",
 			path:     "/v1/models",
@@ -72,3 +113,82 @@ func TestShouldCheckModel(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRequestModelSkipsFileUploads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := strings.NewReader(`{"model":"gpt-4o"}`)
+	req, _ := http.NewRequest("POST", "/v1/files", body)
+	req.Header.Set("Content-Type", "application/json")
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+
+	if requestModel, err := getRequestModel(c); err != nil || requestModel != "" {
+		t.Errorf("getRequestModel() = %q, %v, want no model", requestModel, err)
+	}
+	if body.Len() == 0 {
+		t.Error("the upload should be left for the handler to stream")
+	}
+}
+
+func TestGetRequestModelLimitsImageUploads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	maxImageUploadSize := config.MaxImageUploadSize
+	defer func() {
+		config.MaxImageUploadSize = maxImageUploadSize
+	}()
+	config.MaxImageUploadSize = 1024
+	newRequest := func(path string) *gin.Context {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		_ = writer.WriteField("model", "dall-e-2")
+		part, _ := writer.CreateFormFile("image", "image.png")
+		_, _ = part.Write(bytes.Repeat([]byte("a"), 2048))
+		_ = writer.Close()
+		req, _ := http.NewRequest("POST", path, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = req
+		return c
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if _, err := getRequestModel(newRequest("/v1/images/edits")); !errors.As(err, &maxBytesErr) {
+		t.Errorf("getRequestModel() error = %v, want the upload limit to be exceeded", err)
+	}
+	if _, err := getRequestModel(newRequest("/v1/audio/transcriptions")); err != nil {
+		t.Errorf("getRequestModel() error = %v, other uploads should not be limited", err)
+	}
+}
+
+func TestGetRawAuthToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		value    string
+		expected string
+	}{
+		{"Authorization header", "/v1/chat/completions", "Authorization", "Bearer sk-a", "Bearer sk-a"},
+		{"Anthropic header", "/v1/messages", "x-api-key", "sk-a", "sk-a"},
+		{"Google header", "/v1beta/models/gemini-2.0-flash:generateContent", "x-goog-api-key", "sk-a", "sk-a"},
+		{"realtime subprotocol", "/v1/realtime", "Sec-WebSocket-Protocol", "realtime, openai-insecure-api-key.sk-a", "sk-a"},
+		{"query on Gemini routes", "/v1beta/models/gemini-2.0-flash:generateContent?key=sk-a", "", "", "sk-a"},
+		{"query elsewhere", "/v1/chat/completions?key=sk-a", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+
+			if token := getRawAuthToken(c); token != tt.expected {
+				t.Errorf("getRawAuthToken() = %q, want %q", token, tt.expected)
+			}
+		})
+	}
+}
@@ -1,16 +1,21 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/limit"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
 )
 
 type ModelRequest struct {
@@ -25,6 +30,9 @@ func Distribute() func(c *gin.Context) {
 		c.Set(ctxkey.Group, userGroup)
 		var requestModel string
 		var channel *model.Channel
+		var lease *limit.Lease
+		// a request finding its channels at their limits waits in line for one of them
+		deadline := time.Now().Add(time.Duration(config.ChannelQueueTimeout) * time.Second)
 		channelId, ok := c.Get(ctxkey.SpecificChannelId)
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
@@ -41,10 +49,27 @@ func Distribute() func(c *gin.Context) {
 				abortWithMessage(c, http.StatusForbidden, "this channel has been disabled")
 				return
 			}
+			lease, ok = limit.TryAcquire(channel.Id, channel.GetLimits())
+			for !ok && time.Now().Before(deadline) && ctx.Err() == nil {
+				limit.Wait(ctx, time.Until(deadline))
+				lease, ok = limit.TryAcquire(channel.Id, channel.GetLimits())
+			}
+			if !ok {
+				abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("channel #%d is busy, please try again later", channel.Id))
+				return
+			}
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
 			var err error
-			channel, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			channel, lease, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			for errors.Is(err, model.ErrChannelsSaturated) && time.Now().Before(deadline) && ctx.Err() == nil {
+				limit.Wait(ctx, time.Until(deadline))
+				channel, lease, err = model.CacheGetRandomSatisfiedChannel(userGroup, requestModel, false)
+			}
+			if errors.Is(err, model.ErrChannelsSaturated) {
+				abortWithMessage(c, http.StatusTooManyRequests, fmt.Sprintf("all channels for model %s are busy, please try again later", requestModel))
+				return
+			}
 			if err != nil {
 				message := fmt.Sprintf("no available channel for model %s in current group %s", userGroup, requestModel)
 				if channel != nil {
@@ -57,14 +82,45 @@ func Distribute() func(c *gin.Context) {
 		}
 		logger.Debugf(ctx, "user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id)
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		SetChannelLease(c, lease)
+		defer ReleaseChannelLease(c)
 		c.Next()
 	}
 }
 
+// SetChannelLease makes the request count against the limits of the channel of the lease
+// instead of the one tried before, whose lease is released
+func SetChannelLease(c *gin.Context, lease *limit.Lease) {
+	ReleaseChannelLease(c)
+	c.Set(ctxkey.ChannelLease, lease)
+}
+
+// ReleaseChannelLease stops counting the request against the limits of its channel, with
+// the tokens it used when it is over
+func ReleaseChannelLease(c *gin.Context) {
+	var tokens int
+	if usage, ok := c.Get(ctxkey.Usage); ok {
+		if usage, ok := usage.(*relaymodel.Usage); ok && usage != nil {
+			tokens = usage.TotalTokens
+		}
+	}
+	ReleaseChannelLeaseWithTokens(c, tokens)
+}
+
+// ReleaseChannelLeaseWithTokens releases the lease of the request with the tokens its
+// channel used, for a request answered by several channels one after the other
+func ReleaseChannelLeaseWithTokens(c *gin.Context, tokens int) {
+	lease, _ := c.Get(ctxkey.ChannelLease)
+	if lease, ok := lease.(*limit.Lease); ok {
+		lease.Release(tokens)
+	}
+}
+
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
 	c.Set(ctxkey.Channel, channel.Type)
 	c.Set(ctxkey.ChannelId, channel.Id)
 	c.Set(ctxkey.ChannelName, channel.Name)
+	c.Set(ctxkey.ChannelSelectedAt, time.Now())
 	if channel.SystemPrompt != nil && *channel.SystemPrompt != "" {
 		c.Set(ctxkey.SystemPrompt, *channel.SystemPrompt)
 	}
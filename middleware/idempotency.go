@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyKeyMaxLength   = 255
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyPollInterval   = 200 * time.Millisecond
+	// idempotencyLease is how long a request in flight holds its key without renewing it
+	idempotencyLease         = 30
+	idempotencyRenewInterval = 10 * time.Second
+)
+
+// Idempotency honours the Idempotency-Key header of relay requests: the response of the
+// first request is stored and replayed to the requests repeating the key, a request in
+// flight is waited for, and reusing the key with a different request is rejected.
+// Failures worth retrying, i.e. 429 and 5xx, and responses too large to be stored release
+// the key instead.
+func Idempotency() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get(idempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			abortWithMessage(c, http.StatusBadRequest, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, idempotencyKeyMaxLength))
+			return
+		}
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			abortWithMessage(c, http.StatusBadRequest, "failed to read request body: "+err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(requestBody)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+		// keys are scoped to the user, so that users cannot see the responses of each other
+		key = fmt.Sprintf("%d:%s", c.GetInt(ctxkey.Id), key)
+
+		record, created, err := model.CreateIdempotencyRecord(key, fingerprint, idempotencyLease)
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, "failed to check idempotency key: "+err.Error())
+			return
+		}
+		if created {
+			handleIdempotentRequest(c, record)
+			return
+		}
+		if record.Fingerprint != fingerprint {
+			abortWithMessage(c, http.StatusUnprocessableEntity, "Keys for idempotent requests can only be used with the same parameters they were first used with")
+			return
+		}
+		if record.Status == model.IdempotencyStatusProcessing {
+			record, err = waitIdempotencyRecord(c, key)
+			if err != nil {
+				abortWithMessage(c, http.StatusInternalServerError, "failed to check idempotency key: "+err.Error())
+				return
+			}
+			if record == nil {
+				abortWithMessage(c, http.StatusConflict, "A request with the same idempotency key is still being processed, please retry later")
+				return
+			}
+		}
+		c.Header(idempotencyReplayedHeader, "true")
+		c.Data(record.StatusCode, record.ContentType, record.Body)
+		c.Abort()
+	}
+}
+
+func handleIdempotentRequest(c *gin.Context, record *model.IdempotencyRecord) {
+	ctx := c.Request.Context()
+	stopRenewing := renewIdempotencyRecord(ctx, record.Key)
+	recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+	// the response cannot be replayed, duplicates should not wait for it
+	recorder.onOverflow = func() {
+		stopRenewing()
+		releaseIdempotencyRecord(ctx, record.Key)
+	}
+	c.Writer = recorder
+	completed := false
+	defer func() {
+		stopRenewing()
+		// the request panicked, let it be retried
+		if !completed && !recorder.overflow {
+			_ = model.DeleteIdempotencyRecord(record.Key)
+		}
+	}()
+	c.Next()
+	completed = true
+	stopRenewing()
+	if recorder.overflow {
+		return
+	}
+
+	statusCode := recorder.Status()
+	contentType := recorder.Header().Get("Content-Type")
+	body := recorder.body.Bytes()
+	retryable := statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	// a stream cut short cannot be replayed as it was
+	truncated := strings.HasPrefix(contentType, "text/event-stream") && !bytes.Contains(body, []byte("[DONE]"))
+	if retryable || truncated {
+		releaseIdempotencyRecord(ctx, record.Key)
+		return
+	}
+	if err := model.CompleteIdempotencyRecord(record, statusCode, contentType, body, config.IdempotencyKeyTTL); err != nil {
+		logger.Errorf(ctx, "failed to store idempotent response: %s", err.Error())
+		_ = model.DeleteIdempotencyRecord(record.Key)
+	}
+}
+
+func releaseIdempotencyRecord(ctx context.Context, key string) {
+	if err := model.DeleteIdempotencyRecord(key); err != nil {
+		logger.Errorf(ctx, "failed to release idempotency key: %s", err.Error())
+	}
+}
+
+// renewIdempotencyRecord renews the lease of the key until the returned function is called
+func renewIdempotencyRecord(ctx context.Context, key string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := model.RenewIdempotencyRecord(key, idempotencyLease); err != nil {
+					logger.Errorf(ctx, "failed to renew idempotency key: %s", err.Error())
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// waitIdempotencyRecord waits for the request in flight with the key to complete, it
+// returns nil when it is still in flight after the wait timeout
+func waitIdempotencyRecord(c *gin.Context, key string) (*model.IdempotencyRecord, error) {
+	timeout := time.After(time.Duration(config.IdempotencyWaitTimeout) * time.Second)
+	ticker := time.NewTicker(idempotencyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return nil, c.Request.Context().Err()
+		case <-timeout:
+			return nil, nil
+		case <-ticker.C:
+		}
+		record, err := model.GetIdempotencyRecord(key)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			// the request failed and released the key
+			return nil, nil
+		}
+		if record.Status == model.IdempotencyStatusCompleted {
+			return record, nil
+		}
+	}
+}
+
+// idempotencyRecorder keeps a copy of what is written to the client, up to the maximum
+// size of a stored response
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body       bytes.Buffer
+	overflow   bool
+	onOverflow func()
+}
+
+func (w *idempotencyRecorder) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > config.IdempotencyMaxSize {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		w.onOverflow()
+		return
+	}
+	w.body.Write(data)
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/storage"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	common.RedisEnabled = false
+	sqlitePath, fileStoragePath := common.SQLitePath, config.FileStoragePath
+	defer func() {
+		common.SQLitePath, config.FileStoragePath = sqlitePath, fileStoragePath
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	config.FileStoragePath = t.TempDir()
+	model.InitDB()
+	storage.Init()
+
+	calls := 0
+	statusCode := http.StatusOK
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.Id, 1)
+		c.Next()
+	}, Idempotency())
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		calls++
+		c.String(statusCode, "response %d", calls)
+	})
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("key-1", `{"model":"gpt-4"}`)
+	if w.Code != http.StatusOK || w.Body.String() != "response 1" {
+		t.Fatalf("first request: got %d %q", w.Code, w.Body.String())
+	}
+	w = send("key-1", `{"model":"gpt-4"}`)
+	if w.Body.String() != "response 1" || w.Header().Get("Idempotent-Replayed") != "true" || calls != 1 {
+		t.Errorf("repeated request should be replayed, got %q with %d calls", w.Body.String(), calls)
+	}
+	w = send("key-1", `{"model":"gpt-4o"}`)
+	if w.Code != http.StatusUnprocessableEntity || calls != 1 {
+		t.Errorf("reused key with another body: got %d with %d calls", w.Code, calls)
+	}
+	send("", `{"model":"gpt-4"}`)
+	send("", `{"model":"gpt-4"}`)
+	if calls != 3 {
+		t.Errorf("requests without a key should not be deduplicated, got %d calls", calls)
+	}
+
+	// failures worth retrying release the key
+	statusCode = http.StatusServiceUnavailable
+	send("key-2", `{"model":"gpt-4"}`)
+	statusCode = http.StatusOK
+	w = send("key-2", `{"model":"gpt-4"}`)
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" || calls != 5 {
+		t.Errorf("request after a 503 should be retried, got %d with %d calls", w.Code, calls)
+	}
+
+	w = send(strings.Repeat("k", 256), `{"model":"gpt-4"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("too long key: got %d", w.Code)
+	}
+
+	// responses too large to be stored release the key
+	maxSize := config.IdempotencyMaxSize
+	config.IdempotencyMaxSize = 4
+	w = send("key-3", `{"model":"gpt-4"}`)
+	config.IdempotencyMaxSize = maxSize
+	if w.Body.String() != "response 6" {
+		t.Errorf("large response should still reach the client, got %q", w.Body.String())
+	}
+	if record, err := model.GetIdempotencyRecord("1:key-3"); err != nil || record != nil {
+		t.Errorf("large response should release the key, got %+v, %v", record, err)
+	}
+
+	// the key of a request whose node died is released once its lease is over
+	if _, _, err := model.CreateIdempotencyRecord("1:key-4", "another request", 30); err != nil {
+		t.Fatal(err)
+	}
+	w = send("key-4", `{"model":"gpt-4"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key in flight should be held, got %d", w.Code)
+	}
+	model.DB.Model(&model.IdempotencyRecord{Key: "1:key-4"}).Update("expires_at", 0)
+	w = send("key-4", `{"model":"gpt-4"}`)
+	if w.Code != http.StatusOK || w.Body.String() != "response 7" {
+		t.Errorf("key past its lease should be taken over, got %d %q", w.Code, w.Body.String())
+	}
+	record, err := model.GetIdempotencyRecord("1:key-4")
+	if err != nil || record == nil || record.ExpiresAt < time.Now().Unix()+int64(config.IdempotencyKeyTTL)-5 {
+		t.Errorf("completed response should be kept for the key TTL, got %+v, %v", record, err)
+	}
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/limit"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// rateLimitScope is a token or a user whose requests are limited
+type rateLimitScope struct {
+	name   string
+	key    string
+	limits limit.RateLimits
+}
+
+// rateLimitHeaders are the x-ratelimit-* headers of the most restrictive limits
+type rateLimitHeaders struct {
+	limitRequests, remainingRequests int64
+	resetRequests                    time.Duration
+	limitTokens, remainingTokens     int64
+	resetTokens                      time.Duration
+}
+
+// TokenRateLimit limits the relayed requests of the token authenticated by TokenAuth and
+// of its user, and counts the tokens they used once they are over
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		scopes, err := getRateLimitScopes(c)
+		if err != nil {
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !checkRateLimits(c, scopes) {
+			return
+		}
+		c.Next()
+		countRateLimitTokens(c, scopes)
+	}
+}
+
+func getRateLimitScopes(c *gin.Context) ([]rateLimitScope, error) {
+	var scopes []rateLimitScope
+	tokenLimits, _ := c.Get(ctxkey.TokenRateLimits)
+	if tokenLimits, ok := tokenLimits.(limit.RateLimits); ok && !tokenLimits.Unlimited() {
+		scopes = append(scopes, rateLimitScope{
+			name:   fmt.Sprintf("token %s", c.GetString(ctxkey.TokenName)),
+			key:    fmt.Sprintf("token:%d", c.GetInt(ctxkey.TokenId)),
+			limits: tokenLimits,
+		})
+	}
+	userId := c.GetInt(ctxkey.Id)
+	userLimits, err := model.CacheGetUserRateLimits(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !userLimits.Unlimited() {
+		scopes = append(scopes, rateLimitScope{
+			name:   fmt.Sprintf("user #%d", userId),
+			key:    fmt.Sprintf("user:%d", userId),
+			limits: userLimits,
+		})
+	}
+	return scopes, nil
+}
+
+func untilNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+}
+
+func untilNextDay(now time.Time) time.Duration {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
+
+// formatResetDuration formats a duration the way OpenAI does, e.g. 1s or 6m0s
+func formatResetDuration(d time.Duration) string {
+	return (time.Duration(math.Ceil(d.Seconds())) * time.Second).String()
+}
+
+func abortWithRateLimit(c *gin.Context, scope rateLimitScope, errorType string, period string, limitValue int, used int64, reset time.Duration) {
+	message := fmt.Sprintf("Rate limit reached for %s on %s: Limit %d, Used %d. Please try again in %s.",
+		scope.name, period, limitValue, used, formatResetDuration(reset))
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message": helper.MessageWithRequestId(message, c.GetString(helper.RequestIdKey)),
+			"type":    errorType,
+			"code":    "rate_limit_exceeded",
+		},
+	})
+	c.Abort()
+	logger.Warn(c.Request.Context(), message)
+}
+
+// checkRateLimits rejects the request when the token or its user has reached one of its
+// limits, otherwise counts it and sets the x-ratelimit-* headers. Nodes check and count
+// separately, so that concurrent requests may go a little beyond the limits.
+func checkRateLimits(c *gin.Context, scopes []rateLimitScope) bool {
+	now := time.Now()
+	headers := rateLimitHeaders{remainingRequests: -1, remainingTokens: -1}
+	for _, scope := range scopes {
+		usage := limit.GetRateLimitUsage(scope.key)
+		requests := int64(math.Ceil(usage.Requests))
+		tokens := int64(math.Ceil(usage.Tokens))
+		if scope.limits.RPD > 0 && usage.DailyRequests >= int64(scope.limits.RPD) {
+			abortWithRateLimit(c, scope, "requests", "requests per day (RPD)", scope.limits.RPD, usage.DailyRequests, untilNextDay(now))
+			return false
+		}
+		if scope.limits.RPM > 0 && usage.Requests >= float64(scope.limits.RPM) {
+			abortWithRateLimit(c, scope, "requests", "requests per min (RPM)", scope.limits.RPM, requests, untilNextMinute(now))
+			return false
+		}
+		if scope.limits.TPM > 0 && usage.Tokens >= float64(scope.limits.TPM) {
+			abortWithRateLimit(c, scope, "tokens", "tokens per min (TPM)", scope.limits.TPM, tokens, untilNextMinute(now))
+			return false
+		}
+		// the remaining requests count this one
+		if scope.limits.RPM > 0 {
+			headers.setRequests(int64(scope.limits.RPM), int64(scope.limits.RPM)-requests-1, untilNextMinute(now))
+		}
+		if scope.limits.RPD > 0 {
+			headers.setRequests(int64(scope.limits.RPD), int64(scope.limits.RPD)-usage.DailyRequests-1, untilNextDay(now))
+		}
+		if scope.limits.TPM > 0 {
+			headers.setTokens(int64(scope.limits.TPM), int64(scope.limits.TPM)-tokens, untilNextMinute(now))
+		}
+	}
+	for _, scope := range scopes {
+		limit.CountRequest(scope.key)
+	}
+	headers.write(c)
+	return true
+}
+
+func (h *rateLimitHeaders) setRequests(limitValue int64, remaining int64, reset time.Duration) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	if h.remainingRequests < 0 || remaining < h.remainingRequests {
+		h.limitRequests, h.remainingRequests, h.resetRequests = limitValue, remaining, reset
+	}
+}
+
+func (h *rateLimitHeaders) setTokens(limitValue int64, remaining int64, reset time.Duration) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	if h.remainingTokens < 0 || remaining < h.remainingTokens {
+		h.limitTokens, h.remainingTokens, h.resetTokens = limitValue, remaining, reset
+	}
+}
+
+func (h *rateLimitHeaders) write(c *gin.Context) {
+	if h.remainingRequests >= 0 {
+		c.Header("x-ratelimit-limit-requests", strconv.FormatInt(h.limitRequests, 10))
+		c.Header("x-ratelimit-remaining-requests", strconv.FormatInt(h.remainingRequests, 10))
+		c.Header("x-ratelimit-reset-requests", formatResetDuration(h.resetRequests))
+	}
+	if h.remainingTokens >= 0 {
+		c.Header("x-ratelimit-limit-tokens", strconv.FormatInt(h.limitTokens, 10))
+		c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(h.remainingTokens, 10))
+		c.Header("x-ratelimit-reset-tokens", formatResetDuration(h.resetTokens))
+	}
+}
+
+// countRateLimitTokens counts the tokens used by the request once its response is over
+func countRateLimitTokens(c *gin.Context, scopes []rateLimitScope) {
+	usage, ok := c.Get(ctxkey.Usage)
+	if !ok {
+		return
+	}
+	if usage, ok := usage.(*relaymodel.Usage); ok && usage != nil {
+		for _, scope := range scopes {
+			if scope.limits.TPM > 0 {
+				limit.CountTokens(scope.key, usage.TotalTokens)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/limit"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestCheckRateLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	defer func() {
+		common.RedisEnabled = redisEnabled
+	}()
+
+	scopes := []rateLimitScope{
+		{name: "token test", key: "token:rate-limit-test", limits: limit.RateLimits{RPM: 2, TPM: 100}},
+		{name: "user #1", key: "user:rate-limit-test", limits: limit.RateLimits{RPD: 10}},
+	}
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if checkRateLimits(c, scopes) {
+			c.Set(ctxkey.Usage, &relaymodel.Usage{TotalTokens: 40})
+			countRateLimitTokens(c, scopes)
+			c.Status(http.StatusOK)
+		}
+		return w
+	}
+
+	w := request()
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request should pass, got %d", w.Code)
+	}
+	if w.Header().Get("x-ratelimit-limit-requests") != "2" || w.Header().Get("x-ratelimit-remaining-requests") != "1" {
+		t.Errorf("requests headers should come from the most restrictive limit, got %v", w.Header())
+	}
+	if w.Header().Get("x-ratelimit-limit-tokens") != "100" || w.Header().Get("x-ratelimit-remaining-tokens") != "100" {
+		t.Errorf("unexpected tokens headers: %v", w.Header())
+	}
+
+	w = request()
+	if w.Code != http.StatusOK || w.Header().Get("x-ratelimit-remaining-tokens") != "60" {
+		t.Fatalf("second request should pass with the tokens of the first counted, got %d %v", w.Code, w.Header())
+	}
+
+	w = request()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("third request should be rate limited, got %d", w.Code)
+	}
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Type != "requests" || body.Error.Code != "rate_limit_exceeded" {
+		t.Errorf("unexpected error: %+v", body.Error)
+	}
+	if usage := limit.GetRateLimitUsage("user:rate-limit-test"); usage.DailyRequests != 2 {
+		t.Errorf("rejected request should not be counted, got %d daily requests", usage.DailyRequests)
+	}
+}
+
+func TestTokenRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, redisEnabled := common.SQLitePath, common.RedisEnabled
+	defer func() {
+		common.SQLitePath, common.RedisEnabled = sqlitePath, redisEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	model.InitDB()
+	if err := model.DB.Create(&model.User{Id: 1, Username: "rate", Password: "12345678", Group: "default", AffCode: "rate", AccessToken: "rate"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 7)
+		c.Set(ctxkey.TokenName, "test")
+		c.Set(ctxkey.TokenRateLimits, limit.RateLimits{RPM: 1, TPM: 1000})
+		c.Next()
+	})
+	router.GET("/v1/models", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/v1/chat/completions", TokenRateLimit(), func(c *gin.Context) {
+		c.Set(ctxkey.Usage, &relaymodel.Usage{TotalTokens: 30})
+		c.Status(http.StatusOK)
+	})
+	send := func(method string, path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if code := send(http.MethodPost, "/v1/chat/completions"); code != http.StatusOK {
+		t.Fatalf("first relayed request should pass, got %d", code)
+	}
+	if usage := limit.GetRateLimitUsage("token:7"); usage.Tokens < 30 {
+		t.Errorf("tokens of the relayed request should be counted, got %+v", usage)
+	}
+	if code := send(http.MethodPost, "/v1/chat/completions"); code != http.StatusTooManyRequests {
+		t.Errorf("second relayed request should be rate limited, got %d", code)
+	}
+	if code := send(http.MethodGet, "/v1/models"); code != http.StatusOK {
+		t.Errorf("routes which relay nothing should not be rate limited, got %d", code)
+	}
+}
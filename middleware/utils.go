@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"net/http"
 	"strings"
 )
 
@@ -20,7 +24,21 @@ func abortWithMessage(c *gin.Context, statusCode int, message string) {
 	logger.Error(c.Request.Context(), message)
 }
 
+// isImageUpload reports whether the request is an image edit or variation, whose body is
+// limited to config.MaxImageUploadSize
+func isImageUpload(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/v1/images/edits") ||
+		strings.HasPrefix(c.Request.URL.Path, "/v1/images/variations")
+}
+
 func getRequestModel(c *gin.Context) (string, error) {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/files") {
+		// uploads are streamed to the storage, reading them here would hold them in memory
+		return "", nil
+	}
+	if isImageUpload(c) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxImageUploadSize)
+	}
 	var modelRequest ModelRequest
 	err := common.UnmarshalBodyReusable(c, &modelRequest)
 	if err != nil {
@@ -36,7 +54,20 @@ func getRequestModel(c *gin.Context) (string, error) {
 			modelRequest.Model = c.Param("model")
 		}
 	}
-	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") {
+	if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") {
+		// the Gemini API carries the model in the path
+		modelRequest.Model, _ = gemini.ParseInboundPath(c.Request.URL.Path)
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") && modelRequest.Model == "" {
+		// Ollama clients do not always send a JSON content type
+		requestBody, _ := common.GetRequestBody(c)
+		_ = json.Unmarshal(requestBody, &modelRequest)
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
+		// the realtime session is opened with a GET carrying the model in the query
+		modelRequest.Model = c.Query("model")
+	}
+	if strings.HasPrefix(c.Request.URL.Path, "/v1/images/generations") || isImageUpload(c) {
 		if modelRequest.Model == "" {
 			modelRequest.Model = "dall-e-2"
 		}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"context"
+	"errors"
+	"math/rand"
 	"sort"
 	"strings"
 
@@ -9,18 +11,84 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/utils"
+	"github.com/songquanpeng/one-api/monitor/breaker"
+	"github.com/songquanpeng/one-api/relay/limit"
+	"github.com/songquanpeng/one-api/relay/routing"
 )
 
+// ErrChannelsSaturated is returned when every channel able to serve a request is at its limits
+var ErrChannelsSaturated = errors.New("all channels are at their limits")
+
 type Ability struct {
 	Group     string `json:"group" gorm:"type:varchar(32);primaryKey;autoIncrement:false"`
 	Model     string `json:"model" gorm:"primaryKey;autoIncrement:false"`
 	ChannelId int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false;index"`
 	Enabled   bool   `json:"enabled"`
 	Priority  *int64 `json:"priority" gorm:"bigint;default:0;index"`
+	// Weight overrides the weight of the channel for this group and model when set
+	Weight *uint `json:"weight"`
+}
+
+func (ability *Ability) GetPriority() int64 {
+	if ability.Priority == nil {
+		return 0
+	}
+	return *ability.Priority
+}
+
+// GetWeight returns the weight of the ability, which is the one of its channel unless overridden
+func (ability *Ability) GetWeight(channel *Channel) uint {
+	if ability.Weight != nil {
+		return *ability.Weight
+	}
+	return channel.GetWeight()
 }
 
-func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
-	ability := Ability{}
+// pickChannel returns the index of the channel to use among channels of the same tier,
+// following the routing strategy of the group
+func pickChannel(group string, model string, channels []*Channel, weights []uint) int {
+	switch routing.GetStrategy(group) {
+	case routing.Random:
+		return rand.Intn(len(channels))
+	case routing.Adaptive:
+		// power of two choices: draw two channels and keep the cheaper one
+		first := pickWeighted(weights)
+		second := first
+		for i := 0; i < 3 && second == first && len(channels) > 1; i++ {
+			second = pickWeighted(weights)
+		}
+		if routing.Cost(channels[second].Id, model) < routing.Cost(channels[first].Id, model) {
+			return second
+		}
+		return first
+	default:
+		return pickWeighted(weights)
+	}
+}
+
+// pickWeighted returns an index chosen at random in proportion to the weights, zero weights
+// are the last resort and only chosen, uniformly, when all the weights are zero
+func pickWeighted(weights []uint) int {
+	var total uint64
+	for _, weight := range weights {
+		total += uint64(weight)
+	}
+	if total == 0 {
+		return rand.Intn(len(weights))
+	}
+	n := uint64(rand.Int63n(int64(total)))
+	for i, weight := range weights {
+		if n < uint64(weight) {
+			return i
+		}
+		n -= uint64(weight)
+	}
+	return len(weights) - 1
+}
+
+// GetRandomSatisfiedChannel picks a channel for the model from the database, see
+// CacheGetRandomSatisfiedChannel
+func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, *limit.Lease, error) {
 	groupCol := "`group`"
 	trueVal := "1"
 	if common.UsingPostgreSQL {
@@ -28,26 +96,99 @@ func GetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority b
 		trueVal = "true"
 	}
 
-	var err error = nil
-	var channelQuery *gorm.DB
-	if ignoreFirstPriority {
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-	} else {
-		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
-		channelQuery = DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal+" and priority = (?)", group, model, maxPrioritySubQuery)
+	var abilities []*Ability
+	err := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model).Find(&abilities).Error
+	if err != nil {
+		return nil, nil, err
 	}
-	if common.UsingSQLite || common.UsingPostgreSQL {
-		err = channelQuery.Order("RANDOM()").First(&ability).Error
-	} else {
-		err = channelQuery.Order("RAND()").First(&ability).Error
+	if len(abilities) == 0 {
+		return nil, nil, gorm.ErrRecordNotFound
 	}
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	var channels []*Channel
+	err = DB.Where("id in ?", channelIds).Find(&channels).Error
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	id2channel := make(map[int]*Channel, len(channels))
+	for _, channel := range channels {
+		id2channel[channel.Id] = channel
 	}
-	channel := Channel{}
-	channel.Id = ability.ChannelId
-	err = DB.First(&channel, "id = ?", ability.ChannelId).Error
-	return &channel, err
+	// the channels found at their limits or whose probe was taken meanwhile
+	skipped := make(map[int]bool)
+	var saturated bool
+	for {
+		// the channels whose circuit breaker is open or which are at their limits are left
+		// out, lower priorities take over
+		available := make([]*Ability, 0, len(abilities))
+		var maxPriority int64
+		for _, ability := range abilities {
+			if _, ok := id2channel[ability.ChannelId]; !ok || skipped[ability.ChannelId] || !breaker.Available(ability.ChannelId, model) {
+				continue
+			}
+			if len(available) == 0 || ability.GetPriority() > maxPriority {
+				maxPriority = ability.GetPriority()
+			}
+			available = append(available, ability)
+		}
+		candidates := make([]*Channel, 0, len(available))
+		weights := make([]uint, 0, len(available))
+		for _, ability := range available {
+			if ignoreFirstPriority || ability.GetPriority() == maxPriority {
+				channel := id2channel[ability.ChannelId]
+				candidates = append(candidates, channel)
+				weights = append(weights, ability.GetWeight(channel))
+			}
+		}
+		if len(candidates) == 0 && saturated {
+			return nil, nil, ErrChannelsSaturated
+		}
+		if len(candidates) == 0 {
+			return nil, nil, gorm.ErrRecordNotFound
+		}
+		channel := candidates[pickChannel(group, model, candidates, weights)]
+		lease, err := acquireChannel(channel, model)
+		if err == nil {
+			return channel, lease, nil
+		}
+		skipped[channel.Id] = true
+		saturated = saturated || errors.Is(err, ErrChannelsSaturated)
+	}
+}
+
+// errProbeTaken is returned when another request took the probe of a half-open breaker
+var errProbeTaken = errors.New("probe of the circuit breaker is taken")
+
+// acquireChannel takes a lease of the channel, unless it is at its limits, and lets the
+// request through its circuit breaker for the model
+func acquireChannel(channel *Channel, model string) (*limit.Lease, error) {
+	lease, ok := limit.TryAcquire(channel.Id, channel.GetLimits())
+	if !ok {
+		return nil, ErrChannelsSaturated
+	}
+	if !breaker.Acquire(channel.Id, model) {
+		lease.Release(0)
+		return nil, errProbeTaken
+	}
+	return lease, nil
+}
+
+// availableChannels leaves out the channels whose circuit breaker for the model is open and
+// the skipped ones, along with their weights
+func availableChannels(model string, channels []*Channel, weights []uint, skipped map[int]bool) (availableChannels []*Channel, availableWeights []uint) {
+	availableChannels = make([]*Channel, 0, len(channels))
+	availableWeights = make([]uint, 0, len(weights))
+	for i, channel := range channels {
+		if skipped[channel.Id] || !breaker.Available(channel.Id, model) {
+			continue
+		}
+		availableChannels = append(availableChannels, channel)
+		availableWeights = append(availableWeights, weights[i])
+	}
+	return availableChannels, availableWeights
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -77,9 +218,15 @@ func (channel *Channel) DeleteAbilities() error {
 // UpdateAbilities updates abilities of this channel.
 // Make sure the channel is completed before calling this function.
 func (channel *Channel) UpdateAbilities() error {
+	// Keep the weight overrides of the abilities which remain
+	var overrides []*Ability
+	err := DB.Where("channel_id = ? and weight is not null", channel.Id).Find(&overrides).Error
+	if err != nil {
+		return err
+	}
 	// A quick and dirty way to update abilities
 	// First delete all abilities of this channel
-	err := channel.DeleteAbilities()
+	err = channel.DeleteAbilities()
 	if err != nil {
 		return err
 	}
@@ -88,9 +235,27 @@ func (channel *Channel) UpdateAbilities() error {
 	if err != nil {
 		return err
 	}
+	for _, ability := range overrides {
+		err = UpdateAbilityWeight(ability.ChannelId, ability.Group, ability.Model, ability.Weight)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// UpdateAbilityWeight overrides the weight of a channel for a group and model, nil
+// removes the override
+func UpdateAbilityWeight(channelId int, group string, model string, weight *uint) error {
+	return DB.Model(&Ability{}).Where(&Ability{Group: group, Model: model, ChannelId: channelId}).Update("weight", weight).Error
+}
+
+func GetAbilitiesByChannelId(channelId int) ([]*Ability, error) {
+	var abilities []*Ability
+	err := DB.Where("channel_id = ?", channelId).Find(&abilities).Error
+	return abilities, err
+}
+
 func UpdateAbilityStatus(channelId int, status bool) error {
 	return DB.Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
 }
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/monitor/breaker"
+	"github.com/songquanpeng/one-api/relay/limit"
+	"github.com/songquanpeng/one-api/relay/routing"
+)
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+// assertDistribution checks that the observed shares are within 0.03 of the expected ones
+func assertDistribution(t *testing.T, counts map[int]int, expected map[int]float64, samples int) {
+	t.Helper()
+	for id, share := range expected {
+		got := float64(counts[id]) / float64(samples)
+		if math.Abs(got-share) > 0.03 {
+			t.Errorf("channel #%d: got share %.3f, expected %.3f", id, got, share)
+		}
+	}
+	for id, count := range counts {
+		if _, ok := expected[id]; !ok {
+			t.Errorf("channel #%d should not be chosen, got %d times", id, count)
+		}
+	}
+}
+
+func TestPickWeighted(t *testing.T) {
+	const samples = 20000
+	counts := make(map[int]int)
+	for i := 0; i < samples; i++ {
+		counts[pickWeighted([]uint{1, 3, 0})]++
+	}
+	assertDistribution(t, counts, map[int]float64{0: 0.25, 1: 0.75}, samples)
+
+	// zero weights are the last resort
+	counts = make(map[int]int)
+	for i := 0; i < samples; i++ {
+		counts[pickWeighted([]uint{0, 0})]++
+	}
+	assertDistribution(t, counts, map[int]float64{0: 0.5, 1: 0.5}, samples)
+}
+
+func TestGetRandomSatisfiedChannelWeighted(t *testing.T) {
+	sqlitePath, memoryCacheEnabled := common.SQLitePath, config.MemoryCacheEnabled
+	defer func() {
+		common.SQLitePath, config.MemoryCacheEnabled = sqlitePath, memoryCacheEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	InitDB()
+
+	channels := []*Channel{
+		{Id: 1, Name: "a", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(10), Weight: uintPtr(1)},
+		{Id: 2, Name: "b", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(10), Weight: uintPtr(3)},
+		{Id: 3, Name: "c", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(10), Weight: uintPtr(0)},
+		{Id: 4, Name: "d", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(0), Weight: uintPtr(1)},
+		{Id: 5, Name: "e", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(0), Weight: uintPtr(1)},
+	}
+	for _, channel := range channels {
+		if err := channel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// channel #5 is preferred for this model only
+	if err := UpdateAbilityWeight(5, "default", "gpt-4o", uintPtr(4)); err != nil {
+		t.Fatal(err)
+	}
+	// overrides survive the update of the channel
+	if err := channels[4].Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	const samples = 4000
+	for _, memoryCacheEnabled := range []bool{true, false} {
+		config.MemoryCacheEnabled = memoryCacheEnabled
+		if memoryCacheEnabled {
+			InitChannelCache()
+		}
+		sample := func(ignoreFirstPriority bool) map[int]int {
+			counts := make(map[int]int)
+			for i := 0; i < samples; i++ {
+				channel, _, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", ignoreFirstPriority)
+				if err != nil {
+					t.Fatal(err)
+				}
+				counts[channel.Id]++
+			}
+			return counts
+		}
+		assertDistribution(t, sample(false), map[int]float64{1: 0.25, 2: 0.75}, samples)
+		if memoryCacheEnabled {
+			assertDistribution(t, sample(true), map[int]float64{4: 0.2, 5: 0.8}, samples)
+		} else {
+			// the database picks among all the priorities
+			assertDistribution(t, sample(true), map[int]float64{1: 1.0 / 9, 2: 3.0 / 9, 4: 1.0 / 9, 5: 4.0 / 9}, samples)
+		}
+	}
+
+	if err := UpdateAbilityWeight(5, "default", "gpt-4o", nil); err != nil {
+		t.Fatal(err)
+	}
+	abilities, err := GetAbilitiesByChannelId(5)
+	if err != nil || len(abilities) != 1 || abilities[0].Weight != nil {
+		t.Errorf("override should be removed, got %+v, %v", abilities, err)
+	}
+}
+
+func TestPickChannelAdaptive(t *testing.T) {
+	if err := routing.UpdateChannelRoutingStrategy(routing.Adaptive); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = routing.UpdateChannelRoutingStrategy(routing.Weighted)
+	}()
+	for i := 0; i < 10; i++ {
+		routing.RecordRequest(101, "adaptive-model", 3*time.Second, true)
+		routing.RecordRequest(102, "adaptive-model", 500*time.Millisecond, true)
+	}
+	channels := []*Channel{{Id: 101}, {Id: 102}}
+
+	const samples = 4000
+	counts := make(map[int]int)
+	for i := 0; i < samples; i++ {
+		counts[channels[pickChannel("default", "adaptive-model", channels, []uint{1, 1})].Id]++
+	}
+	// the slower channel is only chosen when all four draws land on it
+	assertDistribution(t, counts, map[int]float64{101: 1.0 / 16, 102: 15.0 / 16}, samples)
+}
+
+func TestGetRandomSatisfiedChannelBreaker(t *testing.T) {
+	sqlitePath, memoryCacheEnabled, redisEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled
+	defer func() {
+		breaker.Reset(1, "")
+		config.CircuitBreakerEnabled = false
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled = sqlitePath, memoryCacheEnabled, redisEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	config.CircuitBreakerEnabled = true
+	InitDB()
+
+	channels := []*Channel{
+		{Id: 1, Name: "a", Models: "gpt-4o,gpt-4o-mini", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(10)},
+		{Id: 2, Name: "b", Models: "gpt-4o,gpt-4o-mini", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(0)},
+	}
+	for _, channel := range channels {
+		if err := channel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < config.CircuitBreakerWindowSize; i++ {
+		breaker.Record(1, "gpt-4o", time.Now(), false)
+	}
+
+	for _, memoryCacheEnabled := range []bool{true, false} {
+		config.MemoryCacheEnabled = memoryCacheEnabled
+		if memoryCacheEnabled {
+			InitChannelCache()
+		}
+		// the lower priority takes over while the breaker is open
+		if channel, _, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false); err != nil || channel.Id != 2 {
+			t.Errorf("memory cache %v: expected channel #2, got %+v, %v", memoryCacheEnabled, channel, err)
+		}
+		if channel, _, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o-mini", false); err != nil || channel.Id != 1 {
+			t.Errorf("memory cache %v: breaker of another model should not matter, got %+v, %v", memoryCacheEnabled, channel, err)
+		}
+	}
+}
+
+func TestGetRandomSatisfiedChannelLimits(t *testing.T) {
+	sqlitePath, memoryCacheEnabled, redisEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled
+	defer func() {
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled = sqlitePath, memoryCacheEnabled, redisEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	InitDB()
+
+	channels := []*Channel{
+		{Id: 201, Name: "a", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(10), Config: `{"max_concurrency":1}`},
+		{Id: 202, Name: "b", Models: "gpt-4o", Group: "default", Status: ChannelStatusEnabled, Priority: int64Ptr(0), Config: `{"max_concurrency":1}`},
+	}
+	for _, channel := range channels {
+		if err := channel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	InitChannelCache()
+
+	lease := limit.Acquire(201, channels[0].GetLimits())
+	for _, memoryCacheEnabled := range []bool{true, false} {
+		config.MemoryCacheEnabled = memoryCacheEnabled
+		// the lower priority takes over while the channel is busy
+		channel, lower, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+		if err != nil || channel.Id != 202 {
+			t.Fatalf("memory cache %v: expected channel #202, got %+v, %v", memoryCacheEnabled, channel, err)
+		}
+		// the lease of the request takes the lower priority as well
+		if _, _, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false); !errors.Is(err, ErrChannelsSaturated) {
+			t.Errorf("memory cache %v: expected all channels to be saturated, got %v", memoryCacheEnabled, err)
+		}
+		lower.Release(0)
+	}
+	lease.Release(0)
+	channel, lease, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false)
+	if err != nil || channel.Id != 201 {
+		t.Errorf("released channel should be chosen again, got %+v, %v", channel, err)
+	}
+	if channel, lower, err := CacheGetRandomSatisfiedChannel("default", "gpt-4o", false); err != nil || channel.Id != 202 {
+		t.Errorf("the channel taken by the request should leave the lower priority, got %+v, %v", channel, err)
+	} else {
+		lower.Release(0)
+	}
+	lease.Release(0)
+}
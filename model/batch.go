@@ -0,0 +1,166 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// https://platform.openai.com/docs/api-reference/batch
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// BatchEndpoints lists the endpoints a batch can run against
+var BatchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+type Batch struct {
+	Id      string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Object  string `json:"object" gorm:"-"`
+	UserId  int    `json:"-" gorm:"index"`
+	TokenId int    `json:"-" gorm:"index"`
+	// ClientIp is the address the batch was created from, its requests are made from it so
+	// that tokens restricted to a subnet keep working
+	ClientIp         string             `json:"-" gorm:"type:varchar(64);default:''"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           *BatchErrors       `json:"errors" gorm:"type:text;serializer:json"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status" gorm:"type:varchar(32);index"`
+	OutputFileId     *string            `json:"output_file_id"`
+	ErrorFileId      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     *int64             `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64              `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     *int64             `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      *int64             `json:"completed_at" gorm:"bigint"`
+	FailedAt         *int64             `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        *int64             `json:"expired_at" gorm:"bigint"`
+	CancellingAt     *int64             `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      *int64             `json:"cancelled_at" gorm:"bigint"`
+	RequestCounts    BatchRequestCounts `json:"request_counts" gorm:"embedded;embeddedPrefix:request_counts_"`
+	Metadata         map[string]string  `json:"metadata" gorm:"type:text;serializer:json"`
+}
+
+func (batch *Batch) AfterFind(_ *gorm.DB) error {
+	batch.Object = "batch"
+	return nil
+}
+
+func CreateBatch(batch *Batch) error {
+	batch.Id = "batch_" + random.GetRandomString(24)
+	batch.Object = "batch"
+	batch.Status = BatchStatusValidating
+	batch.CreatedAt = helper.GetTimestamp()
+	return DB.Create(batch).Error
+}
+
+func GetBatchById(id string, userId int) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id is empty")
+	}
+	batch := Batch{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&batch).Error
+	return &batch, err
+}
+
+// GetUserBatches lists batches newest first, after is the id of the last batch of the previous page
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		afterBatch, err := GetBatchById(after, userId)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", afterBatch.CreatedAt, afterBatch.CreatedAt, afterBatch.Id)
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetPendingBatches returns batches waiting for a worker, oldest first
+func GetPendingBatches(limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ?", BatchStatusValidating).Order("created_at asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// ClaimBatch applies the non-zero fields of updates if the batch still has fromStatus,
+// it returns false if another node or request changed the status first
+func ClaimBatch(batch *Batch, fromStatus string, updates *Batch) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, fromStatus).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	batch.Status = updates.Status
+	return true, nil
+}
+
+func GetBatchStatus(id string) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+func UpdateBatchRequestCounts(id string, counts BatchRequestCounts) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(map[string]any{
+		"request_counts_total":     counts.Total,
+		"request_counts_completed": counts.Completed,
+		"request_counts_failed":    counts.Failed,
+	}).Error
+}
+
+// FailInterruptedBatches marks batches left running by a previous process as failed,
+// executing them again would bill the finished requests twice
+func FailInterruptedBatches() (int64, error) {
+	now := helper.GetTimestamp()
+	errs := &BatchErrors{
+		Object: "list",
+		Data: []BatchError{{
+			Code:    "batch_interrupted",
+			Message: "the batch was interrupted by a server restart",
+		}},
+	}
+	result := DB.Model(&Batch{}).
+		Where("status IN ?", []string{BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}).
+		Updates(&Batch{Status: BatchStatusFailed, FailedAt: &now, Errors: errs})
+	return result.RowsAffected, result.Error
+}
@@ -8,8 +8,7 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
-	"github.com/songquanpeng/one-api/common/random"
-	"math/rand"
+	"github.com/songquanpeng/one-api/relay/limit"
 	"sort"
 	"strconv"
 	"strings"
@@ -73,6 +72,48 @@ func CacheGetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+// CacheGetUserRateLimits returns the rate limits of the user, see User.GetRateLimits
+func CacheGetUserRateLimits(id int) (limits limit.RateLimits, err error) {
+	if !common.RedisEnabled {
+		user, err := GetUserRateLimitSettings(id)
+		if err != nil {
+			return limits, err
+		}
+		return user.GetRateLimits(), nil
+	}
+	var user *User
+	userString, err := common.RedisGet(fmt.Sprintf("user_rate_limits:%d", id))
+	if err == nil {
+		user = &User{}
+		err = json.Unmarshal([]byte(userString), user)
+	}
+	if err != nil {
+		user, err = GetUserRateLimitSettings(id)
+		if err != nil {
+			return limits, err
+		}
+		jsonBytes, err := json.Marshal(user)
+		if err != nil {
+			return limits, err
+		}
+		err = common.RedisSet(fmt.Sprintf("user_rate_limits:%d", id), string(jsonBytes), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+		if err != nil {
+			logger.SysError("Redis set user rate limits error: " + err.Error())
+		}
+	}
+	return user.GetRateLimits(), nil
+}
+
+// CacheDeleteUserRateLimits drops the cached rate limits of the user once they are edited
+func CacheDeleteUserRateLimits(id int) {
+	if !common.RedisEnabled {
+		return
+	}
+	if err := common.RedisDel(fmt.Sprintf("user_rate_limits:%d", id)); err != nil {
+		logger.SysError("Redis delete user rate limits error: " + err.Error())
+	}
+}
+
 func fetchAndUpdateUserQuota(ctx context.Context, id int) (quota int64, err error) {
 	quota, err = GetUserQuota(id)
 	if err != nil {
@@ -168,20 +209,36 @@ func CacheGetGroupModels(ctx context.Context, group string) ([]string, error) {
 }
 
 var group2model2channels map[string]map[string][]*Channel
+
+// group2model2weights holds the weights of the channels of group2model2channels, in the same order
+var group2model2weights map[string]map[string][]uint
 var channelSyncLock sync.RWMutex
 
+// abilityKey identifies the ability of a channel for a group and model
+type abilityKey struct {
+	group     string
+	model     string
+	channelId int
+}
+
 func InitChannelCache() {
 	newChannelId2channel := make(map[int]*Channel)
 	var channels []*Channel
 	DB.Where("status = ?", ChannelStatusEnabled).Find(&channels)
 	for _, channel := range channels {
 		newChannelId2channel[channel.Id] = channel
+		limits := channel.GetLimits()
+		channel.limits = &limits
 	}
 	var abilities []*Ability
 	DB.Find(&abilities)
 	groups := make(map[string]bool)
+	weightOverrides := make(map[abilityKey]uint)
 	for _, ability := range abilities {
 		groups[ability.Group] = true
+		if ability.Weight != nil {
+			weightOverrides[abilityKey{ability.Group, ability.Model, ability.ChannelId}] = *ability.Weight
+		}
 	}
 	newGroup2model2channels := make(map[string]map[string][]*Channel)
 	for group := range groups {
@@ -201,17 +258,29 @@ func InitChannelCache() {
 	}
 
 	// sort by priority
+	newGroup2model2weights := make(map[string]map[string][]uint)
 	for group, model2channels := range newGroup2model2channels {
+		newGroup2model2weights[group] = make(map[string][]uint)
 		for model, channels := range model2channels {
 			sort.Slice(channels, func(i, j int) bool {
 				return channels[i].GetPriority() > channels[j].GetPriority()
 			})
 			newGroup2model2channels[group][model] = channels
+			weights := make([]uint, len(channels))
+			for i, channel := range channels {
+				weight, ok := weightOverrides[abilityKey{group, model, channel.Id}]
+				if !ok {
+					weight = channel.GetWeight()
+				}
+				weights[i] = weight
+			}
+			newGroup2model2weights[group][model] = weights
 		}
 	}
 
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
+	group2model2weights = newGroup2model2weights
 	channelSyncLock.Unlock()
 	logger.SysLog("channels synced from database")
 }
@@ -224,32 +293,52 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, error) {
+// CacheGetRandomSatisfiedChannel picks a channel for the model along with the lease which
+// counts the request against its limits, to be released once the request is over
+func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPriority bool) (*Channel, *limit.Lease, error) {
 	if !config.MemoryCacheEnabled {
 		return GetRandomSatisfiedChannel(group, model, ignoreFirstPriority)
 	}
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
-	channels := group2model2channels[group][model]
-	if len(channels) == 0 {
-		return nil, errors.New("channel not found")
-	}
-	endIdx := len(channels)
-	// choose by priority
-	firstChannel := channels[0]
-	if firstChannel.GetPriority() > 0 {
-		for i := range channels {
-			if channels[i].GetPriority() != firstChannel.GetPriority() {
-				endIdx = i
-				break
+	if len(group2model2channels[group][model]) == 0 {
+		return nil, nil, errors.New("channel not found")
+	}
+	// the channels found at their limits or whose probe was taken meanwhile
+	skipped := make(map[int]bool)
+	var saturated bool
+	for {
+		// the channels whose circuit breaker is open or which are at their limits are left
+		// out, lower priorities take over
+		channels, weights := availableChannels(model, group2model2channels[group][model], group2model2weights[group][model], skipped)
+		if len(channels) == 0 && saturated {
+			return nil, nil, ErrChannelsSaturated
+		}
+		if len(channels) == 0 {
+			return nil, nil, errors.New("circuit breakers of all channels are open")
+		}
+		endIdx := len(channels)
+		// choose by priority
+		firstChannel := channels[0]
+		if firstChannel.GetPriority() > 0 {
+			for i := range channels {
+				if channels[i].GetPriority() != firstChannel.GetPriority() {
+					endIdx = i
+					break
+				}
 			}
 		}
-	}
-	idx := rand.Intn(endIdx)
-	if ignoreFirstPriority {
-		if endIdx < len(channels) { // which means there are more than one priority
-			idx = random.RandRange(endIdx, len(channels))
+		idx := pickChannel(group, model, channels[:endIdx], weights[:endIdx])
+		if ignoreFirstPriority {
+			if endIdx < len(channels) { // which means there are more than one priority
+				idx = endIdx + pickChannel(group, model, channels[endIdx:], weights[endIdx:])
+			}
+		}
+		lease, err := acquireChannel(channels[idx], model)
+		if err == nil {
+			return channels[idx], lease, nil
 		}
+		skipped[channels[idx].Id] = true
+		saturated = saturated || errors.Is(err, ErrChannelsSaturated)
 	}
-	return channels[idx], nil
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/limit"
 	"gorm.io/gorm"
 )
 
@@ -38,6 +39,8 @@ type Channel struct {
 	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
 	Config             string  `json:"config"`
 	SystemPrompt       *string `json:"system_prompt" gorm:"type:text"`
+	// limits are parsed from the config once for the channels of the cache
+	limits *limit.Limits
 }
 
 type ChannelConfig struct {
@@ -50,6 +53,10 @@ type ChannelConfig struct {
 	Plugin            string `json:"plugin,omitempty"`
 	VertexAIProjectID string `json:"vertex_ai_project_id,omitempty"`
 	VertexAIADC       string `json:"vertex_ai_adc,omitempty"`
+	// limits of the upstream account, the channel is skipped while it is at one of them
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	RPM            int `json:"rpm,omitempty"`
+	TPM            int `json:"tpm,omitempty"`
 }
 
 func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
@@ -104,6 +111,13 @@ func (channel *Channel) GetPriority() int64 {
 	return *channel.Priority
 }
 
+func (channel *Channel) GetWeight() uint {
+	if channel.Weight == nil {
+		return 0
+	}
+	return *channel.Weight
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -187,6 +201,19 @@ func (channel *Channel) LoadConfig() (ChannelConfig, error) {
 	return cfg, nil
 }
 
+// GetLimits returns the concurrency, RPM and TPM limits of the channel
+func (channel *Channel) GetLimits() limit.Limits {
+	if channel.limits != nil {
+		return *channel.limits
+	}
+	cfg, _ := channel.LoadConfig()
+	return limit.Limits{
+		Concurrency: cfg.MaxConcurrency,
+		RPM:         cfg.RPM,
+		TPM:         cfg.TPM,
+	}
+}
+
 func UpdateChannelStatusById(id int, status int) {
 	err := UpdateAbilityStatus(id, status == ChannelStatusEnabled)
 	if err != nil {
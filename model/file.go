@@ -0,0 +1,150 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/storage"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+// FilePurposes lists the purposes a client may upload a file for
+var FilePurposes = map[string]bool{
+	"assistants":     true,
+	FilePurposeBatch: true,
+	"fine-tune":      true,
+	"vision":         true,
+	"user_data":      true,
+	"evals":          true,
+}
+
+type File struct {
+	Id        string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	Object    string `json:"object" gorm:"-"`
+	UserId    int    `json:"-" gorm:"index"`
+	TokenId   int    `json:"-" gorm:"index"`
+	Bytes     int64  `json:"bytes" gorm:"bigint"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose" gorm:"type:varchar(32);index"`
+	Status    string `json:"status" gorm:"-"`
+}
+
+func (file *File) fillResponseFields() {
+	file.Object = "file"
+	file.Status = "processed"
+}
+
+func (file *File) storageKey() string {
+	return fmt.Sprintf("%d/%s", file.UserId, file.Id)
+}
+
+// CreateFile stores the content and records its metadata. Bytes should hold the
+// expected size for the storage limit check, it is replaced by the stored size.
+func CreateFile(file *File, content io.Reader) error {
+	file.Id = "file-" + random.GetRandomString(24)
+	file.CreatedAt = helper.GetTimestamp()
+	if config.UserFileStorageLimit > 0 {
+		used, err := GetUserFileBytes(file.UserId)
+		if err != nil {
+			return err
+		}
+		if used+file.Bytes > config.UserFileStorageLimit {
+			return fmt.Errorf("file storage limit exceeded, %s of %s used",
+				helper.Bytes2Size(used), helper.Bytes2Size(config.UserFileStorageLimit))
+		}
+	}
+	written, err := storage.Default.Put(file.storageKey(), content)
+	if err != nil {
+		return fmt.Errorf("store file failed: %w", err)
+	}
+	file.Bytes = written
+	if err = DB.Create(file).Error; err != nil {
+		_ = storage.Default.Delete(file.storageKey())
+		return err
+	}
+	if config.UserFileStorageLimit > 0 {
+		// concurrent uploads may all have passed the check above, they are checked again
+		// once recorded so that the limit holds
+		used, err := GetUserFileBytes(file.UserId)
+		if err == nil && used > config.UserFileStorageLimit {
+			_ = file.Delete()
+			return fmt.Errorf("file storage limit exceeded, %s of %s used",
+				helper.Bytes2Size(used-file.Bytes), helper.Bytes2Size(config.UserFileStorageLimit))
+		}
+	}
+	file.fillResponseFields()
+	return nil
+}
+
+// fileScope restricts queries to the files visible to the user, or to the token when isolated
+func fileScope(userId int, tokenId int) map[string]any {
+	scope := map[string]any{"user_id": userId}
+	if config.FileIsolationByToken && tokenId != 0 {
+		scope["token_id"] = tokenId
+	}
+	return scope
+}
+
+func GetFileById(id string, userId int, tokenId int) (*File, error) {
+	if id == "" {
+		return nil, errors.New("id is empty")
+	}
+	file := File{}
+	err := DB.Where(fileScope(userId, tokenId)).Where("id = ?", id).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	file.fillResponseFields()
+	return &file, nil
+}
+
+// GetUserFiles lists files newest first, after is the id of the last file of the previous page
+func GetUserFiles(userId int, tokenId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where(fileScope(userId, tokenId))
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		afterFile, err := GetFileById(after, userId, tokenId)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", afterFile.CreatedAt, afterFile.CreatedAt, afterFile.Id)
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	for _, file := range files {
+		file.fillResponseFields()
+	}
+	return files, err
+}
+
+func GetUserFileBytes(userId int) (int64, error) {
+	var used int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Scan(&used).Error
+	return used, err
+}
+
+func (file *File) Open() (io.ReadCloser, error) {
+	return storage.Default.Get(file.storageKey())
+}
+
+func (file *File) Delete() error {
+	if err := DB.Delete(file).Error; err != nil {
+		return err
+	}
+	if err := storage.Default.Delete(file.storageKey()); err != nil {
+		logger.SysError(fmt.Sprintf("failed to delete content of file %s: %s", file.Id, err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/storage"
+)
+
+func TestCreateFileStorageLimit(t *testing.T) {
+	sqlitePath, redisEnabled := common.SQLitePath, common.RedisEnabled
+	fileStoragePath, userFileStorageLimit := config.FileStoragePath, config.UserFileStorageLimit
+	defer func() {
+		common.SQLitePath, common.RedisEnabled = sqlitePath, redisEnabled
+		config.FileStoragePath, config.UserFileStorageLimit = fileStoragePath, userFileStorageLimit
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	config.FileStoragePath = t.TempDir()
+	InitDB()
+	storage.Init()
+	config.UserFileStorageLimit = 100
+
+	// concurrent uploads all pass the check made before they are stored
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = CreateFile(&File{UserId: 1, Bytes: 1, Filename: "a", Purpose: FilePurposeBatch}, strings.NewReader(strings.Repeat("a", 40)))
+		}()
+	}
+	wg.Wait()
+	used, err := GetUserFileBytes(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used > config.UserFileStorageLimit {
+		t.Errorf("storage limit should hold under concurrent uploads, %d bytes used", used)
+	}
+}
@@ -0,0 +1,214 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
+)
+
+const (
+	IdempotencyStatusProcessing = 1
+	IdempotencyStatusCompleted  = 2
+)
+
+// IdempotencyRecord remembers a request sent with an Idempotency-Key and its response,
+// it is kept in Redis when enabled, otherwise in the database with the response body
+// in the blob store
+type IdempotencyRecord struct {
+	Key         string `json:"key" gorm:"type:varchar(320);primaryKey"`
+	Fingerprint string `json:"fingerprint" gorm:"type:char(64)"`
+	Status      int    `json:"status"`
+	StatusCode  int    `json:"status_code" gorm:"default:0"`
+	ContentType string `json:"content_type" gorm:"default:''"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"`
+	Body        []byte `json:"body,omitempty" gorm:"-"`
+}
+
+func idempotencyRedisKey(key string) string {
+	return "idempotency:" + key
+}
+
+func (record *IdempotencyRecord) storageKey() string {
+	hash := sha256.Sum256([]byte(record.Key))
+	return "idempotency/" + hex.EncodeToString(hash[:])
+}
+
+// CreateIdempotencyRecord claims the key for a request until the lease is over, when the
+// key is already taken the existing record is returned with false. The lease is renewed
+// while the request runs, so that the key of a request whose node died is soon released.
+func CreateIdempotencyRecord(key string, fingerprint string, lease int) (*IdempotencyRecord, bool, error) {
+	return createIdempotencyRecord(key, fingerprint, lease, true)
+}
+
+func createIdempotencyRecord(key string, fingerprint string, lease int, retry bool) (*IdempotencyRecord, bool, error) {
+	record := &IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      IdempotencyStatusProcessing,
+		ExpiresAt:   helper.GetTimestamp() + int64(lease),
+	}
+	var err error
+	if common.RedisEnabled {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return nil, false, err
+		}
+		created, err := common.RDB.SetNX(context.Background(), idempotencyRedisKey(key), value, time.Duration(lease)*time.Second).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if created {
+			return record, true, nil
+		}
+	} else {
+		result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if err = result.Error; err != nil {
+			return nil, false, err
+		}
+		if result.RowsAffected == 1 {
+			return record, true, nil
+		}
+	}
+	existing, err := GetIdempotencyRecord(key)
+	if err != nil || existing != nil {
+		return existing, false, err
+	}
+	if !retry {
+		// another request claimed the key since it was found expired, its record is
+		// not readable yet
+		record.Status = IdempotencyStatusProcessing
+		return record, false, nil
+	}
+	// the record expired or was released in the meantime, an expired record is removed
+	// unless another request has claimed the key since
+	if !common.RedisEnabled {
+		if _, err = deleteExpiredIdempotencyRecord(key); err != nil {
+			return nil, false, err
+		}
+	}
+	return createIdempotencyRecord(key, fingerprint, lease, false)
+}
+
+// GetIdempotencyRecord returns the record of the key with its body, nil if there is none
+func GetIdempotencyRecord(key string) (*IdempotencyRecord, error) {
+	record := &IdempotencyRecord{}
+	if common.RedisEnabled {
+		value, err := common.RedisGet(idempotencyRedisKey(key))
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return record, json.Unmarshal([]byte(value), record)
+	}
+	err := DB.Where(&IdempotencyRecord{Key: key}).Limit(1).Find(record).Error
+	if err != nil {
+		return nil, err
+	}
+	if record.Key == "" || record.ExpiresAt < helper.GetTimestamp() {
+		return nil, nil
+	}
+	if record.Status == IdempotencyStatusCompleted {
+		content, err := storage.Default.Get(record.storageKey())
+		if err != nil {
+			return nil, fmt.Errorf("read response failed: %w", err)
+		}
+		defer content.Close()
+		if record.Body, err = io.ReadAll(content); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// RenewIdempotencyRecord extends the lease of the request in flight with the key
+func RenewIdempotencyRecord(key string, lease int) error {
+	if common.RedisEnabled {
+		return common.RDB.Expire(context.Background(), idempotencyRedisKey(key), time.Duration(lease)*time.Second).Err()
+	}
+	return DB.Model(&IdempotencyRecord{Key: key}).
+		Where("status = ?", IdempotencyStatusProcessing).
+		Update("expires_at", helper.GetTimestamp()+int64(lease)).Error
+}
+
+// CompleteIdempotencyRecord stores the response of the request, which is kept for the ttl
+func CompleteIdempotencyRecord(record *IdempotencyRecord, statusCode int, contentType string, body []byte, ttl int) error {
+	record.Status = IdempotencyStatusCompleted
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.ExpiresAt = helper.GetTimestamp() + int64(ttl)
+	record.Body = body
+	if common.RedisEnabled {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return common.RDB.Set(context.Background(), idempotencyRedisKey(record.Key), value, time.Duration(ttl)*time.Second).Err()
+	}
+	if _, err := storage.Default.Put(record.storageKey(), bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("store response failed: %w", err)
+	}
+	return DB.Model(record).Select("status", "status_code", "content_type", "expires_at").Updates(record).Error
+}
+
+// DeleteIdempotencyRecord releases the key so that the request can be retried
+func DeleteIdempotencyRecord(key string) error {
+	if common.RedisEnabled {
+		return common.RedisDel(idempotencyRedisKey(key))
+	}
+	record := &IdempotencyRecord{Key: key}
+	if err := DB.Delete(record).Error; err != nil {
+		return err
+	}
+	_ = storage.Default.Delete(record.storageKey())
+	return nil
+}
+
+// deleteExpiredIdempotencyRecord deletes the record of the key if it is expired, it
+// reports whether there was one
+func deleteExpiredIdempotencyRecord(key string) (bool, error) {
+	record := &IdempotencyRecord{Key: key}
+	result := DB.Where("expires_at < ?", helper.GetTimestamp()).Delete(record)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	_ = storage.Default.Delete(record.storageKey())
+	return true, nil
+}
+
+// CleanExpiredIdempotencyRecords deletes the expired records of the database periodically,
+// Redis expires its records by itself
+func CleanExpiredIdempotencyRecords(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		if common.RedisEnabled {
+			continue
+		}
+		var records []*IdempotencyRecord
+		err := DB.Where("expires_at < ?", helper.GetTimestamp()).Limit(1000).Find(&records).Error
+		if err != nil {
+			logger.SysError("failed to get expired idempotency records: " + err.Error())
+			continue
+		}
+		for _, record := range records {
+			if _, err = deleteExpiredIdempotencyRecord(record.Key); err != nil {
+				logger.SysError("failed to delete idempotency record: " + err.Error())
+			}
+		}
+	}
+}
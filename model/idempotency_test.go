@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/storage"
+)
+
+func TestCreateIdempotencyRecordExpired(t *testing.T) {
+	sqlitePath, redisEnabled, fileStoragePath := common.SQLitePath, common.RedisEnabled, config.FileStoragePath
+	defer func() {
+		common.SQLitePath, common.RedisEnabled, config.FileStoragePath = sqlitePath, redisEnabled, fileStoragePath
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	config.FileStoragePath = t.TempDir()
+	InitDB()
+	storage.Init()
+
+	expired := &IdempotencyRecord{Key: "1:key", Fingerprint: "a", Status: IdempotencyStatusProcessing, ExpiresAt: helper.GetTimestamp() - 1}
+	if err := DB.Create(expired).Error; err != nil {
+		t.Fatal(err)
+	}
+	// a retry claims the key of the expired record
+	record, created, err := CreateIdempotencyRecord("1:key", "b", 30)
+	if err != nil || !created || record.Fingerprint != "b" {
+		t.Fatalf("the key of an expired record should be claimed, got %+v %v %v", record, created, err)
+	}
+
+	// a concurrent retry, which also found the record expired, leaves the new claim alone
+	if deleted, err := deleteExpiredIdempotencyRecord("1:key"); err != nil || deleted {
+		t.Errorf("the record claimed since should not be deleted, got %v %v", deleted, err)
+	}
+	record, created, err = createIdempotencyRecord("1:key", "c", 30, false)
+	if err != nil || created || record.Fingerprint != "b" {
+		t.Errorf("the key should be taken by the first retry, got %+v %v %v", record, created, err)
+	}
+	var count int64
+	DB.Model(&IdempotencyRecord{}).Where("`key` = ?", "1:key").Count(&count)
+	if count != 1 {
+		t.Errorf("the key should be claimed once, got %d records", count)
+	}
+}
@@ -185,6 +185,18 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Channel{}); err != nil {
 		return err
 	}
+	if err = DB.AutoMigrate(&File{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Batch{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&Response{}); err != nil {
+		return err
+	}
+	if err = DB.AutoMigrate(&IdempotencyRecord{}); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -4,6 +4,11 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/capability"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/limit"
+	"github.com/songquanpeng/one-api/relay/routing"
+	"github.com/songquanpeng/one-api/relay/truncation"
 	"strconv"
 	"strings"
 	"time"
@@ -70,10 +75,21 @@ func InitOptionMap() {
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["ModelCapabilities"] = capability.ModelCapabilities2JSONString()
+	config.OptionMap["GroupContextStrategy"] = truncation.GroupContextStrategy2JSONString()
+	config.OptionMap["GroupHedgeDelay"] = hedge.GroupHedgeDelay2JSONString()
+	config.OptionMap["ModelHedgeDelay"] = hedge.ModelHedgeDelay2JSONString()
+	config.OptionMap["ChannelRoutingStrategy"] = routing.ChannelRoutingStrategy
+	config.OptionMap["GroupRoutingStrategy"] = routing.GroupRoutingStrategy2JSONString()
+	config.OptionMap["GroupRateLimits"] = limit.GroupRateLimits2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["BatchDiscountRatio"] = strconv.FormatFloat(config.BatchDiscountRatio, 'f', -1, 64)
+	config.OptionMap["ResponseCacheEnabled"] = strconv.FormatBool(config.ResponseCacheEnabled)
+	config.OptionMap["StreamFailoverEnabled"] = strconv.FormatBool(config.StreamFailoverEnabled)
+	config.OptionMap["ResponseCacheRatio"] = strconv.FormatFloat(config.ResponseCacheRatio, 'f', -1, 64)
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -153,6 +169,10 @@ func updateOptionMap(key string, value string) (err error) {
 			config.DisplayInCurrencyEnabled = boolValue
 		case "DisplayTokenStatEnabled":
 			config.DisplayTokenStatEnabled = boolValue
+		case "ResponseCacheEnabled":
+			config.ResponseCacheEnabled = boolValue
+		case "StreamFailoverEnabled":
+			config.StreamFailoverEnabled = boolValue
 		}
 	}
 	switch key {
@@ -229,6 +249,20 @@ func updateOptionMap(key string, value string) (err error) {
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "ModelCapabilities":
+		err = capability.UpdateModelCapabilitiesByJSONString(value)
+	case "GroupContextStrategy":
+		err = truncation.UpdateGroupContextStrategyByJSONString(value)
+	case "GroupHedgeDelay":
+		err = hedge.UpdateGroupHedgeDelayByJSONString(value)
+	case "ModelHedgeDelay":
+		err = hedge.UpdateModelHedgeDelayByJSONString(value)
+	case "ChannelRoutingStrategy":
+		err = routing.UpdateChannelRoutingStrategy(value)
+	case "GroupRoutingStrategy":
+		err = routing.UpdateGroupRoutingStrategyByJSONString(value)
+	case "GroupRateLimits":
+		err = limit.UpdateGroupRateLimitsByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
@@ -237,6 +271,10 @@ func updateOptionMap(key string, value string) (err error) {
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
 		config.QuotaPerUnit, _ = strconv.ParseFloat(value, 64)
+	case "BatchDiscountRatio":
+		config.BatchDiscountRatio, _ = strconv.ParseFloat(value, 64)
+	case "ResponseCacheRatio":
+		config.ResponseCacheRatio, _ = strconv.ParseFloat(value, 64)
 	case "Theme":
 		config.Theme = value
 	}
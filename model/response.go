@@ -0,0 +1,61 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/storage"
+)
+
+// Response records a stored Responses API result, the conversation turn itself
+// is kept in the blob store because it can grow beyond what a text column holds
+type Response struct {
+	Id                 string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64);default:''"`
+	Model              string `json:"model"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (response *Response) storageKey() string {
+	return fmt.Sprintf("responses/%d/%s.json", response.UserId, response.Id)
+}
+
+func CreateResponse(response *Response, content io.Reader) error {
+	response.CreatedAt = helper.GetTimestamp()
+	if _, err := storage.Default.Put(response.storageKey(), content); err != nil {
+		return fmt.Errorf("store response failed: %w", err)
+	}
+	if err := DB.Create(response).Error; err != nil {
+		_ = storage.Default.Delete(response.storageKey())
+		return err
+	}
+	return nil
+}
+
+func GetResponseById(id string, userId int) (*Response, error) {
+	if id == "" {
+		return nil, errors.New("id is empty")
+	}
+	response := Response{}
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&response).Error
+	return &response, err
+}
+
+func (response *Response) Open() (io.ReadCloser, error) {
+	return storage.Default.Get(response.storageKey())
+}
+
+func (response *Response) Delete() error {
+	if err := DB.Delete(response).Error; err != nil {
+		return err
+	}
+	if err := storage.Default.Delete(response.storageKey()); err != nil {
+		logger.SysError(fmt.Sprintf("failed to delete content of response %s: %s", response.Id, err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// responseCacheEntry is a response cached in memory
+type responseCacheEntry struct {
+	key        string
+	value      string
+	expiration time.Time
+}
+
+// responseLRU keeps relay responses in memory when Redis is disabled, the least recently
+// used ones are evicted once they take more than config.ResponseCacheMemoryLimit bytes
+type responseLRU struct {
+	mu sync.Mutex
+	// order has the most recently used entry at the front
+	order *list.List
+	items map[string]*list.Element
+	size  int
+}
+
+func newResponseLRU() *responseLRU {
+	return &responseLRU{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *responseLRU) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := element.Value.(*responseCacheEntry)
+	if time.Now().After(entry.expiration) {
+		c.remove(element)
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *responseLRU) set(key string, value string, ttl int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+	if len(value) > config.ResponseCacheMemoryLimit {
+		return
+	}
+	entry := &responseCacheEntry{key: key, value: value, expiration: time.Now().Add(time.Duration(ttl) * time.Second)}
+	c.items[key] = c.order.PushFront(entry)
+	c.size += len(value)
+	for c.size > config.ResponseCacheMemoryLimit {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *responseLRU) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*responseCacheEntry)
+	delete(c.items, entry.key)
+	c.size -= len(entry.value)
+}
+
+// cleanup removes the expired entries
+func (c *responseLRU) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if now.After(element.Value.(*responseCacheEntry).expiration) {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+var responseCache = newResponseLRU()
+var responseCacheCleanupOnce sync.Once
+
+// CacheGetResponse returns a response stored by CacheSetResponse, false when there is none
+func CacheGetResponse(key string) (string, bool) {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				logger.SysError("failed to get cached response: " + err.Error())
+			}
+			return "", false
+		}
+		return value, true
+	}
+	return responseCache.get(key)
+}
+
+// CacheSetResponse stores a response in Redis, or in memory when Redis is disabled
+func CacheSetResponse(key string, value string, ttl int) {
+	if common.RedisEnabled {
+		if err := common.RedisSet(key, value, time.Duration(ttl)*time.Second); err != nil {
+			logger.SysError("failed to cache response: " + err.Error())
+		}
+		return
+	}
+	responseCacheCleanupOnce.Do(func() {
+		go func() {
+			for range time.Tick(time.Minute) {
+				responseCache.cleanup()
+			}
+		}()
+	})
+	responseCache.set(key, value, ttl)
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestResponseLRU(t *testing.T) {
+	memoryLimit := config.ResponseCacheMemoryLimit
+	defer func() {
+		config.ResponseCacheMemoryLimit = memoryLimit
+	}()
+	config.ResponseCacheMemoryLimit = 30
+	cache := newResponseLRU()
+
+	cache.set("a", strings.Repeat("a", 10), 60)
+	cache.set("b", strings.Repeat("b", 10), 60)
+	cache.set("c", strings.Repeat("c", 10), 60)
+	// reading a makes b the least recently used
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	cache.set("d", strings.Repeat("d", 10), 60)
+	if _, ok := cache.get("b"); ok {
+		t.Error("the least recently used response should be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s should be cached", key)
+		}
+	}
+	if cache.size != 30 || len(cache.items) != 3 {
+		t.Errorf("cache should hold 30 bytes in 3 entries, got %d in %d", cache.size, len(cache.items))
+	}
+
+	cache.set("a", strings.Repeat("a", 5), 60)
+	if value, _ := cache.get("a"); value != "aaaaa" || cache.size != 25 {
+		t.Errorf("replaced response should be counted once, got %q and %d bytes", value, cache.size)
+	}
+	cache.set("e", strings.Repeat("e", 31), 60)
+	if _, ok := cache.get("e"); ok || cache.size != 25 {
+		t.Error("response beyond the memory limit should not be cached")
+	}
+
+	cache.set("f", "f", -1)
+	if _, ok := cache.get("f"); ok {
+		t.Error("expired response should not be returned")
+	}
+	cache.set("g", "g", -1)
+	cache.cleanup()
+	if _, ok := cache.items["g"]; ok || cache.size != 25 {
+		t.Errorf("cleanup should remove expired responses, %d bytes left", cache.size)
+	}
+}
@@ -34,6 +34,12 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"type:text"`            // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	// ContextStrategy overrides the context truncation strategy of the group, e.g. drop_oldest
+	ContextStrategy string `json:"context_strategy" gorm:"default:''"`
+	// rate limits of the token, zero is unlimited, the ones of its user apply as well
+	RPM int `json:"rpm" gorm:"default:0"`
+	TPM int `json:"tpm" gorm:"default:0"`
+	RPD int `json:"rpd" gorm:"default:0"`
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -132,7 +138,7 @@ func (t *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (t *Token) Update() error {
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "context_strategy", "rpm", "tpm", "rpd").Updates(t).Error
 	return err
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/limit"
 )
 
 const (
@@ -51,6 +52,11 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	// rate limits of the user across its tokens, zero is unlimited and the ones not set come from the
+	// group, Update resets the negative ones to the group
+	RPM *int `json:"rpm"`
+	TPM *int `json:"tpm"`
+	RPD *int `json:"rpd"`
 }
 
 func GetMaxUserId() int {
@@ -177,7 +183,21 @@ func (user *User) Update(updatePassword bool) error {
 	} else if user.Status == UserStatusEnabled {
 		blacklist.UnbanUser(user.Id)
 	}
+	// Updates leaves out nil fields, the rate limits going back to the group are cleared apart
+	cleared := map[string]any{}
+	for column, rateLimit := range map[string]**int{"rpm": &user.RPM, "tpm": &user.TPM, "rpd": &user.RPD} {
+		if *rateLimit != nil && **rateLimit < 0 {
+			cleared[column] = nil
+			*rateLimit = nil
+		}
+	}
 	err = DB.Model(user).Updates(user).Error
+	if err == nil && len(cleared) > 0 {
+		err = DB.Model(user).Updates(cleared).Error
+	}
+	if err == nil {
+		CacheDeleteUserRateLimits(user.Id)
+	}
 	return err
 }
 
@@ -361,6 +381,32 @@ func GetUserEmail(id int) (email string, err error) {
 	return email, err
 }
 
+// GetRateLimits returns the rate limits of the user, the ones it has not set come from its group
+func (user *User) GetRateLimits() limit.RateLimits {
+	limits := limit.GetGroupRateLimits(user.Group)
+	if user.RPM != nil {
+		limits.RPM = *user.RPM
+	}
+	if user.TPM != nil {
+		limits.TPM = *user.TPM
+	}
+	if user.RPD != nil {
+		limits.RPD = *user.RPD
+	}
+	return limits
+}
+
+// GetUserRateLimitSettings returns the user with only its group and rate limits
+func GetUserRateLimitSettings(id int) (user *User, err error) {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	user = &User{}
+	err = DB.Model(&User{}).Where("id = ?", id).Select("id", groupCol, "rpm", "tpm", "rpd").First(user).Error
+	return user, err
+}
+
 func GetUserGroup(id int) (group string, err error) {
 	groupCol := "`group`"
 	if common.UsingPostgreSQL {
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/relay/limit"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestUpdateUserRateLimits(t *testing.T) {
+	sqlitePath, redisEnabled := common.SQLitePath, common.RedisEnabled
+	defer func() {
+		common.SQLitePath, common.RedisEnabled = sqlitePath, redisEnabled
+		limit.GroupRateLimits = map[string]limit.RateLimits{}
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	InitDB()
+	if err := limit.UpdateGroupRateLimitsByJSONString(`{"default":{"rpm":60,"tpm":1000}}`); err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Id: 1, Username: "rate", Password: "12345678", Group: "default", Status: UserStatusEnabled, AffCode: "rate", AccessToken: "rate"}
+	if err := DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&User{Id: 1, RPM: intPtr(10), TPM: intPtr(0)}).Update(false); err != nil {
+		t.Fatal(err)
+	}
+	if limits, err := CacheGetUserRateLimits(1); err != nil || limits != (limit.RateLimits{RPM: 10}) {
+		t.Errorf("overrides should replace the limits of the group, got %+v, %v", limits, err)
+	}
+	// the limits left out of an update are kept
+	if err := (&User{Id: 1, RPD: intPtr(100)}).Update(false); err != nil {
+		t.Fatal(err)
+	}
+	if limits, _ := CacheGetUserRateLimits(1); limits != (limit.RateLimits{RPM: 10, RPD: 100}) {
+		t.Errorf("untouched overrides should be kept, got %+v", limits)
+	}
+	if err := (&User{Id: 1, RPM: intPtr(-1), TPM: intPtr(-1)}).Update(false); err != nil {
+		t.Fatal(err)
+	}
+	if limits, _ := CacheGetUserRateLimits(1); limits != (limit.RateLimits{RPM: 60, TPM: 1000, RPD: 100}) {
+		t.Errorf("negative overrides should go back to the group, got %+v", limits)
+	}
+}
@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/monitor/breaker"
+)
+
+// Emit records the outcome of a request relayed to a channel selected at selectedAt for a
+// model in its circuit breaker, the root user is notified when the breaker opens
+func Emit(channelId int, modelName string, selectedAt time.Time, success bool) {
+	if !config.CircuitBreakerEnabled {
+		return
+	}
+	go func() {
+		if opened, successRate := breaker.Record(channelId, modelName, selectedAt, success); opened {
+			notifyCircuitOpened(channelId, modelName, successRate)
+		}
+	}()
+}
@@ -0,0 +1,318 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// states of a breaker
+const (
+	// Closed lets every request through
+	Closed = "closed"
+	// Open rejects every request until the cool-down is over
+	Open = "open"
+	// HalfOpen lets a single probe request through, which closes the breaker when it succeeds
+	HalfOpen = "half_open"
+)
+
+// redisKey is the hash of the open breakers shared by the nodes, by channel id and model
+const redisKey = "circuit_breakers"
+const redisProbeKeyPrefix = "circuit_breaker_probe:"
+
+// Breaker is the circuit breaker of a channel for a model
+type Breaker struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+	State     string `json:"state"`
+	// SuccessRate is the success rate of the recent requests while the breaker was closed
+	SuccessRate float64 `json:"success_rate"`
+	// OpenedAt is when the breaker last opened, 0 when it is closed
+	OpenedAt int64 `json:"opened_at"`
+	window   []bool
+	// probeAt is when the probe of the half-open breaker was let through, it identifies the
+	// probe since no other request is let through after it
+	probeAt time.Time
+}
+
+type key struct {
+	channelId int
+	model     string
+}
+
+func (k key) String() string {
+	return fmt.Sprintf("%d:%s", k.channelId, k.model)
+}
+
+func parseKey(s string) (key, bool) {
+	channelId, model, found := strings.Cut(s, ":")
+	id, err := strconv.Atoi(channelId)
+	if !found || err != nil {
+		return key{}, false
+	}
+	return key{id, model}, true
+}
+
+// matches reports whether the key is the one of the channel for the model, or for any model when model is empty
+func (k key) matches(channelId int, model string) bool {
+	return k.channelId == channelId && (model == "" || k.model == model)
+}
+
+var lock sync.Mutex
+var breakers = map[key]*Breaker{}
+
+func cooldown() time.Duration {
+	return time.Duration(config.CircuitBreakerCooldown) * time.Second
+}
+
+// state returns the state of the breaker, an open breaker is half-open once the cool-down is over
+func (b *Breaker) state() string {
+	if b.OpenedAt == 0 {
+		return Closed
+	}
+	if time.Since(time.Unix(b.OpenedAt, 0)) < cooldown() {
+		return Open
+	}
+	return HalfOpen
+}
+
+// probing reports whether a probe is under way, a probe which never reported back is
+// given up after a cool-down
+func (b *Breaker) probing() bool {
+	return !b.probeAt.IsZero() && time.Since(b.probeAt) < cooldown()
+}
+
+func (b *Breaker) close() {
+	b.OpenedAt = 0
+	b.window = nil
+	b.probeAt = time.Time{}
+}
+
+// Available reports whether the breaker of the channel for the model would let a request through
+func Available(channelId int, model string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	b, ok := breakers[key{channelId, model}]
+	if !ok {
+		return true
+	}
+	switch b.state() {
+	case Closed:
+		return true
+	case Open:
+		return false
+	default:
+		return !b.probing()
+	}
+}
+
+// Acquire lets a request through the breaker of the channel for the model. A half-open
+// breaker is acquired by a single probe request, on any node when Redis is enabled.
+func Acquire(channelId int, model string) bool {
+	if !config.CircuitBreakerEnabled {
+		return true
+	}
+	k := key{channelId, model}
+	lock.Lock()
+	b, ok := breakers[k]
+	if !ok || b.state() == Closed {
+		lock.Unlock()
+		return true
+	}
+	if b.state() == Open || b.probing() {
+		lock.Unlock()
+		return false
+	}
+	// set even when another node wins the probe, so that this one waits for it
+	b.probeAt = time.Now()
+	lock.Unlock()
+	if !common.RedisEnabled {
+		return true
+	}
+	acquired, err := common.RDB.SetNX(context.Background(), redisProbeKeyPrefix+k.String(), time.Now().Unix(), cooldown()).Result()
+	if err != nil {
+		logger.SysError("failed to acquire circuit breaker probe: " + err.Error())
+		return true
+	}
+	return acquired
+}
+
+// Record records the outcome of a request relayed to the channel for the model, which
+// was let through the breaker at selectedAt. It returns true when the breaker opens, along
+// with the success rate which made it open.
+func Record(channelId int, model string, selectedAt time.Time, success bool) (opened bool, successRate float64) {
+	k := key{channelId, model}
+	lock.Lock()
+	b, ok := breakers[k]
+	if !ok {
+		b = &Breaker{ChannelId: channelId, Model: model, SuccessRate: 1}
+		breakers[k] = b
+	}
+	var changed bool
+	switch b.state() {
+	case Closed:
+		b.window = append(b.window, success)
+		if len(b.window) > config.CircuitBreakerWindowSize {
+			b.window = b.window[len(b.window)-config.CircuitBreakerWindowSize:]
+		}
+		successCount := 0
+		for _, success := range b.window {
+			if success {
+				successCount++
+			}
+		}
+		b.SuccessRate = float64(successCount) / float64(len(b.window))
+		if len(b.window) >= config.CircuitBreakerWindowSize && b.SuccessRate < config.CircuitBreakerSuccessRateThreshold {
+			b.OpenedAt = time.Now().Unix()
+			b.window = nil
+			opened, changed = true, true
+			logger.SysLog(fmt.Sprintf("circuit breaker of channel #%d for model %s opened, success rate %.2f%%", channelId, model, b.SuccessRate*100))
+		}
+	case Open:
+		// requests sent before the breaker opened tell nothing new
+	case HalfOpen:
+		// only the probe decides, it is the single request let through since probeAt
+		if b.probeAt.IsZero() || selectedAt.Before(b.probeAt) {
+			break
+		}
+		if success {
+			b.close()
+			b.SuccessRate = 1
+			logger.SysLog(fmt.Sprintf("circuit breaker of channel #%d for model %s closed", channelId, model))
+		} else {
+			b.OpenedAt = time.Now().Unix()
+			b.probeAt = time.Time{}
+		}
+		changed = true
+	}
+	openedAt := b.OpenedAt
+	successRate = b.SuccessRate
+	lock.Unlock()
+	if changed {
+		publish(k, openedAt)
+	}
+	return opened, successRate
+}
+
+// publish shares the state of a breaker with the other nodes
+func publish(k key, openedAt int64) {
+	if !common.RedisEnabled {
+		return
+	}
+	ctx := context.Background()
+	var err error
+	if openedAt == 0 {
+		err = common.RDB.HDel(ctx, redisKey, k.String()).Err()
+	} else {
+		err = common.RDB.HSet(ctx, redisKey, k.String(), openedAt).Err()
+	}
+	if err == nil {
+		err = common.RDB.Del(ctx, redisProbeKeyPrefix+k.String()).Err()
+	}
+	if err != nil {
+		logger.SysError("failed to publish circuit breaker: " + err.Error())
+	}
+}
+
+// Reset closes the breakers of the channel, for every model when model is empty
+func Reset(channelId int, model string) {
+	lock.Lock()
+	for k, b := range breakers {
+		if k.matches(channelId, model) {
+			b.close()
+			b.SuccessRate = 1
+		}
+	}
+	lock.Unlock()
+	if !common.RedisEnabled {
+		return
+	}
+	// the breakers may only be known to the other nodes
+	fields, err := common.RDB.HKeys(context.Background(), redisKey).Result()
+	if err != nil {
+		logger.SysError("failed to reset circuit breakers: " + err.Error())
+		return
+	}
+	for _, field := range fields {
+		if k, ok := parseKey(field); ok && k.matches(channelId, model) {
+			publish(k, 0)
+		}
+	}
+}
+
+// List returns the breakers which have seen requests, by channel and model
+func List() []Breaker {
+	lock.Lock()
+	defer lock.Unlock()
+	result := make([]Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		it := *b
+		it.State = b.state()
+		it.window = nil
+		result = append(result, it)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ChannelId != result[j].ChannelId {
+			return result[i].ChannelId < result[j].ChannelId
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
+
+// SyncFromRedis keeps the breakers of this node in line with the ones the other nodes opened or closed
+func SyncFromRedis(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		syncFromRedis()
+	}
+}
+
+func syncFromRedis() {
+	start := time.Now().Unix()
+	values, err := common.RDB.HGetAll(context.Background(), redisKey).Result()
+	if err != nil {
+		logger.SysError("failed to sync circuit breakers: " + err.Error())
+		return
+	}
+	shared := make(map[key]int64, len(values))
+	for field, value := range values {
+		k, ok := parseKey(field)
+		openedAt, err := strconv.ParseInt(value, 10, 64)
+		if ok && err == nil {
+			shared[k] = openedAt
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for k, b := range breakers {
+		if _, ok := shared[k]; !ok && b.OpenedAt != 0 && b.OpenedAt < start {
+			// closed by another node
+			b.close()
+			b.SuccessRate = 1
+		}
+	}
+	for k, openedAt := range shared {
+		b, ok := breakers[k]
+		if !ok {
+			b = &Breaker{ChannelId: k.channelId, Model: k.model}
+			breakers[k] = b
+		}
+		if b.OpenedAt < openedAt {
+			b.OpenedAt = openedAt
+			b.window = nil
+			b.probeAt = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func init() {
+	common.RedisEnabled = false
+}
+
+func TestBreaker(t *testing.T) {
+	enabled, windowSize, threshold := config.CircuitBreakerEnabled, config.CircuitBreakerWindowSize, config.CircuitBreakerSuccessRateThreshold
+	config.CircuitBreakerEnabled, config.CircuitBreakerWindowSize, config.CircuitBreakerSuccessRateThreshold = true, 4, 0.5
+	defer func() {
+		config.CircuitBreakerEnabled, config.CircuitBreakerWindowSize, config.CircuitBreakerSuccessRateThreshold = enabled, windowSize, threshold
+		breakers = map[key]*Breaker{}
+	}()
+	// moves the breaker to the end of its cool-down
+	expire := func() {
+		breakers[key{1, "gpt-4o"}].OpenedAt -= int64(config.CircuitBreakerCooldown)
+	}
+
+	for _, success := range []bool{false, true, false} {
+		if opened, _ := Record(1, "gpt-4o", time.Now(), success); opened {
+			t.Fatal("breaker should not open before the window is full")
+		}
+	}
+	if opened, successRate := Record(1, "gpt-4o", time.Now(), false); !opened || successRate != 0.25 {
+		t.Fatalf("breaker should open at success rate 0.25, got %v, %v", opened, successRate)
+	}
+	if Available(1, "gpt-4o") || Acquire(1, "gpt-4o") {
+		t.Fatal("open breaker should reject requests")
+	}
+	if !Available(1, "gpt-4o-mini") || !Available(2, "gpt-4o") {
+		t.Fatal("breakers of other models and channels should stay closed")
+	}
+
+	expire()
+	// a request sent before the breaker opened ends after the cool-down
+	selectedAt := time.Now()
+	if !Available(1, "gpt-4o") || !Acquire(1, "gpt-4o") {
+		t.Fatal("half-open breaker should let a probe through")
+	}
+	Record(1, "gpt-4o", selectedAt.Add(-time.Second), true)
+	if state := List()[0].State; state != HalfOpen {
+		t.Fatalf("only the probe should decide a half-open breaker, got %s", state)
+	}
+	if Available(1, "gpt-4o") || Acquire(1, "gpt-4o") {
+		t.Fatal("half-open breaker should let a single probe through")
+	}
+	Record(1, "gpt-4o", time.Now(), false)
+	if state := List()[0].State; state != Open {
+		t.Fatalf("failed probe should open the breaker again, got %s", state)
+	}
+
+	expire()
+	Acquire(1, "gpt-4o")
+	Record(1, "gpt-4o", time.Now(), true)
+	if state := List()[0].State; state != Closed || !Available(1, "gpt-4o") {
+		t.Fatalf("successful probe should close the breaker, got %s", state)
+	}
+
+	for i := 0; i < 4; i++ {
+		Record(1, "gpt-4o", time.Now(), false)
+	}
+	Reset(1, "")
+	if !Available(1, "gpt-4o") {
+		t.Error("reset should close the breaker")
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	config.CircuitBreakerEnabled = true
+	defer func() {
+		config.CircuitBreakerEnabled = false
+		breakers = map[key]*Breaker{}
+	}()
+	breakers[key{1, "gpt-4o"}] = &Breaker{ChannelId: 1, Model: "gpt-4o", OpenedAt: time.Now().Unix() - int64(config.CircuitBreakerCooldown)}
+	if !Acquire(1, "gpt-4o") {
+		t.Fatal("half-open breaker should let a probe through")
+	}
+	// the probe never reported back
+	breakers[key{1, "gpt-4o"}].probeAt = time.Now().Add(-cooldown())
+	if !Acquire(1, "gpt-4o") {
+		t.Error("lost probe should be given up after the cool-down")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/message"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor/breaker"
 )
 
 func notifyRootUser(subject string, content string) {
@@ -44,18 +45,17 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
-func MetricDisableChannel(channelId int, successRate float64) {
-	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
-	logger.SysLog(fmt.Sprintf("channel #%d has been disabled due to low success rate: %.2f", channelId, successRate*100))
+func notifyCircuitOpened(channelId int, modelName string, successRate float64) {
 	subject := fmt.Sprintf("channel status change notification")
 	content := message.EmailTemplate(
 		subject,
 		fmt.Sprintf(`
 			<p>Hello!</p>
-			<p>Channel #%d has been automatically disabled by the system.</p>
-			<p>Reason for disabling:</p>
-			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">该渠道在Recent %d times调用中Success率为 <strong>%.2f%%</strong>，低于系统阈值 <strong>%.2f%%</strong>。</p>
-		`, channelId, config.MetricQueueSize, successRate*100, config.MetricSuccessRateThreshold*100),
+			<p>Channel #%d stopped receiving requests for model <strong>%s</strong> for a while.</p>
+			<p>Reason:</p>
+			<p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">The success rate of its last %d requests is <strong>%.2f%%</strong>, below the threshold of <strong>%.2f%%</strong>.</p>
+			<p>A probe request will be sent every %d seconds until one succeeds.</p>
+		`, channelId, modelName, config.CircuitBreakerWindowSize, successRate*100, config.CircuitBreakerSuccessRateThreshold*100, config.CircuitBreakerCooldown),
 	)
 	notifyRootUser(subject, content)
 }
@@ -63,6 +63,7 @@ func MetricDisableChannel(channelId int, successRate float64) {
 // EnableChannel enable & notify
 func EnableChannel(channelId int, channelName string) {
 	model.UpdateChannelStatusById(channelId, model.ChannelStatusEnabled)
+	breaker.Reset(channelId, "")
 	logger.SysLog(fmt.Sprintf("channel #%d has been enabled", channelId))
 	subject := fmt.Sprintf("channel status change notification")
 	content := message.EmailTemplate(
@@ -33,6 +33,11 @@ type PerformanceMetrics struct {
 	StreamingRequests int64
 	TTFTTotal         time.Duration
 
+	// Hedging metrics
+	HedgedRequests int64
+	HedgeWins      int64
+	HedgeLosses    int64
+
 	// Last reset time
 	LastReset time.Time
 }
@@ -119,6 +124,23 @@ func RecordTTFT(ctx context.Context, duration time.Duration) {
 	globalMetrics.TTFTTotal += duration
 }
 
+// RecordHedge records a hedged request, won is true when the hedge answered before the first channel
+func RecordHedge(ctx context.Context, won bool) {
+	if !metricsEnabled || globalMetrics == nil {
+		return
+	}
+
+	globalMetrics.mu.Lock()
+	defer globalMetrics.mu.Unlock()
+
+	globalMetrics.HedgedRequests++
+	if won {
+		globalMetrics.HedgeWins++
+	} else {
+		globalMetrics.HedgeLosses++
+	}
+}
+
 // GetMetrics returns current metrics
 func GetMetrics() *MetricsSnapshot {
 	if !metricsEnabled || globalMetrics == nil {
@@ -147,6 +169,9 @@ func GetMetrics() *MetricsSnapshot {
 		DBAvgDuration:       time.Duration(int64(globalMetrics.DBTotalDuration) / max(globalMetrics.DBQueryCount, 1)),
 		StreamingRequests:   globalMetrics.StreamingRequests,
 		AvgTTFT:             time.Duration(int64(globalMetrics.TTFTTotal) / max(globalMetrics.StreamingRequests, 1)),
+		HedgedRequests:      globalMetrics.HedgedRequests,
+		HedgeWins:           globalMetrics.HedgeWins,
+		HedgeLosses:         globalMetrics.HedgeLosses,
 		LastReset:           globalMetrics.LastReset,
 		CurrentTime:         time.Now(),
 	}
@@ -176,6 +201,9 @@ type MetricsSnapshot struct {
 	DBAvgDuration     time.Duration `json:"db_avg_duration"`
 	StreamingRequests int64         `json:"streaming_requests"`
 	AvgTTFT           time.Duration `json:"avg_ttft"`
+	HedgedRequests    int64         `json:"hedged_requests"`
+	HedgeWins         int64         `json:"hedge_wins"`
+	HedgeLosses       int64         `json:"hedge_losses"`
 	LastReset         time.Time     `json:"last_reset"`
 	CurrentTime       time.Time     `json:"current_time"`
 }
@@ -232,6 +260,9 @@ func ResetMetrics() {
 	globalMetrics.DBTotalDuration = 0
 	globalMetrics.StreamingRequests = 0
 	globalMetrics.TTFTTotal = 0
+	globalMetrics.HedgedRequests = 0
+	globalMetrics.HedgeWins = 0
+	globalMetrics.HedgeLosses = 0
 	globalMetrics.LastReset = time.Now()
 }
 
@@ -74,6 +74,14 @@ func ConvertImageRequest(request model.ImageRequest) *ImageRequest {
 	imageRequest.Parameters.Size = strings.Replace(request.Size, "x", "*", -1)
 	imageRequest.Parameters.N = request.N
 	imageRequest.ResponseFormat = request.ResponseFormat
+	if request.Image != "" {
+		imageRequest.Input.BaseImageUrl = request.Image
+		imageRequest.Input.Function = "description_edit"
+		if request.Mask != "" {
+			imageRequest.Input.MaskImageUrl = request.Mask
+			imageRequest.Input.Function = "description_edit_with_mask"
+		}
+	}
 
 	return &imageRequest
 }
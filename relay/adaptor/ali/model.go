@@ -38,6 +38,10 @@ type ImageRequest struct {
 	Input struct {
 		Prompt         string `json:"prompt"`
 		NegativePrompt string `json:"negative_prompt,omitempty"`
+		// image edits, see https://help.aliyun.com/zh/model-studio/wanx-image-edit
+		Function     string `json:"function,omitempty"`
+		BaseImageUrl string `json:"base_image_url,omitempty"`
+		MaskImageUrl string `json:"mask_image_url,omitempty"`
 	} `json:"input"`
 	Parameters struct {
 		Size  string `json:"size,omitempty"`
@@ -0,0 +1,453 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The types in this file describe the Messages API as spoken by Claude clients
+// calling One API directly, which is looser than what we send upstream:
+// system prompts and message content may be plain strings or block lists.
+
+type InboundContent struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Source    *InboundSource  `json:"source,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     any             `json:"input,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type InboundSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type InboundMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type InboundTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type InboundRequest struct {
+	Model         string           `json:"model"`
+	Messages      []InboundMessage `json:"messages"`
+	System        json.RawMessage  `json:"system,omitempty"`
+	MaxTokens     int              `json:"max_tokens,omitempty"`
+	StopSequences []string         `json:"stop_sequences,omitempty"`
+	Stream        bool             `json:"stream,omitempty"`
+	Temperature   *float64         `json:"temperature,omitempty"`
+	TopP          *float64         `json:"top_p,omitempty"`
+	TopK          int              `json:"top_k,omitempty"`
+	Tools         []InboundTool    `json:"tools,omitempty"`
+	ToolChoice    map[string]any   `json:"tool_choice,omitempty"`
+	Metadata      *Metadata        `json:"metadata,omitempty"`
+}
+
+type InboundResponse struct {
+	Id           string           `json:"id"`
+	Type         string           `json:"type"`
+	Role         string           `json:"role"`
+	Content      []InboundContent `json:"content"`
+	Model        string           `json:"model"`
+	StopReason   *string          `json:"stop_reason"`
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        Usage            `json:"usage"`
+}
+
+type InboundError struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
+
+// parseInboundContent accepts either a plain string or a list of content blocks
+func parseInboundContent(raw json.RawMessage) ([]InboundContent, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []InboundContent{{Type: "text", Text: text}}, nil
+	}
+	var contents []InboundContent
+	if err := json.Unmarshal(raw, &contents); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+func contentsText(contents []InboundContent) string {
+	var builder strings.Builder
+	for _, content := range contents {
+		if content.Type == "text" {
+			builder.WriteString(content.Text)
+		}
+	}
+	return builder.String()
+}
+
+func toolResultText(content InboundContent) (string, error) {
+	nested, err := parseInboundContent(content.Content)
+	if err != nil {
+		return "", err
+	}
+	return contentsText(nested), nil
+}
+
+func imageURLFromSource(source *InboundSource) string {
+	if source == nil {
+		return ""
+	}
+	if source.Type == "url" {
+		return source.Url
+	}
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+}
+
+// ConvertInboundRequest converts a native Messages API request into the
+// OpenAI request consumed by every adaptor.
+func ConvertInboundRequest(request *InboundRequest) (*model.GeneralOpenAIRequest, error) {
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Stream:      request.Stream,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		TopK:        request.TopK,
+	}
+	if len(request.StopSequences) > 0 {
+		openaiRequest.Stop = request.StopSequences
+	}
+	if request.Metadata != nil {
+		openaiRequest.User = request.Metadata.UserId
+	}
+	if request.Stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	system, err := parseInboundContent(request.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system: %w", err)
+	}
+	if systemText := contentsText(system); systemText != "" {
+		openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+			Role:    "system",
+			Content: systemText,
+		})
+	}
+	for _, message := range request.Messages {
+		contents, err := parseInboundContent(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content of %s message: %w", message.Role, err)
+		}
+		if message.Role == "assistant" {
+			openaiRequest.Messages = append(openaiRequest.Messages, convertInboundAssistantMessage(contents))
+			continue
+		}
+		var parts []any
+		for _, content := range contents {
+			switch content.Type {
+			case "text":
+				parts = append(parts, model.MessageContent{Type: model.ContentTypeText, Text: content.Text})
+			case "image":
+				parts = append(parts, model.MessageContent{
+					Type:     model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{Url: imageURLFromSource(content.Source)},
+				})
+			case "tool_result":
+				// tool results become tool messages, which must directly follow the assistant tool calls
+				result, err := toolResultText(content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid tool_result content: %w", err)
+				}
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    result,
+					ToolCallId: content.ToolUseId,
+				})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		openaiMessage := model.Message{Role: message.Role, Content: parts}
+		if len(parts) == 1 {
+			if part, ok := parts[0].(model.MessageContent); ok && part.Type == model.ContentTypeText {
+				openaiMessage.Content = part.Text
+			}
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, openaiMessage)
+	}
+	for _, tool := range request.Tools {
+		openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if request.ToolChoice != nil {
+		switch request.ToolChoice["type"] {
+		case "auto":
+			openaiRequest.ToolChoice = "auto"
+		case "any":
+			openaiRequest.ToolChoice = "required"
+		case "none":
+			openaiRequest.ToolChoice = "none"
+		case "tool":
+			openaiRequest.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": request.ToolChoice["name"]},
+			}
+		}
+	}
+	// round-trip through JSON so content parts look like a decoded client request to the adaptors
+	jsonData, err := json.Marshal(openaiRequest)
+	if err != nil {
+		return nil, err
+	}
+	var normalized model.GeneralOpenAIRequest
+	if err = json.Unmarshal(jsonData, &normalized); err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+func convertInboundAssistantMessage(contents []InboundContent) model.Message {
+	message := model.Message{Role: "assistant"}
+	var text, reasoning strings.Builder
+	for _, content := range contents {
+		switch content.Type {
+		case "text":
+			text.WriteString(content.Text)
+		case "thinking":
+			reasoning.WriteString(content.Thinking)
+		case "tool_use":
+			arguments, _ := json.Marshal(content.Input)
+			message.ToolCalls = append(message.ToolCalls, model.Tool{
+				Id:   content.Id,
+				Type: "function",
+				Function: model.Function{
+					Name:      content.Name,
+					Arguments: string(arguments),
+				},
+			})
+		}
+	}
+	message.Content = text.String()
+	if reasoning.Len() > 0 {
+		message.ReasoningContent = reasoning.String()
+	}
+	return message
+}
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+func toolInput(arguments any) any {
+	input := make(map[string]any)
+	if argumentsString, ok := arguments.(string); ok && argumentsString != "" {
+		_ = json.Unmarshal([]byte(argumentsString), &input)
+	}
+	return input
+}
+
+// ResponseOpenAI2Claude converts a chat completion into a Messages API response
+func ResponseOpenAI2Claude(response *openai.TextResponse) *InboundResponse {
+	claudeResponse := InboundResponse{
+		Id:      "msg_" + random.GetUUID(),
+		Type:    "message",
+		Role:    "assistant",
+		Content: make([]InboundContent, 0),
+		Model:   response.Model,
+		Usage: Usage{
+			InputTokens:  response.Usage.PromptTokens,
+			OutputTokens: response.Usage.CompletionTokens,
+		},
+	}
+	stopReason := "end_turn"
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		if reasoning, ok := choice.Message.ReasoningContent.(string); ok && reasoning != "" {
+			claudeResponse.Content = append(claudeResponse.Content, InboundContent{Type: "thinking", Thinking: reasoning})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			claudeResponse.Content = append(claudeResponse.Content, InboundContent{Type: "text", Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			claudeResponse.Content = append(claudeResponse.Content, InboundContent{
+				Type:  "tool_use",
+				Id:    toolCall.Id,
+				Name:  toolCall.Function.Name,
+				Input: toolInput(toolCall.Function.Arguments),
+			})
+		}
+		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+	}
+	claudeResponse.StopReason = &stopReason
+	return &claudeResponse
+}
+
+// StreamConverter turns chat completion chunks into Messages API stream events.
+// A new content block is opened whenever the chunk switches between thinking,
+// text and a tool call.
+type StreamConverter struct {
+	Model      string
+	id         string
+	started    bool
+	blockIndex int
+	blockType  string
+	stopReason string
+	usage      Usage
+}
+
+type streamMessageDelta struct {
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+// StreamEvent is one server-sent event of the Messages API
+type StreamEvent struct {
+	Type         string           `json:"type"`
+	Message      *InboundResponse `json:"message,omitempty"`
+	Index        *int             `json:"index,omitempty"`
+	ContentBlock any              `json:"content_block,omitempty"`
+	Delta        any              `json:"delta,omitempty"`
+	Usage        *Usage           `json:"usage,omitempty"`
+}
+
+func (s *StreamConverter) start() []StreamEvent {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.id = "msg_" + random.GetUUID()
+	s.blockIndex = -1
+	return []StreamEvent{{
+		Type: "message_start",
+		Message: &InboundResponse{
+			Id:      s.id,
+			Type:    "message",
+			Role:    "assistant",
+			Content: make([]InboundContent, 0),
+			Model:   s.Model,
+		},
+	}}
+}
+
+func (s *StreamConverter) closeBlock() []StreamEvent {
+	if s.blockType == "" {
+		return nil
+	}
+	index := s.blockIndex
+	s.blockType = ""
+	return []StreamEvent{{Type: "content_block_stop", Index: &index}}
+}
+
+func (s *StreamConverter) openBlock(block map[string]any) []StreamEvent {
+	events := s.closeBlock()
+	s.blockIndex++
+	s.blockType = block["type"].(string)
+	index := s.blockIndex
+	events = append(events, StreamEvent{Type: "content_block_start", Index: &index, ContentBlock: block})
+	return events
+}
+
+func (s *StreamConverter) delta(delta map[string]any) StreamEvent {
+	index := s.blockIndex
+	return StreamEvent{Type: "content_block_delta", Index: &index, Delta: delta}
+}
+
+// Convert converts one chat completion chunk
+func (s *StreamConverter) Convert(chunk *openai.ChatCompletionsStreamResponse) []StreamEvent {
+	if s.Model == "" {
+		s.Model = chunk.Model
+	}
+	events := s.start()
+	if chunk.Usage != nil {
+		s.usage.InputTokens = chunk.Usage.PromptTokens
+		s.usage.OutputTokens = chunk.Usage.CompletionTokens
+	}
+	for _, choice := range chunk.Choices {
+		if reasoning, ok := choice.Delta.ReasoningContent.(string); ok && reasoning != "" {
+			if s.blockType != "thinking" {
+				events = append(events, s.openBlock(map[string]any{"type": "thinking", "thinking": ""})...)
+			}
+			events = append(events, s.delta(map[string]any{"type": "thinking_delta", "thinking": reasoning}))
+		}
+		if text := choice.Delta.StringContent(); text != "" {
+			if s.blockType != "text" {
+				events = append(events, s.openBlock(map[string]any{"type": "text", "text": ""})...)
+			}
+			events = append(events, s.delta(map[string]any{"type": "text_delta", "text": text}))
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			// a tool call id or name marks the beginning of a new call
+			if toolCall.Id != "" || toolCall.Function.Name != "" || s.blockType != "tool_use" {
+				events = append(events, s.openBlock(map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.Id,
+					"name":  toolCall.Function.Name,
+					"input": map[string]any{},
+				})...)
+			}
+			if arguments, ok := toolCall.Function.Arguments.(string); ok && arguments != "" {
+				events = append(events, s.delta(map[string]any{"type": "input_json_delta", "partial_json": arguments}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.stopReason = stopReasonOpenAI2Claude(*choice.FinishReason)
+		}
+	}
+	return events
+}
+
+// Finish closes the message once the upstream stream is done
+func (s *StreamConverter) Finish() []StreamEvent {
+	events := s.start()
+	events = append(events, s.closeBlock()...)
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+	usage := s.usage
+	events = append(events,
+		StreamEvent{Type: "message_delta", Delta: streamMessageDelta{StopReason: &stopReason}, Usage: &usage},
+		StreamEvent{Type: "message_stop"},
+	)
+	return events
+}
+
+// EncodeStreamEvent renders an event in the SSE format used by the Messages API
+func EncodeStreamEvent(event StreamEvent) []byte {
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		return nil
+	}
+	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, jsonData))
+}
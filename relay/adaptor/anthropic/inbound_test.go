@@ -0,0 +1,242 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func TestConvertInboundRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "plain strings",
+			request: `{"model":"claude-3-5-sonnet","max_tokens":100,"system":"be brief","messages":[{"role":"user","content":"hi"}]}`,
+			want:    `{"model":"claude-3-5-sonnet","max_tokens":100,"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "content blocks",
+			request: `{"model":"claude-3-5-sonnet","max_tokens":100,"system":[{"type":"text","text":"be "},{"type":"text","text":"brief"}],
+				"messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+					{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBOR"}},
+					{"type":"image","source":{"type":"url","url":"https://example.com/a.png"}}]}]}`,
+			want: `{"model":"claude-3-5-sonnet","max_tokens":100,"messages":[{"role":"system","content":"be brief"},
+				{"role":"user","content":[{"type":"text","text":"what is this?"},
+					{"type":"image_url","text":"","image_url":{"url":"data:image/png;base64,iVBOR"}},
+					{"type":"image_url","text":"","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+		},
+		{
+			name: "tool use",
+			request: `{"model":"claude-3-5-sonnet","max_tokens":100,
+				"tools":[{"name":"get_weather","description":"Get the weather","input_schema":{"type":"object"}}],
+				"tool_choice":{"type":"tool","name":"get_weather"},
+				"messages":[{"role":"user","content":"weather in Paris?"},
+					{"role":"assistant","content":[{"type":"thinking","thinking":"need a tool"},{"type":"text","text":"checking"},
+						{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}]},
+					{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"sunny"}]},
+						{"type":"text","text":"thanks"}]}]}`,
+			want: `{"model":"claude-3-5-sonnet","max_tokens":100,
+				"tools":[{"type":"function","function":{"name":"get_weather","description":"Get the weather","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"get_weather"}},
+				"messages":[{"role":"user","content":"weather in Paris?"},
+					{"role":"assistant","content":"checking","reasoning_content":"need a tool",
+						"tool_calls":[{"id":"toolu_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},
+					{"role":"tool","content":"sunny","tool_call_id":"toolu_1"},
+					{"role":"user","content":"thanks"}]}`,
+		},
+		{
+			name:    "tool choice any",
+			request: `{"model":"claude-3-5-sonnet","max_tokens":100,"tool_choice":{"type":"any"},"messages":[{"role":"user","content":"hi"}]}`,
+			want:    `{"model":"claude-3-5-sonnet","max_tokens":100,"tool_choice":"required","messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "stream",
+			request: `{"model":"claude-3-5-sonnet","max_tokens":100,"stream":true,"stop_sequences":["END"],"temperature":0.5,"top_k":5,
+				"metadata":{"user_id":"user-1"},"messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"claude-3-5-sonnet","max_tokens":100,"stream":true,"stream_options":{"include_usage":true},"stop":["END"],
+				"temperature":0.5,"top_k":5,"user":"user-1","messages":[{"role":"user","content":"hi"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request InboundRequest
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := ConvertInboundRequest(&request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+		})
+	}
+
+	request := InboundRequest{Model: "claude-3-5-sonnet", Messages: []InboundMessage{{Role: "user", Content: json.RawMessage(`{"type":"text"}`)}}}
+	if _, err := ConvertInboundRequest(&request); err == nil {
+		t.Error("content which is neither a string nor a list of blocks should be rejected")
+	}
+}
+
+func TestResponseOpenAI2Claude(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name:     "text",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			want: `{"id":"","type":"message","role":"assistant","model":"gpt-4o","content":[{"type":"text","text":"hello"}],
+				"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":3,"output_tokens":1}}`,
+		},
+		{
+			name: "reasoning and tool calls",
+			response: `{"model":"deepseek-reasoner","choices":[{"index":0,"message":{"role":"assistant","content":"","reasoning_content":"need a tool",
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5}}`,
+			want: `{"id":"","type":"message","role":"assistant","model":"deepseek-reasoner",
+				"content":[{"type":"thinking","thinking":"need a tool"},{"type":"tool_use","id":"call_1","name":"get_weather","input":{"city":"Paris"}}],
+				"stop_reason":"tool_use","stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":5}}`,
+		},
+		{
+			name:     "length",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hel"},"finish_reason":"length"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			want: `{"id":"","type":"message","role":"assistant","model":"gpt-4o","content":[{"type":"text","text":"hel"}],
+				"stop_reason":"max_tokens","stop_sequence":null,"usage":{"input_tokens":3,"output_tokens":1}}`,
+		},
+		{
+			name:     "no choices",
+			response: `{"model":"gpt-4o","choices":[],"usage":{}}`,
+			want: `{"id":"","type":"message","role":"assistant","model":"gpt-4o","content":[],
+				"stop_reason":"end_turn","stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response openai.TextResponse
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatal(err)
+			}
+			converted := ResponseOpenAI2Claude(&response)
+			if len(converted.Id) <= len("msg_") {
+				t.Errorf("message id should be generated, got %q", converted.Id)
+			}
+			converted.Id = ""
+			gotJSON, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+		})
+	}
+}
+
+func TestStreamConverter(t *testing.T) {
+	const messageStart = `{"type":"message_start","message":{"id":"","type":"message","role":"assistant","content":[],"model":"gpt-4o",
+		"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}`
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+				`{"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			},
+			want: []string{
+				messageStart,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"input_tokens":3,"output_tokens":2}}`,
+				`{"type":"message_stop"}`,
+			},
+		},
+		{
+			name: "thinking, text and tool calls",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"reasoning_content":"need a tool"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"checking"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\""}}]}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"function":{"arguments":":\"Paris\"}"}}]}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []string{
+				messageStart,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"need a tool"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"checking"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"call_1","name":"get_weather","input":{}}}`,
+				`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\""}}`,
+				`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":":\"Paris\"}"}}`,
+				`{"type":"content_block_stop","index":2}`,
+				`{"type":"content_block_start","index":3,"content_block":{"type":"tool_use","id":"call_2","name":"get_time","input":{}}}`,
+				`{"type":"content_block_delta","index":3,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+				`{"type":"content_block_stop","index":3}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"input_tokens":0,"output_tokens":0}}`,
+				`{"type":"message_stop"}`,
+			},
+		},
+		{
+			name: "empty",
+			want: []string{
+				`{"type":"message_start","message":{"id":"","type":"message","role":"assistant","content":[],"model":"",
+					"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":0,"output_tokens":0}}}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"input_tokens":0,"output_tokens":0}}`,
+				`{"type":"message_stop"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := &StreamConverter{}
+			var events []StreamEvent
+			for _, data := range tt.chunks {
+				var chunk openai.ChatCompletionsStreamResponse
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatal(err)
+				}
+				events = append(events, converter.Convert(&chunk)...)
+			}
+			events = append(events, converter.Finish()...)
+			if len(events) != len(tt.want) {
+				gotJSON, _ := json.Marshal(events)
+				t.Fatalf("got %d events, want %d: %s", len(events), len(tt.want), gotJSON)
+			}
+			for i, event := range events {
+				if event.Message != nil {
+					event.Message.Id = ""
+				}
+				gotJSON, err := json.Marshal(event)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.JSONEq(t, tt.want[i], string(gotJSON))
+			}
+		})
+	}
+}
+
+func TestEncodeStreamEvent(t *testing.T) {
+	got := string(EncodeStreamEvent(StreamEvent{Type: "message_stop"}))
+	if want := "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"; got != want {
+		t.Errorf("EncodeStreamEvent() = %q, want %q", got, want)
+	}
+}
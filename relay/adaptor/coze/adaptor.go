@@ -63,6 +63,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	}
 	usage.PromptTokens = meta.PromptTokens
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.Estimated = true
 	return
 }
 
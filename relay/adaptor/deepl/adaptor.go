@@ -60,6 +60,7 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 	usage = &model.Usage{
 		PromptTokens: promptTokens,
 		TotalTokens:  promptTokens,
+		Estimated:    true,
 	}
 	return
 }
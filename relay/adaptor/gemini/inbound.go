@@ -0,0 +1,369 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The types in this file describe generateContent as spoken by the Google
+// GenAI SDKs calling One API directly. The SDKs use camelCase field names.
+
+const (
+	InboundActionGenerateContent       = "generateContent"
+	InboundActionStreamGenerateContent = "streamGenerateContent"
+)
+
+type InboundTool struct {
+	FunctionDeclarations []model.Function `json:"functionDeclarations,omitempty"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type InboundRequest struct {
+	Contents          []ChatContent        `json:"contents"`
+	SystemInstruction *ChatContent         `json:"systemInstruction,omitempty"`
+	GenerationConfig  ChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []InboundTool        `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig          `json:"toolConfig,omitempty"`
+}
+
+type UsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type InboundCandidate struct {
+	Content      ChatContent `json:"content"`
+	FinishReason string      `json:"finishReason,omitempty"`
+	Index        int         `json:"index"`
+}
+
+type InboundResponse struct {
+	Candidates    []InboundCandidate `json:"candidates"`
+	UsageMetadata *UsageMetadata     `json:"usageMetadata,omitempty"`
+	ModelVersion  string             `json:"modelVersion,omitempty"`
+}
+
+type InboundError struct {
+	Error Error `json:"error"`
+}
+
+// ParseInboundPath splits "/v1beta/models/gemini-pro:generateContent" into model and action
+func ParseInboundPath(path string) (string, string) {
+	idx := strings.Index(path, "/models/")
+	if idx < 0 {
+		return "", ""
+	}
+	modelAction := path[idx+len("/models/"):]
+	modelName, action, _ := strings.Cut(modelAction, ":")
+	return modelName, action
+}
+
+func partsText(parts []Part) string {
+	var builder strings.Builder
+	for _, part := range parts {
+		builder.WriteString(part.Text)
+	}
+	return builder.String()
+}
+
+// ConvertInboundRequest converts a native generateContent request into the
+// OpenAI request consumed by every adaptor.
+func ConvertInboundRequest(request *InboundRequest, modelName string, stream bool) (*model.GeneralOpenAIRequest, error) {
+	generationConfig := request.GenerationConfig
+	openaiRequest := model.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      stream,
+		Temperature: generationConfig.Temperature,
+		TopP:        generationConfig.TopP,
+		TopK:        int(generationConfig.TopK),
+		MaxTokens:   generationConfig.MaxOutputTokens,
+	}
+	if generationConfig.CandidateCount > 1 {
+		openaiRequest.N = generationConfig.CandidateCount
+	}
+	if len(generationConfig.StopSequences) > 0 {
+		openaiRequest.Stop = generationConfig.StopSequences
+	}
+	if generationConfig.ResponseMimeType == "application/json" {
+		openaiRequest.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		if schema, ok := generationConfig.ResponseSchema.(map[string]any); ok {
+			openaiRequest.ResponseFormat = &model.ResponseFormat{
+				Type:       "json_schema",
+				JsonSchema: &model.JSONSchema{Name: "response", Schema: schema},
+			}
+		}
+	}
+	if stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	if request.SystemInstruction != nil {
+		if systemText := partsText(request.SystemInstruction.Parts); systemText != "" {
+			openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+				Role:    "system",
+				Content: systemText,
+			})
+		}
+	}
+	// Gemini pairs function calls and responses by name, OpenAI by id
+	callIds := make(map[string][]string)
+	for _, content := range request.Contents {
+		if content.Role == "model" {
+			message := model.Message{Role: "assistant", Content: partsText(content.Parts)}
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				arguments, err := json.Marshal(part.FunctionCall.Arguments)
+				if err != nil {
+					return nil, err
+				}
+				id := fmt.Sprintf("call_%s", random.GetUUID())
+				callIds[part.FunctionCall.FunctionName] = append(callIds[part.FunctionCall.FunctionName], id)
+				message.ToolCalls = append(message.ToolCalls, model.Tool{
+					Id:   id,
+					Type: "function",
+					Function: model.Function{
+						Name:      part.FunctionCall.FunctionName,
+						Arguments: string(arguments),
+					},
+				})
+			}
+			openaiRequest.Messages = append(openaiRequest.Messages, message)
+			continue
+		}
+		var contentParts []model.MessageContent
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				response, err := json.Marshal(part.FunctionResponse.Response)
+				if err != nil {
+					return nil, err
+				}
+				var id string
+				if ids := callIds[part.FunctionResponse.Name]; len(ids) > 0 {
+					id = ids[0]
+					callIds[part.FunctionResponse.Name] = ids[1:]
+				}
+				openaiRequest.Messages = append(openaiRequest.Messages, model.Message{
+					Role:       "tool",
+					Content:    string(response),
+					Name:       &part.FunctionResponse.Name,
+					ToolCallId: id,
+				})
+			case part.InlineData != nil:
+				contentParts = append(contentParts, model.MessageContent{
+					Type: model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{
+						Url: fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data),
+					},
+				})
+			case part.FileData != nil:
+				contentParts = append(contentParts, model.MessageContent{
+					Type:     model.ContentTypeImageURL,
+					ImageURL: &model.ImageURL{Url: part.FileData.FileUri},
+				})
+			case part.Text != "":
+				contentParts = append(contentParts, model.MessageContent{Type: model.ContentTypeText, Text: part.Text})
+			}
+		}
+		if len(contentParts) == 0 {
+			continue
+		}
+		message := model.Message{Role: "user"}
+		if len(contentParts) == 1 && contentParts[0].Type == model.ContentTypeText {
+			message.Content = contentParts[0].Text
+		} else {
+			message.Content = contentParts
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, message)
+	}
+	for _, tool := range request.Tools {
+		for _, function := range tool.FunctionDeclarations {
+			openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+				Type:     "function",
+				Function: function,
+			})
+		}
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := request.ToolConfig.FunctionCallingConfig
+		switch callingConfig.Mode {
+		case "AUTO":
+			openaiRequest.ToolChoice = "auto"
+		case "NONE":
+			openaiRequest.ToolChoice = "none"
+		case "ANY":
+			openaiRequest.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				openaiRequest.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": callingConfig.AllowedFunctionNames[0]},
+				}
+			}
+		}
+	}
+	// round-trip through JSON so content parts look like a decoded client request to the adaptors
+	jsonData, err := json.Marshal(openaiRequest)
+	if err != nil {
+		return nil, err
+	}
+	var normalized model.GeneralOpenAIRequest
+	if err = json.Unmarshal(jsonData, &normalized); err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func usageOpenAI2Gemini(usage *model.Usage) *UsageMetadata {
+	return &UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+func functionCallPart(name string, arguments any) Part {
+	args := make(map[string]any)
+	if argumentsString, ok := arguments.(string); ok && argumentsString != "" {
+		_ = json.Unmarshal([]byte(argumentsString), &args)
+	}
+	return Part{FunctionCall: &FunctionCall{FunctionName: name, Arguments: args}}
+}
+
+// ResponseOpenAI2Gemini converts a chat completion into a generateContent response
+func ResponseOpenAI2Gemini(response *openai.TextResponse) *InboundResponse {
+	geminiResponse := InboundResponse{
+		Candidates:    make([]InboundCandidate, 0, len(response.Choices)),
+		UsageMetadata: usageOpenAI2Gemini(&response.Usage),
+		ModelVersion:  response.Model,
+	}
+	for _, choice := range response.Choices {
+		candidate := InboundCandidate{
+			Content:      ChatContent{Role: "model", Parts: make([]Part, 0)},
+			FinishReason: finishReasonOpenAI2Gemini(choice.FinishReason),
+			Index:        choice.Index,
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			candidate.Content.Parts = append(candidate.Content.Parts, Part{Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			candidate.Content.Parts = append(candidate.Content.Parts, functionCallPart(toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+		geminiResponse.Candidates = append(geminiResponse.Candidates, candidate)
+	}
+	return &geminiResponse
+}
+
+type streamToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// StreamConverter turns chat completion chunks into generateContent stream
+// chunks. Function call arguments arrive in fragments, so calls are buffered
+// and sent with the finish reason and usage in the final chunk.
+type StreamConverter struct {
+	Model         string
+	finishReasons map[int]string
+	toolCalls     map[int][]*streamToolCall
+	usage         *model.Usage
+}
+
+// Convert converts one chat completion chunk, returning nil when there is nothing to send yet
+func (s *StreamConverter) Convert(chunk *openai.ChatCompletionsStreamResponse) *InboundResponse {
+	if s.finishReasons == nil {
+		s.finishReasons = make(map[int]string)
+		s.toolCalls = make(map[int][]*streamToolCall)
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	var candidates []InboundCandidate
+	for _, choice := range chunk.Choices {
+		for _, toolCall := range choice.Delta.ToolCalls {
+			calls := s.toolCalls[choice.Index]
+			if toolCall.Function.Name != "" || len(calls) == 0 {
+				calls = append(calls, &streamToolCall{name: toolCall.Function.Name})
+				s.toolCalls[choice.Index] = calls
+			}
+			if arguments, ok := toolCall.Function.Arguments.(string); ok {
+				calls[len(calls)-1].arguments.WriteString(arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReasons[choice.Index] = finishReasonOpenAI2Gemini(*choice.FinishReason)
+		}
+		if text := choice.Delta.StringContent(); text != "" {
+			candidates = append(candidates, InboundCandidate{
+				Content: ChatContent{Role: "model", Parts: []Part{{Text: text}}},
+				Index:   choice.Index,
+			})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &InboundResponse{Candidates: candidates, ModelVersion: s.Model}
+}
+
+// Finish returns the final chunk once the upstream stream is done
+func (s *StreamConverter) Finish() *InboundResponse {
+	response := InboundResponse{ModelVersion: s.Model}
+	if s.usage != nil {
+		response.UsageMetadata = usageOpenAI2Gemini(s.usage)
+	}
+	indexes := make(map[int]bool)
+	for index := range s.finishReasons {
+		indexes[index] = true
+	}
+	for index := range s.toolCalls {
+		indexes[index] = true
+	}
+	if len(indexes) == 0 {
+		indexes[0] = true
+	}
+	for index := 0; len(indexes) > 0; index++ {
+		if !indexes[index] {
+			continue
+		}
+		delete(indexes, index)
+		candidate := InboundCandidate{
+			Content:      ChatContent{Role: "model", Parts: make([]Part, 0)},
+			FinishReason: s.finishReasons[index],
+			Index:        index,
+		}
+		if candidate.FinishReason == "" {
+			candidate.FinishReason = "STOP"
+		}
+		for _, call := range s.toolCalls[index] {
+			candidate.Content.Parts = append(candidate.Content.Parts, functionCallPart(call.name, call.arguments.String()))
+		}
+		response.Candidates = append(response.Candidates, candidate)
+	}
+	return &response
+}
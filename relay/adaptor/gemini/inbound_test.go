@@ -0,0 +1,225 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// numberCallIds replaces the random ids of the tool calls by their order of appearance
+func numberCallIds(request *model.GeneralOpenAIRequest) {
+	ids := make(map[string]string)
+	number := func(id string) string {
+		if _, ok := ids[id]; !ok && id != "" {
+			ids[id] = fmt.Sprintf("call_%d", len(ids)+1)
+		}
+		return ids[id]
+	}
+	for i := range request.Messages {
+		for j := range request.Messages[i].ToolCalls {
+			request.Messages[i].ToolCalls[j].Id = number(request.Messages[i].ToolCalls[j].Id)
+		}
+		request.Messages[i].ToolCallId = number(request.Messages[i].ToolCallId)
+	}
+}
+
+func TestParseInboundPath(t *testing.T) {
+	modelName, action := ParseInboundPath("/v1beta/models/gemini-1.5-pro:streamGenerateContent")
+	assert.Equal(t, "gemini-1.5-pro", modelName)
+	assert.Equal(t, InboundActionStreamGenerateContent, action)
+	modelName, action = ParseInboundPath("/v1beta/files")
+	assert.Empty(t, modelName)
+	assert.Empty(t, action)
+}
+
+func TestConvertInboundRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		stream  bool
+		want    string
+	}{
+		{
+			name: "text",
+			request: `{"systemInstruction":{"parts":[{"text":"be "},{"text":"brief"}]},
+				"contents":[{"role":"user","parts":[{"text":"hi"}]},{"role":"model","parts":[{"text":"hello"}]},{"parts":[{"text":"how are you?"}]}],
+				"generationConfig":{"temperature":0.5,"topP":0.9,"topK":40,"maxOutputTokens":100,"candidateCount":2,"stopSequences":["END"]}}`,
+			want: `{"model":"gemini-1.5-pro","temperature":0.5,"top_p":0.9,"top_k":40,"max_tokens":100,"n":2,"stop":["END"],
+				"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},
+					{"role":"assistant","content":"hello"},{"role":"user","content":"how are you?"}]}`,
+		},
+		{
+			name: "stream",
+			request: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],
+				"generationConfig":{"responseMimeType":"application/json"}}`,
+			stream: true,
+			want: `{"model":"gemini-1.5-pro","stream":true,"stream_options":{"include_usage":true},"response_format":{"type":"json_object"},
+				"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "response schema",
+			request: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],
+				"generationConfig":{"responseMimeType":"application/json","responseSchema":{"type":"object"}}}`,
+			want: `{"model":"gemini-1.5-pro","response_format":{"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"}}},
+				"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "images",
+			request: `{"contents":[{"role":"user","parts":[{"text":"what is this?"},
+				{"inlineData":{"mimeType":"image/png","data":"iVBOR"}},{"fileData":{"mimeType":"image/png","fileUri":"https://example.com/a.png"}}]}]}`,
+			want: `{"model":"gemini-1.5-pro","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+				{"type":"image_url","text":"","image_url":{"url":"data:image/png;base64,iVBOR"}},
+				{"type":"image_url","text":"","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+		},
+		{
+			name: "function calls",
+			request: `{"contents":[{"role":"user","parts":[{"text":"weather in Paris and Rome?"}]},
+					{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},
+						{"functionCall":{"name":"get_weather","args":{"city":"Rome"}}}]},
+					{"role":"user","parts":[{"functionResponse":{"name":"get_weather","response":{"weather":"sunny"}}},
+						{"functionResponse":{"name":"get_weather","response":{"weather":"rainy"}}}]}],
+				"tools":[{"functionDeclarations":[{"name":"get_weather","description":"Get the weather","parameters":{"type":"object"}}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}}}`,
+			want: `{"model":"gemini-1.5-pro",
+				"tools":[{"type":"function","function":{"name":"get_weather","description":"Get the weather","parameters":{"type":"object"}}}],
+				"tool_choice":{"type":"function","function":{"name":"get_weather"}},
+				"messages":[{"role":"user","content":"weather in Paris and Rome?"},
+					{"role":"assistant","content":"","tool_calls":[
+						{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+						{"id":"call_2","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+					{"role":"tool","content":"{\"weather\":\"sunny\"}","name":"get_weather","tool_call_id":"call_1"},
+					{"role":"tool","content":"{\"weather\":\"rainy\"}","name":"get_weather","tool_call_id":"call_2"}]}`,
+		},
+		{
+			name:    "function calling mode",
+			request: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"toolConfig":{"functionCallingConfig":{"mode":"ANY"}}}`,
+			want:    `{"model":"gemini-1.5-pro","tool_choice":"required","messages":[{"role":"user","content":"hi"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request InboundRequest
+			assert.NoError(t, json.Unmarshal([]byte(tt.request), &request))
+			converted, err := ConvertInboundRequest(&request, "gemini-1.5-pro", tt.stream)
+			if !assert.NoError(t, err) {
+				return
+			}
+			numberCallIds(converted)
+			got, err := json.Marshal(converted)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestResponseOpenAI2Gemini(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name: "candidates",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"},
+				{"index":1,"message":{"role":"assistant","content":"hel"},"finish_reason":"length"}],
+				"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]},"finishReason":"STOP","index":0},
+					{"content":{"role":"model","parts":[{"text":"hel"}]},"finishReason":"MAX_TOKENS","index":1}],
+				"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5},"modelVersion":"gpt-4o"}`,
+		},
+		{
+			name: "tool calls",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"",
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP","index":0}],
+				"usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15},"modelVersion":"gpt-4o"}`,
+		},
+		{
+			name:     "content filter",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}],"usage":{}}`,
+			want: `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"SAFETY","index":0}],
+				"usageMetadata":{"promptTokenCount":0,"candidatesTokenCount":0,"totalTokenCount":0},"modelVersion":"gpt-4o"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response openai.TextResponse
+			assert.NoError(t, json.Unmarshal([]byte(tt.response), &response))
+			got, err := json.Marshal(ResponseOpenAI2Gemini(&response))
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestStreamConverter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name: "text",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+				`{"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			},
+			want: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}],"modelVersion":"gemini-1.5-pro"}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"index":0}],"modelVersion":"gemini-1.5-pro"}`,
+				`{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],
+					"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5},"modelVersion":"gemini-1.5-pro"}`,
+			},
+		},
+		{
+			name: "candidates and function calls",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":1,"delta":{"content":"checking"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\""}}]}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]},"finish_reason":"tool_calls"},
+					{"index":1,"delta":{},"finish_reason":"length"}]}`,
+			},
+			want: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"checking"}]},"index":1}],"modelVersion":"gemini-1.5-pro"}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}}]},"finishReason":"STOP","index":0},
+					{"content":{"role":"model","parts":[]},"finishReason":"MAX_TOKENS","index":1}],"modelVersion":"gemini-1.5-pro"}`,
+			},
+		},
+		{
+			name: "empty",
+			want: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],"modelVersion":"gemini-1.5-pro"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := &StreamConverter{Model: "gemini-1.5-pro"}
+			var responses []*InboundResponse
+			for _, data := range tt.chunks {
+				var chunk openai.ChatCompletionsStreamResponse
+				assert.NoError(t, json.Unmarshal([]byte(data), &chunk))
+				if response := converter.Convert(&chunk); response != nil {
+					responses = append(responses, response)
+				}
+			}
+			responses = append(responses, converter.Finish())
+			if !assert.Len(t, responses, len(tt.want)) {
+				return
+			}
+			for i, response := range responses {
+				got, err := json.Marshal(response)
+				assert.NoError(t, err)
+				assert.JSONEq(t, tt.want[i], string(got))
+			}
+		})
+	}
+}
@@ -388,6 +388,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
 		TotalTokens:      promptTokens + completionTokens,
+		Estimated:        true,
 	}
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
@@ -19,3 +19,9 @@ type Adaptor interface {
 	GetModelList() []string
 	GetChannelName() string
 }
+
+// RerankAdaptor is implemented by the adaptors whose channels serve the rerank api,
+// DoResponse handles the upstream response when meta.Mode is relaymode.Rerank
+type RerankAdaptor interface {
+	ConvertRerankRequest(request *model.RerankRequest) (any, error)
+}
@@ -0,0 +1,371 @@
+package ollama
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// The types in this file describe the Ollama API as spoken by local tools
+// calling One API directly, so they can use every model we proxy.
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+
+type InboundChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []Message       `json:"messages"`
+	Tools    []model.Tool    `json:"tools,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Stream   *bool           `json:"stream,omitempty"`
+	Options  *Options        `json:"options,omitempty"`
+}
+
+type GenerateRequest struct {
+	Model   string          `json:"model"`
+	Prompt  string          `json:"prompt"`
+	System  string          `json:"system,omitempty"`
+	Images  []string        `json:"images,omitempty"`
+	Format  json.RawMessage `json:"format,omitempty"`
+	Stream  *bool           `json:"stream,omitempty"`
+	Options *Options        `json:"options,omitempty"`
+}
+
+type InboundEmbeddingRequest struct {
+	Model   string   `json:"model"`
+	Input   any      `json:"input"`
+	Options *Options `json:"options,omitempty"`
+}
+
+type GenerateResponse struct {
+	Model           string `json:"model"`
+	CreatedAt       string `json:"created_at"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason,omitempty"`
+	PromptEvalCount int    `json:"prompt_eval_count,omitempty"`
+	EvalCount       int    `json:"eval_count,omitempty"`
+}
+
+type ModelTag struct {
+	Name       string `json:"name"`
+	Model      string `json:"model"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+	Digest     string `json:"digest"`
+}
+
+type TagsResponse struct {
+	Models []ModelTag `json:"models"`
+}
+
+// IsStream reports whether the response should be streamed, Ollama streams unless told otherwise
+func IsStream(stream *bool) bool {
+	return stream == nil || *stream
+}
+
+func formatToResponseFormat(format json.RawMessage) *model.ResponseFormat {
+	if len(format) == 0 || string(format) == "null" {
+		return nil
+	}
+	var formatName string
+	if json.Unmarshal(format, &formatName) == nil {
+		if formatName == "json" {
+			return &model.ResponseFormat{Type: "json_object"}
+		}
+		return nil
+	}
+	// a JSON schema the output must follow
+	var schema map[string]any
+	if json.Unmarshal(format, &schema) != nil {
+		return nil
+	}
+	return &model.ResponseFormat{
+		Type:       "json_schema",
+		JsonSchema: &model.JSONSchema{Name: "response", Schema: schema},
+	}
+}
+
+func applyOptions(request *model.GeneralOpenAIRequest, options *Options) {
+	if options == nil {
+		return
+	}
+	request.Seed = float64(options.Seed)
+	request.Temperature = options.Temperature
+	request.TopP = options.TopP
+	request.TopK = options.TopK
+	request.FrequencyPenalty = options.FrequencyPenalty
+	request.PresencePenalty = options.PresencePenalty
+	request.NumCtx = options.NumCtx
+	if options.NumPredict > 0 {
+		request.MaxTokens = options.NumPredict
+	}
+	if len(options.Stop) > 0 {
+		request.Stop = options.Stop
+	}
+}
+
+// imageDataURL turns the bare base64 images of the Ollama API into data URLs
+func imageDataURL(data string) string {
+	mimeType := "image/jpeg"
+	prefix := data
+	if len(prefix) > 512 {
+		prefix = prefix[:512]
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(prefix[:len(prefix)/4*4]); err == nil {
+		if detected := http.DetectContentType(decoded); strings.HasPrefix(detected, "image/") {
+			mimeType = detected
+		}
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, data)
+}
+
+func messageContent(text string, images []string) any {
+	if len(images) == 0 {
+		return text
+	}
+	contents := []model.MessageContent{{Type: model.ContentTypeText, Text: text}}
+	for _, image := range images {
+		contents = append(contents, model.MessageContent{
+			Type:     model.ContentTypeImageURL,
+			ImageURL: &model.ImageURL{Url: imageDataURL(image)},
+		})
+	}
+	return contents
+}
+
+func newChatRequest(modelName string, stream bool, format json.RawMessage, options *Options) *model.GeneralOpenAIRequest {
+	request := &model.GeneralOpenAIRequest{
+		Model:          modelName,
+		Stream:         stream,
+		ResponseFormat: formatToResponseFormat(format),
+	}
+	if stream {
+		// the last chunk carries the token counts
+		request.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	applyOptions(request, options)
+	return request
+}
+
+// ConvertInboundChatRequest converts an /api/chat request into a chat completion request
+func ConvertInboundChatRequest(request *InboundChatRequest) (*model.GeneralOpenAIRequest, error) {
+	chatRequest := newChatRequest(request.Model, IsStream(request.Stream), request.Format, request.Options)
+	chatRequest.Tools = request.Tools
+	// Ollama does not number tool calls, results answer the pending calls in order
+	var pendingCallIds []string
+	for i, message := range request.Messages {
+		switch message.Role {
+		case "assistant":
+			openaiMessage := model.Message{Role: "assistant"}
+			if message.Content != "" || len(message.ToolCalls) == 0 {
+				openaiMessage.Content = message.Content
+			}
+			pendingCallIds = nil
+			for j, toolCall := range message.ToolCalls {
+				arguments, err := json.Marshal(toolCall.Function.Arguments)
+				if err != nil {
+					return nil, err
+				}
+				id := fmt.Sprintf("call_%d_%d", i, j)
+				pendingCallIds = append(pendingCallIds, id)
+				openaiMessage.ToolCalls = append(openaiMessage.ToolCalls, model.Tool{
+					Id:       id,
+					Type:     "function",
+					Function: model.Function{Name: toolCall.Function.Name, Arguments: string(arguments)},
+				})
+			}
+			chatRequest.Messages = append(chatRequest.Messages, openaiMessage)
+		case "tool":
+			if len(pendingCallIds) == 0 {
+				return nil, fmt.Errorf("messages[%d]: tool message without a preceding tool call", i)
+			}
+			chatRequest.Messages = append(chatRequest.Messages, model.Message{
+				Role:       "tool",
+				Content:    message.Content,
+				ToolCallId: pendingCallIds[0],
+			})
+			pendingCallIds = pendingCallIds[1:]
+		default:
+			chatRequest.Messages = append(chatRequest.Messages, model.Message{
+				Role:    message.Role,
+				Content: messageContent(message.Content, message.Images),
+			})
+		}
+	}
+	return chatRequest, nil
+}
+
+// ConvertGenerateRequest converts an /api/generate request into a chat completion request
+func ConvertGenerateRequest(request *GenerateRequest) *model.GeneralOpenAIRequest {
+	chatRequest := newChatRequest(request.Model, IsStream(request.Stream), request.Format, request.Options)
+	if request.System != "" {
+		chatRequest.Messages = append(chatRequest.Messages, model.Message{Role: "system", Content: request.System})
+	}
+	chatRequest.Messages = append(chatRequest.Messages, model.Message{
+		Role:    "user",
+		Content: messageContent(request.Prompt, request.Images),
+	})
+	return chatRequest
+}
+
+// ConvertInboundEmbeddingRequest converts an /api/embed request into an embeddings request
+func ConvertInboundEmbeddingRequest(request *InboundEmbeddingRequest) *model.GeneralOpenAIRequest {
+	return &model.GeneralOpenAIRequest{
+		Model: request.Model,
+		Input: request.Input,
+	}
+}
+
+func doneReasonOpenAI2Ollama(reason string) string {
+	if reason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+func toolCallOpenAI2Ollama(name string, arguments any) ToolCall {
+	args := make(map[string]any)
+	if argumentsString, ok := arguments.(string); ok && argumentsString != "" {
+		_ = json.Unmarshal([]byte(argumentsString), &args)
+	}
+	return ToolCall{Function: ToolCallFunction{Name: name, Arguments: args}}
+}
+
+func createdAt() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// ResponseOpenAI2Ollama converts a chat completion into an /api/chat or, with generate set, an /api/generate response
+func ResponseOpenAI2Ollama(response *openai.TextResponse, generate bool) *ChatResponse {
+	ollamaResponse := ChatResponse{
+		Model:           response.Model,
+		CreatedAt:       createdAt(),
+		Done:            true,
+		DoneReason:      "stop",
+		PromptEvalCount: response.Usage.PromptTokens,
+		EvalCount:       response.Usage.CompletionTokens,
+	}
+	if len(response.Choices) == 0 {
+		return &ollamaResponse
+	}
+	choice := response.Choices[0]
+	ollamaResponse.DoneReason = doneReasonOpenAI2Ollama(choice.FinishReason)
+	if generate {
+		ollamaResponse.Response = choice.Message.StringContent()
+		return &ollamaResponse
+	}
+	ollamaResponse.Message = Message{Role: "assistant", Content: choice.Message.StringContent()}
+	for _, toolCall := range choice.Message.ToolCalls {
+		ollamaResponse.Message.ToolCalls = append(ollamaResponse.Message.ToolCalls,
+			toolCallOpenAI2Ollama(toolCall.Function.Name, toolCall.Function.Arguments))
+	}
+	return &ollamaResponse
+}
+
+// MarshalResponse encodes a response of /api/chat, or of /api/generate which has no message
+func MarshalResponse(response *ChatResponse, generate bool) ([]byte, error) {
+	if !generate {
+		return json.Marshal(response)
+	}
+	return json.Marshal(GenerateResponse{
+		Model:           response.Model,
+		CreatedAt:       response.CreatedAt,
+		Response:        response.Response,
+		Done:            response.Done,
+		DoneReason:      response.DoneReason,
+		PromptEvalCount: response.PromptEvalCount,
+		EvalCount:       response.EvalCount,
+	})
+}
+
+// EmbeddingResponseOpenAI2Ollama converts an embeddings response into an /api/embed response
+func EmbeddingResponseOpenAI2Ollama(response *openai.EmbeddingResponse) *EmbeddingResponse {
+	ollamaResponse := EmbeddingResponse{
+		Model:           response.Model,
+		Embeddings:      make([][]float64, 0, len(response.Data)),
+		PromptEvalCount: response.PromptTokens,
+	}
+	for _, item := range response.Data {
+		ollamaResponse.Embeddings = append(ollamaResponse.Embeddings, item.Embedding)
+	}
+	return &ollamaResponse
+}
+
+type streamToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// StreamConverter turns chat completion chunks into the newline delimited
+// JSON stream of Ollama. Tool calls are sent whole, so their arguments are
+// buffered until the upstream stream is done.
+type StreamConverter struct {
+	Model        string
+	Generate     bool
+	toolCalls    []*streamToolCall
+	finishReason string
+	usage        *model.Usage
+}
+
+// Convert converts one chat completion chunk, returning nil when there is nothing to send yet
+func (s *StreamConverter) Convert(chunk *openai.ChatCompletionsStreamResponse) *ChatResponse {
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	var text string
+	for _, choice := range chunk.Choices {
+		// Ollama has no n parameter, only the first choice is relayed
+		if choice.Index != 0 {
+			continue
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			if toolCall.Function.Name != "" || len(s.toolCalls) == 0 {
+				s.toolCalls = append(s.toolCalls, &streamToolCall{name: toolCall.Function.Name})
+			}
+			if arguments, ok := toolCall.Function.Arguments.(string); ok {
+				s.toolCalls[len(s.toolCalls)-1].arguments.WriteString(arguments)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+		text += choice.Delta.StringContent()
+	}
+	if text == "" {
+		return nil
+	}
+	response := ChatResponse{Model: s.Model, CreatedAt: createdAt()}
+	if s.Generate {
+		response.Response = text
+	} else {
+		response.Message = Message{Role: "assistant", Content: text}
+	}
+	return &response
+}
+
+// Finish returns the final chunk once the upstream stream is done
+func (s *StreamConverter) Finish() *ChatResponse {
+	response := ChatResponse{
+		Model:      s.Model,
+		CreatedAt:  createdAt(),
+		Done:       true,
+		DoneReason: doneReasonOpenAI2Ollama(s.finishReason),
+	}
+	if s.usage != nil {
+		response.PromptEvalCount = s.usage.PromptTokens
+		response.EvalCount = s.usage.CompletionTokens
+	}
+	if !s.Generate {
+		response.Message = Message{Role: "assistant"}
+		for _, toolCall := range s.toolCalls {
+			response.Message.ToolCalls = append(response.Message.ToolCalls,
+				toolCallOpenAI2Ollama(toolCall.name, toolCall.arguments.String()))
+		}
+	}
+	return &response
+}
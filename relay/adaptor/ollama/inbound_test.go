@@ -0,0 +1,235 @@
+package ollama
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func TestConvertInboundChatRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "stream by default",
+			request: `{"model":"llama3","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+			want: `{"model":"llama3","stream":true,"stream_options":{"include_usage":true},
+				"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "options and format",
+			request: `{"model":"llama3","stream":false,"format":"json","messages":[{"role":"user","content":"hi"}],
+				"options":{"seed":42,"temperature":0.5,"top_k":5,"num_predict":100,"num_ctx":4096,"stop":["END"]}}`,
+			want: `{"model":"llama3","response_format":{"type":"json_object"},"seed":42,"temperature":0.5,"top_k":5,
+				"max_tokens":100,"num_ctx":4096,"stop":["END"],"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:    "json schema format",
+			request: `{"model":"llama3","stream":false,"format":{"type":"object"},"messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"llama3","response_format":{"type":"json_schema","json_schema":{"name":"response","schema":{"type":"object"}}},
+				"messages":[{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name:    "images",
+			request: `{"model":"llava","stream":false,"messages":[{"role":"user","content":"what is this?","images":["iVBORw0KGgo=","AAAA"]}]}`,
+			want: `{"model":"llava","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+				{"type":"image_url","text":"","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},
+				{"type":"image_url","text":"","image_url":{"url":"data:image/jpeg;base64,AAAA"}}]}]}`,
+		},
+		{
+			name: "tool calls",
+			request: `{"model":"llama3","stream":false,
+				"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],
+				"messages":[{"role":"user","content":"weather in Paris and Rome?"},
+					{"role":"assistant","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}},
+						{"function":{"name":"get_weather","arguments":{"city":"Rome"}}}]},
+					{"role":"tool","content":"sunny"},{"role":"tool","content":"rainy"}]}`,
+			want: `{"model":"llama3","tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],
+				"messages":[{"role":"user","content":"weather in Paris and Rome?"},
+					{"role":"assistant","tool_calls":[
+						{"id":"call_1_0","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}},
+						{"id":"call_1_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Rome\"}"}}]},
+					{"role":"tool","content":"sunny","tool_call_id":"call_1_0"},
+					{"role":"tool","content":"rainy","tool_call_id":"call_1_1"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request InboundChatRequest
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := ConvertInboundChatRequest(&request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+		})
+	}
+
+	request := InboundChatRequest{Model: "llama3", Messages: []Message{{Role: "user", Content: "hi"}, {Role: "tool", Content: "sunny"}}}
+	if _, err := ConvertInboundChatRequest(&request); err == nil {
+		t.Error("tool message without a preceding tool call should be rejected")
+	}
+}
+
+func TestConvertGenerateRequest(t *testing.T) {
+	var request GenerateRequest
+	if err := json.Unmarshal([]byte(`{"model":"llama3","prompt":"hi","system":"be brief","stream":false,"options":{"num_predict":10}}`), &request); err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := json.Marshal(ConvertGenerateRequest(&request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{"model":"llama3","max_tokens":10,"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`, string(gotJSON))
+}
+
+func TestResponseOpenAI2Ollama(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		generate bool
+		want     string
+	}{
+		{
+			name:     "chat",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			want: `{"model":"gpt-4o","message":{"role":"assistant","content":"hello"},"done":true,"done_reason":"stop",
+				"prompt_eval_count":3,"eval_count":1}`,
+		},
+		{
+			name: "tool calls",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"",
+				"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},"finish_reason":"tool_calls"}],
+				"usage":{"prompt_tokens":10,"completion_tokens":5}}`,
+			want: `{"model":"gpt-4o","message":{"role":"assistant","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}]},
+				"done":true,"done_reason":"stop","prompt_eval_count":10,"eval_count":5}`,
+		},
+		{
+			name:     "generate",
+			response: `{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"hel"},"finish_reason":"length"}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`,
+			generate: true,
+			want:     `{"model":"gpt-4o","created_at":"","response":"hel","done":true,"done_reason":"length","prompt_eval_count":3,"eval_count":1}`,
+		},
+		{
+			name:     "no choices",
+			response: `{"model":"gpt-4o","choices":[],"usage":{}}`,
+			want:     `{"model":"gpt-4o","message":{},"done":true,"done_reason":"stop"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response openai.TextResponse
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatal(err)
+			}
+			converted := ResponseOpenAI2Ollama(&response, tt.generate)
+			if converted.CreatedAt == "" {
+				t.Error("created_at should be set")
+			}
+			converted.CreatedAt = ""
+			data, err := MarshalResponse(converted, tt.generate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestEmbeddingResponseOpenAI2Ollama(t *testing.T) {
+	var response openai.EmbeddingResponse
+	if err := json.Unmarshal([]byte(`{"model":"text-embedding-3-small","data":[{"embedding":[0.1,0.2]},{"embedding":[0.3]}],"usage":{"prompt_tokens":4}}`), &response); err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, err := json.Marshal(EmbeddingResponseOpenAI2Ollama(&response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{"model":"text-embedding-3-small","embeddings":[[0.1,0.2],[0.3]],"prompt_eval_count":4}`, string(gotJSON))
+}
+
+func TestStreamConverter(t *testing.T) {
+	tests := []struct {
+		name     string
+		generate bool
+		chunks   []string
+		want     []string
+	}{
+		{
+			name: "chat",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"},{"index":1,"delta":{"content":"ignored"}}]}`,
+				`{"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+			},
+			want: []string{
+				`{"model":"llama3","message":{"role":"assistant","content":"Hel"}}`,
+				`{"model":"llama3","message":{"role":"assistant","content":"lo"}}`,
+				`{"model":"llama3","message":{"role":"assistant"},"done":true,"done_reason":"stop","prompt_eval_count":3,"eval_count":2}`,
+			},
+		},
+		{
+			name: "tool calls",
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\""}}]}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"Paris\"}"}}]}}]}`,
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`,
+			},
+			want: []string{
+				`{"model":"llama3","message":{"role":"assistant","tool_calls":[{"function":{"name":"get_weather","arguments":{"city":"Paris"}}},
+					{"function":{"name":"get_time","arguments":{}}}]},"done":true,"done_reason":"stop"}`,
+			},
+		},
+		{
+			name:     "generate",
+			generate: true,
+			chunks: []string{
+				`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"hel"},"finish_reason":"length"}]}`,
+				`{"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`,
+			},
+			want: []string{
+				`{"model":"llama3","created_at":"","response":"hel","done":false}`,
+				`{"model":"llama3","created_at":"","response":"","done":true,"done_reason":"length","prompt_eval_count":3,"eval_count":1}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := &StreamConverter{Model: "llama3", Generate: tt.generate}
+			var responses []*ChatResponse
+			for _, data := range tt.chunks {
+				var chunk openai.ChatCompletionsStreamResponse
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatal(err)
+				}
+				if response := converter.Convert(&chunk); response != nil {
+					responses = append(responses, response)
+				}
+			}
+			responses = append(responses, converter.Finish())
+			if len(responses) != len(tt.want) {
+				t.Fatalf("got %d responses, want %d", len(responses), len(tt.want))
+			}
+			for i, response := range responses {
+				response.CreatedAt = ""
+				data, err := MarshalResponse(response, tt.generate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.JSONEq(t, tt.want[i], string(data))
+			}
+		})
+	}
+}
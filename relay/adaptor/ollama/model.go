@@ -9,12 +9,23 @@ type Options struct {
 	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
 	NumPredict       int      `json:"num_predict,omitempty"`
 	NumCtx           int      `json:"num_ctx,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+}
+
+type ToolCallFunction struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
 }
 
 type Message struct {
-	Role    string   `json:"role,omitempty"`
-	Content string   `json:"content,omitempty"`
-	Images  []string `json:"images,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	Images    []string   `json:"images,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type ChatRequest struct {
@@ -30,6 +41,7 @@ type ChatResponse struct {
 	Message         Message `json:"message,omitempty"`
 	Response        string  `json:"response,omitempty"` // for stream response
 	Done            bool    `json:"done,omitempty"`
+	DoneReason      string  `json:"done_reason,omitempty"`
 	TotalDuration   int     `json:"total_duration,omitempty"`
 	LoadDuration    int     `json:"load_duration,omitempty"`
 	PromptEvalCount int     `json:"prompt_eval_count,omitempty"`
@@ -47,7 +59,8 @@ type EmbeddingRequest struct {
 }
 
 type EmbeddingResponse struct {
-	Error      string      `json:"error,omitempty"`
-	Model      string      `json:"model"`
-	Embeddings [][]float64 `json:"embeddings"`
+	Error           string      `json:"error,omitempty"`
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
 }
@@ -0,0 +1,94 @@
+package openai
+
+import (
+	"errors"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// CompletionsRequest2Chat turns a legacy completion request into a chat completion
+// request with the prompt as its only user message, for channels serving chat only
+func CompletionsRequest2Chat(request *model.GeneralOpenAIRequest) (*model.GeneralOpenAIRequest, error) {
+	prompt, err := completionsPrompt(request.Prompt)
+	if err != nil {
+		return nil, err
+	}
+	chatRequest := *request
+	chatRequest.Prompt = nil
+	chatRequest.Messages = []model.Message{
+		{
+			Role:    "user",
+			Content: prompt,
+		},
+	}
+	return &chatRequest, nil
+}
+
+func completionsPrompt(prompt any) (string, error) {
+	switch v := prompt.(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case []any:
+		if len(v) == 1 {
+			if text, ok := v[0].(string); ok && text != "" {
+				return text, nil
+			}
+		}
+		if len(v) > 1 {
+			return "", errors.New("a chat model accepts a single prompt per request")
+		}
+	}
+	return "", errors.New("field prompt must be a text prompt")
+}
+
+// ResponseChat2Completions converts a chat completion into a text_completion object
+func ResponseChat2Completions(response *TextResponse) *CompletionsResponse {
+	completionsResponse := CompletionsResponse{
+		Id:      response.Id,
+		Object:  "text_completion",
+		Created: response.Created,
+		Model:   response.Model,
+		Choices: make([]CompletionsChoice, 0, len(response.Choices)),
+		Usage:   &response.Usage,
+	}
+	for _, choice := range response.Choices {
+		finishReason := choice.FinishReason
+		completionsResponse.Choices = append(completionsResponse.Choices, CompletionsChoice{
+			Index:        choice.Index,
+			Text:         choice.Message.StringContent(),
+			FinishReason: &finishReason,
+		})
+	}
+	return &completionsResponse
+}
+
+// StreamResponseChat2Completions converts a chat completion chunk into a text_completion
+// chunk, it returns nil for chunks carrying nothing a completion client can use
+func StreamResponseChat2Completions(response *ChatCompletionsStreamResponse) *CompletionsResponse {
+	completionsResponse := CompletionsResponse{
+		Id:      response.Id,
+		Object:  "text_completion",
+		Created: response.Created,
+		Model:   response.Model,
+		Choices: make([]CompletionsChoice, 0, len(response.Choices)),
+		Usage:   response.Usage,
+	}
+	for _, choice := range response.Choices {
+		text := choice.Delta.StringContent()
+		if text == "" && choice.FinishReason == nil {
+			// the role of the first chunk has no counterpart
+			continue
+		}
+		completionsResponse.Choices = append(completionsResponse.Choices, CompletionsChoice{
+			Index:        choice.Index,
+			Text:         text,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	if len(completionsResponse.Choices) == 0 && completionsResponse.Usage == nil {
+		return nil
+	}
+	return &completionsResponse
+}
@@ -0,0 +1,170 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestCompletionsRequest2Chat(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "string prompt",
+			request: `{"model":"gpt-4o","prompt":"Say this is a test","max_tokens":7,"temperature":0,"stream":true,"stop":["\n"]}`,
+			want:    `{"model":"gpt-4o","messages":[{"role":"user","content":"Say this is a test"}],"max_tokens":7,"temperature":0,"stream":true,"stop":["\n"]}`,
+		},
+		{
+			name:    "single prompt in a list",
+			request: `{"model":"gpt-4o","prompt":["Say this is a test"]}`,
+			want:    `{"model":"gpt-4o","messages":[{"role":"user","content":"Say this is a test"}]}`,
+		},
+		{
+			name:    "several prompts",
+			request: `{"model":"gpt-4o","prompt":["a","b"]}`,
+			wantErr: true,
+		},
+		{
+			name:    "token prompt",
+			request: `{"model":"gpt-4o","prompt":[1,2,3]}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty prompt",
+			request: `{"model":"gpt-4o","prompt":""}`,
+			wantErr: true,
+		},
+		{
+			name:    "no prompt",
+			request: `{"model":"gpt-4o"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request model.GeneralOpenAIRequest
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			chatRequest, err := CompletionsRequest2Chat(&request)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", chatRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, err := json.Marshal(chatRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+			if request.Prompt == nil {
+				t.Error("the original request should keep its prompt")
+			}
+		})
+	}
+}
+
+func TestResponseChat2Completions(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name: "choices",
+			response: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4o",
+				"choices":[{"index":0,"message":{"role":"assistant","content":"This is a test"},"finish_reason":"stop"},
+					{"index":1,"message":{"role":"assistant","content":"This is"},"finish_reason":"length"}],
+				"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`,
+			want: `{"id":"chatcmpl-1","object":"text_completion","created":1,"model":"gpt-4o",
+				"choices":[{"index":0,"text":"This is a test","logprobs":null,"finish_reason":"stop"},
+					{"index":1,"text":"This is","logprobs":null,"finish_reason":"length"}],
+				"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`,
+		},
+		{
+			name:     "no choices",
+			response: `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4o","choices":[],"usage":{}}`,
+			want: `{"id":"chatcmpl-1","object":"text_completion","created":1,"model":"gpt-4o","choices":[],
+				"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response TextResponse
+			if err := json.Unmarshal([]byte(tt.response), &response); err != nil {
+				t.Fatal(err)
+			}
+			gotJSON, err := json.Marshal(ResponseChat2Completions(&response))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+		})
+	}
+}
+
+func TestStreamResponseChat2Completions(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk string
+		// want is empty when the chunk should be dropped
+		want string
+	}{
+		{
+			name:  "role",
+			chunk: `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		},
+		{
+			name:  "text",
+			chunk: `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"This"}}]}`,
+			want: `{"id":"chatcmpl-1","object":"text_completion","created":1,"model":"gpt-4o",
+				"choices":[{"index":0,"text":"This","logprobs":null,"finish_reason":null}]}`,
+		},
+		{
+			name:  "finish",
+			chunk: `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			want: `{"id":"chatcmpl-1","object":"text_completion","created":1,"model":"gpt-4o",
+				"choices":[{"index":0,"text":"","logprobs":null,"finish_reason":"stop"}]}`,
+		},
+		{
+			name:  "usage",
+			chunk: `{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`,
+			want: `{"id":"chatcmpl-1","object":"text_completion","created":1,"model":"gpt-4o","choices":[],
+				"usage":{"prompt_tokens":5,"completion_tokens":6,"total_tokens":11}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunk ChatCompletionsStreamResponse
+			if err := json.Unmarshal([]byte(tt.chunk), &chunk); err != nil {
+				t.Fatal(err)
+			}
+			converted := StreamResponseChat2Completions(&chunk)
+			if tt.want == "" {
+				if converted != nil {
+					t.Errorf("chunk should be dropped, got %+v", converted)
+				}
+				return
+			}
+			if converted == nil {
+				t.Fatal("chunk should be converted")
+			}
+			gotJSON, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.JSONEq(t, tt.want, string(gotJSON))
+		})
+	}
+}
@@ -2,8 +2,11 @@ package openai
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 
+	"github.com/gin-gonic/gin"
+
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -13,6 +16,7 @@ func ResponseText2Usage(responseText string, modelName string, promptTokens int)
 	usage.PromptTokens = promptTokens
 	usage.CompletionTokens = CountTokenText(responseText, modelName)
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.Estimated = true
 	return usage
 }
 
@@ -32,3 +36,14 @@ func GetFullRequestURL(baseURL string, requestURL string, channelType int) strin
 	}
 	return fullRequestURL
 }
+
+// CopyResponseHeaders copies the headers of the upstream response to the client, except the
+// rate limits of the upstream account when the ones of the token are already set
+func CopyResponseHeaders(c *gin.Context, resp *http.Response) {
+	for k, v := range resp.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-ratelimit-") && c.Writer.Header().Get(k) != "" {
+			continue
+		}
+		c.Writer.Header().Set(k, v[0])
+	}
+}
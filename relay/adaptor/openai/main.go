@@ -123,9 +123,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	// And then we will have to send an error response, but in this case, the header has already been set.
 	// So the HTTPClient will be confused by the response.
 	// For example, Postman will report error, and we cannot check the response at all.
-	for k, v := range resp.Header {
-		c.Writer.Header().Set(k, v[0])
-	}
+	CopyResponseHeaders(c, resp)
 	c.Writer.WriteHeader(resp.StatusCode)
 	_, err = io.Copy(c.Writer, resp.Body)
 	if err != nil {
@@ -145,6 +143,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
 			TotalTokens:      promptTokens + completionTokens,
+			Estimated:        true,
 		}
 	}
 	return nil, &textResponse.Usage
@@ -137,6 +137,24 @@ type ChatCompletionsStreamResponse struct {
 	Usage   *model.Usage                          `json:"usage,omitempty"`
 }
 
+type CompletionsChoice struct {
+	Index        int     `json:"index"`
+	Text         string  `json:"text"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// CompletionsResponse is the text_completion object of the legacy completions api,
+// stream chunks have the same shape
+type CompletionsResponse struct {
+	Id      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []CompletionsChoice `json:"choices"`
+	Usage   *model.Usage        `json:"usage,omitempty"`
+}
+
 type CompletionsStreamResponse struct {
 	Choices []struct {
 		Text         string `json:"text"`
@@ -0,0 +1,46 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+// GetRealtimeURL returns the WebSocket url of the realtime endpoint of the channel
+// https://platform.openai.com/docs/guides/realtime-websocket
+// https://learn.microsoft.com/en-us/azure/ai-services/openai/how-to/realtime-audio-websockets
+func GetRealtimeURL(meta *meta.Meta) (string, error) {
+	var fullRequestURL string
+	switch meta.ChannelType {
+	case channeltype.OpenAI:
+		fullRequestURL = GetFullRequestURL(meta.BaseURL, "/v1/realtime?model="+url.QueryEscape(meta.ActualModelName), meta.ChannelType)
+	case channeltype.Azure:
+		fullRequestURL = fmt.Sprintf("%s/openai/realtime?api-version=%s&deployment=%s",
+			strings.TrimSuffix(meta.BaseURL, "/"), meta.Config.APIVersion, url.QueryEscape(meta.ActualModelName))
+	default:
+		return "", fmt.Errorf("channel type %d does not support the realtime api", meta.ChannelType)
+	}
+	switch {
+	case strings.HasPrefix(fullRequestURL, "https://"):
+		fullRequestURL = "wss://" + strings.TrimPrefix(fullRequestURL, "https://")
+	case strings.HasPrefix(fullRequestURL, "http://"):
+		fullRequestURL = "ws://" + strings.TrimPrefix(fullRequestURL, "http://")
+	}
+	return fullRequestURL, nil
+}
+
+// GetRealtimeHeader returns the headers used to open the upstream realtime session
+func GetRealtimeHeader(meta *meta.Meta) http.Header {
+	header := http.Header{}
+	if meta.ChannelType == channeltype.Azure {
+		header.Set("api-key", meta.APIKey)
+		return header
+	}
+	header.Set("Authorization", "Bearer "+meta.APIKey)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	return header
+}
@@ -0,0 +1,63 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+)
+
+func TestGetRealtimeURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		meta    meta.Meta
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "openai",
+			meta: meta.Meta{ChannelType: channeltype.OpenAI, BaseURL: "https://api.openai.com", ActualModelName: "gpt-4o-realtime-preview"},
+			want: "wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview",
+		},
+		{
+			name: "openai over http",
+			meta: meta.Meta{ChannelType: channeltype.OpenAI, BaseURL: "http://localhost:8080", ActualModelName: "gpt-4o-realtime-preview"},
+			want: "ws://localhost:8080/v1/realtime?model=gpt-4o-realtime-preview",
+		},
+		{
+			name: "azure",
+			meta: meta.Meta{ChannelType: channeltype.Azure, BaseURL: "https://example.openai.azure.com/", ActualModelName: "my realtime",
+				Config: model.ChannelConfig{APIVersion: "2024-10-01-preview"}},
+			want: "wss://example.openai.azure.com/openai/realtime?api-version=2024-10-01-preview&deployment=my+realtime",
+		},
+		{
+			name:    "unsupported",
+			meta:    meta.Meta{ChannelType: channeltype.Anthropic, BaseURL: "https://api.anthropic.com", ActualModelName: "claude-3-5-sonnet"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRealtimeURL(&tt.meta)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetRealtimeHeader(t *testing.T) {
+	header := GetRealtimeHeader(&meta.Meta{ChannelType: channeltype.OpenAI, APIKey: "sk-key"})
+	assert.Equal(t, "Bearer sk-key", header.Get("Authorization"))
+	assert.Equal(t, "realtime=v1", header.Get("OpenAI-Beta"))
+
+	header = GetRealtimeHeader(&meta.Meta{ChannelType: channeltype.Azure, APIKey: "key"})
+	assert.Equal(t, "key", header.Get("api-key"))
+	assert.Empty(t, header.Get("Authorization"))
+}
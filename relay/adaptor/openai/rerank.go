@@ -0,0 +1,68 @@
+package openai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankHandler relays a Cohere or Jina style rerank response, SiliconFlow and
+// Xinference answer in the Cohere shape with the token counts in meta.tokens
+func RerankHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if rerankResponse.Model == "" {
+		rerankResponse.Model = modelName
+	}
+	if rerankResponse.Usage == nil || rerankResponse.Usage.TotalTokens == 0 {
+		rerankResponse.Usage = rerankUsage(rerankResponse.Meta)
+	}
+	jsonResponse, err := json.Marshal(rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, err = c.Writer.Write(jsonResponse)
+	if err != nil {
+		return ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError), nil
+	}
+	return nil, rerankResponse.Usage
+}
+
+// rerankUsage reads the token counts of the Cohere shape, it is nil when the upstream reports none
+func rerankUsage(meta *model.RerankMeta) *model.Usage {
+	if meta == nil {
+		return nil
+	}
+	var inputTokens, outputTokens int
+	if meta.Tokens != nil {
+		inputTokens, outputTokens = meta.Tokens.InputTokens, meta.Tokens.OutputTokens
+	}
+	if inputTokens == 0 && meta.BilledUnits != nil {
+		inputTokens, outputTokens = meta.BilledUnits.InputTokens, meta.BilledUnits.OutputTokens
+	}
+	if inputTokens+outputTokens == 0 {
+		return nil
+	}
+	return &model.Usage{
+		PromptTokens:     inputTokens,
+		CompletionTokens: outputTokens,
+		TotalTokens:      inputTokens + outputTokens,
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
 )
 
 // tokenEncoderMap won't grow after initialization
@@ -46,10 +47,19 @@ func InitTokenEncoders() {
 			tokenEncoderMap[model] = nil
 		}
 	}
+	tokenizer.Init()
 	logger.SysLog("token encoders initialized")
 }
 
-func getTokenEncoder(model string) *tiktoken.Tiktoken {
+// getTokenEncoder returns the tokenizer of the model family, tiktoken for OpenAI models
+func getTokenEncoder(model string) tokenizer.Tokenizer {
+	if familyTokenizer := tokenizer.Get(model); familyTokenizer != nil {
+		return familyTokenizer
+	}
+	return tokenizer.Tiktoken{Tiktoken: getTiktokenEncoder(model)}
+}
+
+func getTiktokenEncoder(model string) *tiktoken.Tiktoken {
 	tokenEncoder, ok := tokenEncoderMap[model]
 	if ok && tokenEncoder != nil {
 		return tokenEncoder
@@ -66,11 +76,17 @@ func getTokenEncoder(model string) *tiktoken.Tiktoken {
 	return defaultTokenEncoder
 }
 
-func getTokenNum(tokenEncoder *tiktoken.Tiktoken, text string) int {
+// IsTokenCountExact tells whether the tokens of the model are counted with its own
+// tokenizer, rather than estimated from the characters
+func IsTokenCountExact(model string) bool {
+	return !config.ApproximateTokenEnabled && getTokenEncoder(model).Name() != "heuristic"
+}
+
+func getTokenNum(tokenEncoder tokenizer.Tokenizer, text string) int {
 	if config.ApproximateTokenEnabled {
 		return int(float64(len(text)) * 0.38)
 	}
-	return len(tokenEncoder.Encode(text, nil, nil))
+	return tokenEncoder.Count(text)
 }
 
 func CountTokenMessages(messages []model.Message, model string) int {
@@ -124,6 +140,7 @@ func CountTokenMessages(messages []model.Message, model string) int {
 			}
 		}
 		tokenNum += getTokenNum(tokenEncoder, message.Role)
+		tokenNum += countTokenToolCalls(tokenEncoder, message.ToolCalls)
 		if message.Name != nil {
 			tokenNum += tokensPerName
 			tokenNum += getTokenNum(tokenEncoder, *message.Name)
@@ -0,0 +1,150 @@
+package openai
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+)
+
+// Tool definitions are rendered into the system prompt as a typescript namespace,
+// the overhead of each part follows
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+type toolTokenOverhead struct {
+	funcInit int // every function
+	propInit int // the parameters of a function which has any
+	propKey  int // every parameter
+	enumInit int // a parameter with an enum list
+	enumItem int // every enum item
+	funcEnd  int // once after all the functions
+}
+
+var cl100kToolTokenOverhead = toolTokenOverhead{funcInit: 10, propInit: 3, propKey: 3, enumInit: -3, enumItem: 3, funcEnd: 12}
+var o200kToolTokenOverhead = toolTokenOverhead{funcInit: 7, propInit: 3, propKey: 3, enumInit: -3, enumItem: 3, funcEnd: 12}
+
+// tokensPerToolCall covers the framing of a tool call of an assistant message around its name and arguments
+const tokensPerToolCall = 3
+
+var o200kModelPrefixes = []string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "o1", "o3", "o4"}
+
+func getToolTokenOverhead(model string) toolTokenOverhead {
+	for _, prefix := range o200kModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return o200kToolTokenOverhead
+		}
+	}
+	return cl100kToolTokenOverhead
+}
+
+// CountTokenTools counts the tokens of the tool definitions of a chat request,
+// the legacy functions are counted the same way
+func CountTokenTools(tools []model.Tool, functions any, modelName string) int {
+	var definitions []model.Function
+	for _, tool := range tools {
+		definitions = append(definitions, tool.Function)
+	}
+	if functions != nil {
+		var legacyFunctions []model.Function
+		data, err := json.Marshal(functions)
+		if err == nil {
+			err = json.Unmarshal(data, &legacyFunctions)
+		}
+		if err != nil {
+			logger.SysError("error parsing functions: " + err.Error())
+		}
+		definitions = append(definitions, legacyFunctions...)
+	}
+	return countTokenFunctions(getTokenEncoder(modelName), definitions, getToolTokenOverhead(modelName))
+}
+
+func countTokenFunctions(tokenEncoder tokenizer.Tokenizer, functions []model.Function, overhead toolTokenOverhead) int {
+	if len(functions) == 0 {
+		return 0
+	}
+	tokenNum := 0
+	for _, function := range functions {
+		tokenNum += overhead.funcInit
+		tokenNum += getTokenNum(tokenEncoder, function.Name+":"+strings.TrimSuffix(function.Description, "."))
+		parameters, _ := function.Parameters.(map[string]any)
+		tokenNum += countTokenProperties(tokenEncoder, parameters, overhead)
+	}
+	tokenNum += overhead.funcEnd
+	return tokenNum
+}
+
+// countTokenProperties counts the properties of an object schema, nested objects
+// and arrays of objects are counted as if their properties were at the top level
+func countTokenProperties(tokenEncoder tokenizer.Tokenizer, schema map[string]any, overhead toolTokenOverhead) int {
+	properties, _ := schema["properties"].(map[string]any)
+	if len(properties) == 0 {
+		return 0
+	}
+	tokenNum := overhead.propInit
+	for name, value := range properties {
+		tokenNum += overhead.propKey
+		property, _ := value.(map[string]any)
+		if enum, ok := property["enum"].([]any); ok {
+			tokenNum += overhead.enumInit
+			for _, item := range enum {
+				tokenNum += overhead.enumItem
+				if itemString, ok := item.(string); ok {
+					tokenNum += getTokenNum(tokenEncoder, itemString)
+				} else if data, err := json.Marshal(item); err == nil {
+					tokenNum += getTokenNum(tokenEncoder, string(data))
+				}
+			}
+		}
+		propertyType, _ := property["type"].(string)
+		description, _ := property["description"].(string)
+		tokenNum += getTokenNum(tokenEncoder, name+":"+propertyType+":"+strings.TrimSuffix(description, "."))
+		tokenNum += countTokenProperties(tokenEncoder, property, overhead)
+		if items, ok := property["items"].(map[string]any); ok {
+			tokenNum += countTokenProperties(tokenEncoder, items, overhead)
+		}
+	}
+	return tokenNum
+}
+
+// countTokenToolCalls counts the tool calls of an assistant message
+func countTokenToolCalls(tokenEncoder tokenizer.Tokenizer, toolCalls []model.Tool) int {
+	tokenNum := 0
+	for _, toolCall := range toolCalls {
+		tokenNum += tokensPerToolCall
+		tokenNum += getTokenNum(tokenEncoder, toolCall.Function.Name)
+		switch arguments := toolCall.Function.Arguments.(type) {
+		case nil:
+		case string:
+			tokenNum += getTokenNum(tokenEncoder, arguments)
+		default:
+			if data, err := json.Marshal(arguments); err == nil {
+				tokenNum += getTokenNum(tokenEncoder, string(data))
+			}
+		}
+	}
+	return tokenNum
+}
+
+// CountTokenResponseFormat counts the json schema of a structured output request,
+// which is sent to the model along with the prompt
+func CountTokenResponseFormat(responseFormat *model.ResponseFormat, modelName string) int {
+	if responseFormat == nil || responseFormat.JsonSchema == nil {
+		return 0
+	}
+	tokenEncoder := getTokenEncoder(modelName)
+	jsonSchema := responseFormat.JsonSchema
+	tokenNum := getTokenNum(tokenEncoder, jsonSchema.Name)
+	if jsonSchema.Description != "" {
+		tokenNum += getTokenNum(tokenEncoder, jsonSchema.Description)
+	}
+	if jsonSchema.Schema != nil {
+		data, err := json.Marshal(jsonSchema.Schema)
+		if err != nil {
+			logger.SysError("error marshalling json schema: " + err.Error())
+			return tokenNum
+		}
+		tokenNum += getTokenNum(tokenEncoder, string(data))
+	}
+	return tokenNum
+}
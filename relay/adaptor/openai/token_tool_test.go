@@ -0,0 +1,114 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// the example of
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+const weatherToolJSON = `[{
+	"type": "function",
+	"function": {
+		"name": "get_current_weather",
+		"description": "Get the current weather in a given location",
+		"parameters": {
+			"type": "object",
+			"properties": {
+				"location": {"type": "string", "description": "The city and state, e.g. San Francisco, CA"},
+				"unit": {"type": "string", "description": "The unit of temperature to return", "enum": ["celsius", "fahrenheit"]}
+			},
+			"required": ["location"]
+		}
+	}
+}]`
+
+var weatherMessages = []model.Message{
+	{Role: "system", Content: "You are a helpful assistant that can answer to questions about the weather."},
+	{Role: "user", Content: "What's the weather like in San Francisco?"},
+}
+
+func weatherTools(t *testing.T) []model.Tool {
+	var tools []model.Tool
+	if err := json.Unmarshal([]byte(weatherToolJSON), &tools); err != nil {
+		t.Fatal(err)
+	}
+	return tools
+}
+
+// charTokenizer counts every byte as a token so that the overhead is easy to follow
+type charTokenizer struct{}
+
+func (charTokenizer) Name() string {
+	return "char"
+}
+
+func (charTokenizer) Count(text string) int {
+	return len(text)
+}
+
+func TestCountTokenFunctions(t *testing.T) {
+	tools := weatherTools(t)
+	overhead := o200kToolTokenOverhead
+	expected := overhead.funcInit + len("get_current_weather:Get the current weather in a given location") +
+		overhead.propInit +
+		overhead.propKey + len("location:string:The city and state, e.g. San Francisco, CA") +
+		overhead.propKey + overhead.enumInit +
+		overhead.enumItem + len("celsius") + overhead.enumItem + len("fahrenheit") +
+		len("unit:string:The unit of temperature to return") +
+		overhead.funcEnd
+	got := countTokenFunctions(charTokenizer{}, []model.Function{tools[0].Function}, overhead)
+	if got != expected {
+		t.Errorf("countTokenFunctions() = %d, want %d", got, expected)
+	}
+	if got := countTokenFunctions(charTokenizer{}, nil, overhead); got != 0 {
+		t.Errorf("countTokenFunctions() without functions = %d, want 0", got)
+	}
+}
+
+func TestCountTokenToolCalls(t *testing.T) {
+	toolCalls := []model.Tool{{
+		Id:   "call_1",
+		Type: "function",
+		Function: model.Function{
+			Name:      "get_current_weather",
+			Arguments: `{"location":"Paris"}`,
+		},
+	}}
+	expected := tokensPerToolCall + len("get_current_weather") + len(`{"location":"Paris"}`)
+	if got := countTokenToolCalls(charTokenizer{}, toolCalls); got != expected {
+		t.Errorf("countTokenToolCalls() = %d, want %d", got, expected)
+	}
+}
+
+func TestCountTokenToolsKnownCounts(t *testing.T) {
+	for _, name := range []string{"gpt-3.5-turbo", "gpt-4", "gpt-4o"} {
+		if _, err := tiktoken.EncodingForModel(name); err != nil {
+			t.Skipf("token encoder of %s is not available: %s", name, err.Error())
+		}
+	}
+	InitTokenEncoders()
+	tools := weatherTools(t)
+	// the counts reported by the API in the cookbook
+	cases := map[string]int{
+		"gpt-3.5-turbo": 105,
+		"gpt-4":         105,
+		"gpt-4o":        101,
+		"gpt-4o-mini":   101,
+	}
+	for name, expected := range cases {
+		got := CountTokenMessages(weatherMessages, name) + CountTokenTools(tools, nil, name)
+		if got != expected {
+			t.Errorf("%s: prompt tokens = %d, want %d", name, got, expected)
+		}
+		// the legacy functions are formatted the same way
+		functions := []model.Function{tools[0].Function}
+		if got := CountTokenTools(nil, functions, name); got != CountTokenTools(tools, nil, name) {
+			t.Errorf("%s: functions counted %d, tools counted %d", name, got, CountTokenTools(tools, nil, name))
+		}
+	}
+}
@@ -23,11 +23,27 @@ type Adaptor struct {
 }
 
 // ConvertImageRequest implements adaptor.Adaptor.
-func (*Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	if a.meta != nil && a.meta.Mode == relaymode.ImagesEdits {
+		// replicate accepts data URLs as file inputs
+		return InpaintingImageByFlusReplicateRequest{
+			Input: FluxInpaintingInput{
+				Mask:            request.Mask,
+				Image:           request.Image,
+				Seed:            int(time.Now().UnixNano()),
+				Steps:           50,
+				Prompt:          request.Prompt,
+				Guidance:        3,
+				OutputFormat:    "png",
+				SafetyTolerance: 5,
+			},
+		}, nil
+	}
 	return DrawImageRequest{
 		Input: ImageInput{
 			Steps:           25,
 			Prompt:          request.Prompt,
+			ImagePrompt:     request.Image, // set for variations
 			Guidance:        3,
 			Seed:            int(time.Now().UnixNano()),
 			SafetyTolerance: 5,
@@ -116,7 +132,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Read
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (usage *model.Usage, err *model.ErrorWithStatusCode) {
 	switch meta.Mode {
-	case relaymode.ImagesGenerations:
+	case relaymode.ImagesGenerations,
+		relaymode.ImagesEdits,
+		relaymode.ImagesVariations:
 		err, usage = ImageHandler(c, resp)
 	case relaymode.ChatCompletions:
 		err, usage = ChatHandler(c, resp)
@@ -84,6 +84,10 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	// CogView only generates images from a prompt, zhipu has no image edit api
+	if request.Image != "" {
+		return nil, errors.New("image edits and variations are not supported by zhipu")
+	}
 	newRequest := ImageRequest{
 		Model:  request.Model,
 		Prompt: request.Prompt,
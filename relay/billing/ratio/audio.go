@@ -0,0 +1,32 @@
+package ratio
+
+import "strings"
+
+// AudioRatio is the price of an audio input token relative to a text input token
+// https://openai.com/api/pricing/
+var AudioRatio = map[string]float64{
+	"gpt-4o-realtime-preview":                 20, // $100.00 / 1M audio input tokens
+	"gpt-4o-realtime-preview-2024-10-01":      20,
+	"gpt-4o-realtime-preview-2024-12-17":      8,          // $40.00 / 1M audio input tokens
+	"gpt-4o-mini-realtime-preview":            10.0 / 0.6, // $10.00 / 1M audio input tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 10.0 / 0.6,
+}
+
+func GetAudioRatio(name string) float64 {
+	if ratio, ok := AudioRatio[name]; ok {
+		return ratio
+	}
+	if strings.HasPrefix(name, "gpt-4o-mini-realtime") {
+		return 10.0 / 0.6
+	}
+	if strings.HasPrefix(name, "gpt-4o-realtime") {
+		return 8
+	}
+	return 1
+}
+
+// GetAudioCompletionRatio returns the price of an audio output token relative to an
+// audio input token, all realtime models charge twice the input price so far
+func GetAudioCompletionRatio(name string) float64 {
+	return 2
+}
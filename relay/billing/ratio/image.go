@@ -46,6 +46,7 @@ var ImageGenerationAmounts = map[string][2]int{
 	"ali-stable-diffusion-xl":   {1, 4}, // Ali
 	"ali-stable-diffusion-v1.5": {1, 4}, // Ali
 	"wanx-v1":                   {1, 4}, // Ali
+	"wanx2.1-imageedit":         {1, 4}, // Ali
 	"cogview-3":                 {1, 1},
 	"step-1x-medium":            {1, 1},
 }
@@ -56,6 +57,7 @@ var ImagePromptLengthLimitations = map[string]int{
 	"ali-stable-diffusion-xl":   4000,
 	"ali-stable-diffusion-v1.5": 4000,
 	"wanx-v1":                   4000,
+	"wanx2.1-imageedit":         800,
 	"cogview-3":                 833,
 	"step-1x-medium":            4000,
 }
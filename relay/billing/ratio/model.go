@@ -87,6 +87,12 @@ var ModelRatio = map[string]float64{
 	"text-moderation-latest":  0.1,
 	"dall-e-2":                0.02 * USD, // $0.016 - $0.020 / image
 	"dall-e-3":                0.04 * USD, // $0.040 - $0.120 / image
+	// https://openai.com/api/pricing/ realtime, audio tokens are priced by AudioRatio on top
+	"gpt-4o-realtime-preview":                 2.5, // $5.00 / 1M text input tokens
+	"gpt-4o-realtime-preview-2024-10-01":      2.5,
+	"gpt-4o-realtime-preview-2024-12-17":      2.5,
+	"gpt-4o-mini-realtime-preview":            0.3, // $0.60 / 1M text input tokens
+	"gpt-4o-mini-realtime-preview-2024-12-17": 0.3,
 	// https://docs.anthropic.com/en/docs/about-claude/models
 	"claude-instant-1.2":         0.8 / 1000 * USD,
 	"claude-2.0":                 8.0 / 1000 * USD,
@@ -240,6 +246,7 @@ var ModelRatio = map[string]float64{
 	"ali-stable-diffusion-xl":       8.00,
 	"ali-stable-diffusion-v1.5":     8.00,
 	"wanx-v1":                       8.00,
+	"wanx2.1-imageedit":             8.00,
 	"deepseek-r1":                   0.002 * RMB,
 	"deepseek-v3":                   0.001 * RMB,
 	"deepseek-r1-distill-qwen-1.5b": 0.001 * RMB,
@@ -334,6 +341,22 @@ var ModelRatio = map[string]float64{
 	"command-light-nightly": 0.5,
 	"command-r":             0.5 / 1000 * USD,
 	"command-r-plus":        3.0 / 1000 * USD,
+	// cohere charges rerank models per search unit, a query over up to 100 documents
+	"rerank-v3.5":              0.002 * USD,
+	"rerank-english-v3.0":      0.002 * USD,
+	"rerank-multilingual-v3.0": 0.002 * USD,
+	"rerank-english-v2.0":      0.001 * USD,
+	"rerank-multilingual-v2.0": 0.001 * USD,
+	// https://jina.ai/reranker/
+	"jina-reranker-v2-base-multilingual": 0.02 * MILLI_USD,
+	"jina-reranker-v1-base-en":           0.02 * MILLI_USD,
+	"jina-reranker-v1-turbo-en":          0.02 * MILLI_USD,
+	"jina-reranker-v1-tiny-en":           0.02 * MILLI_USD,
+	"jina-colbert-v2":                    0.02 * MILLI_USD,
+	// https://siliconflow.cn/pricing
+	"BAAI/bge-reranker-v2-m3":             0,
+	"netease-youdao/bce-reranker-base_v1": 0,
+	"Pro/BAAI/bge-reranker-v2-m3":         0.09 / 1000 * RMB,
 	// https://platform.deepseek.com/api-docs/pricing/
 	"deepseek-chat":     0.14 * MILLI_USD,
 	"deepseek-reasoner": 0.55 * MILLI_USD,
@@ -0,0 +1,33 @@
+package ratio
+
+import "strings"
+
+// DocumentsPerSearchUnit is the number of documents one rerank search unit covers
+// https://docs.cohere.com/docs/rerank-2#how-is-rerank-priced
+const DocumentsPerSearchUnit = 100
+
+// SearchUnitRerankModels are billed by the number of documents instead of tokens,
+// their model ratio is the price of one search unit, the same as the image models
+var SearchUnitRerankModels = map[string]bool{
+	"rerank-v3.5":              true,
+	"rerank-english-v3.0":      true,
+	"rerank-multilingual-v3.0": true,
+	"rerank-english-v2.0":      true,
+	"rerank-multilingual-v2.0": true,
+}
+
+func IsSearchUnitRerankModel(name string) bool {
+	if SearchUnitRerankModels[name] {
+		return true
+	}
+	// cohere models served by bedrock or azure carry a vendor prefix
+	return strings.HasPrefix(name, "cohere.rerank-") || strings.HasPrefix(name, "Cohere-rerank-")
+}
+
+// GetRerankSearchUnits returns the search units needed to rerank the given number of documents
+func GetRerankSearchUnits(documents int) int {
+	if documents <= 0 {
+		return 0
+	}
+	return (documents + DocumentsPerSearchUnit - 1) / DocumentsPerSearchUnit
+}
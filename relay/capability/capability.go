@@ -0,0 +1,104 @@
+package capability
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Capability tells what a model accepts, requests asking for more are rejected
+// before they reach the upstream
+type Capability struct {
+	// ContextWindow is the number of tokens of the prompt and the completion together, 0 if unknown
+	ContextWindow int `json:"context_window"`
+	// MaxOutputTokens is the most tokens the model generates in one completion, 0 if unknown
+	MaxOutputTokens int  `json:"max_output_tokens"`
+	Vision          bool `json:"vision"`
+	Tools           bool `json:"tools"`
+	JSONMode        bool `json:"json_mode"`
+	Streaming       bool `json:"streaming"`
+}
+
+var overridesLock sync.RWMutex
+
+// overrides are set by the admin through the ModelCapabilities option, each of
+// them only replaces the fields it has, e.g. {"my-model": {"vision": true}}
+var overrides = map[string]json.RawMessage{}
+
+func ModelCapabilities2JSONString() string {
+	overridesLock.RLock()
+	defer overridesLock.RUnlock()
+	jsonBytes, err := json.Marshal(overrides)
+	if err != nil {
+		logger.SysError("error marshalling model capabilities: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelCapabilitiesByJSONString(jsonStr string) error {
+	newOverrides := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(jsonStr), &newOverrides); err != nil {
+		return err
+	}
+	for model, override := range newOverrides {
+		var capability Capability
+		if err := json.Unmarshal(override, &capability); err != nil {
+			return fmt.Errorf("invalid capabilities of model %s: %w", model, err)
+		}
+	}
+	overridesLock.Lock()
+	defer overridesLock.Unlock()
+	overrides = newOverrides
+	return nil
+}
+
+// getDefault returns the built-in capability of the model, the entry with the
+// longest matching prefix wins so that e.g. gpt-4o-mini is not taken for gpt-4
+func getDefault(model string) (Capability, bool) {
+	name := strings.ToLower(model)
+	// vendor prefixes such as "openai/" of OpenRouter
+	if idx := strings.LastIndex(name, "/"); idx >= 0 {
+		name = name[idx+1:]
+	}
+	var matched string
+	for prefix := range defaultCapabilities {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	if matched == "" {
+		return Capability{}, false
+	}
+	return defaultCapabilities[matched], true
+}
+
+// Get returns the capability of the model, false when nothing is known about it
+// in which case requests to it are not checked
+func Get(model string) (Capability, bool) {
+	capability, ok := getDefault(model)
+	overridesLock.RLock()
+	override, overridden := overrides[model]
+	overridesLock.RUnlock()
+	if !overridden {
+		return capability, ok
+	}
+	if err := json.Unmarshal(override, &capability); err != nil {
+		logger.SysError(fmt.Sprintf("invalid capabilities of model %s: %s", model, err.Error()))
+		return capability, ok
+	}
+	return capability, true
+}
+
+// GetAll returns the known capabilities of the models, unknown models are left out
+func GetAll(models []string) map[string]Capability {
+	capabilities := make(map[string]Capability)
+	for _, model := range models {
+		if capability, ok := Get(model); ok {
+			capabilities[model] = capability
+		}
+	}
+	return capabilities
+}
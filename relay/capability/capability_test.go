@@ -0,0 +1,45 @@
+package capability
+
+import "testing"
+
+func TestGetLongestPrefix(t *testing.T) {
+	cases := map[string]int{
+		"gpt-4":                      8192,
+		"gpt-4-0613":                 8192,
+		"gpt-4o-mini-2024-07-18":     128000,
+		"gpt-4-turbo-2024-04-09":     128000,
+		"openai/gpt-4.1-mini":        1047576,
+		"claude-3-5-sonnet-20241022": 200000,
+	}
+	for model, contextWindow := range cases {
+		capability, ok := Get(model)
+		if !ok || capability.ContextWindow != contextWindow {
+			t.Errorf("Get(%q) = %+v, %v, want context window %d", model, capability, ok, contextWindow)
+		}
+	}
+	if _, ok := Get("some-custom-model"); ok {
+		t.Error("unknown models should have no capability")
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	defer func() { _ = UpdateModelCapabilitiesByJSONString("{}") }()
+	err := UpdateModelCapabilitiesByJSONString(`{"o1-mini": {"tools": true}, "my-model": {"context_window": 4096, "streaming": true}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capability, _ := Get("o1-mini")
+	if !capability.Tools || capability.Vision || capability.ContextWindow != 128000 {
+		t.Errorf("override should only replace its own fields, got %+v", capability)
+	}
+	capability, ok := Get("my-model")
+	if !ok || capability.ContextWindow != 4096 || !capability.Streaming || capability.Tools {
+		t.Errorf("unexpected capability of a custom model %+v, %v", capability, ok)
+	}
+	if err = UpdateModelCapabilitiesByJSONString(`{"o1-mini": {"tools": "yes"}}`); err == nil {
+		t.Error("invalid overrides should be rejected")
+	}
+	if capability, _ = Get("o1-mini"); !capability.Tools {
+		t.Error("invalid overrides should keep the previous ones")
+	}
+}
@@ -0,0 +1,65 @@
+package capability
+
+func chat(contextWindow int, maxOutputTokens int, vision bool, tools bool, jsonMode bool) Capability {
+	return Capability{
+		ContextWindow:   contextWindow,
+		MaxOutputTokens: maxOutputTokens,
+		Vision:          vision,
+		Tools:           tools,
+		JSONMode:        jsonMode,
+		Streaming:       true,
+	}
+}
+
+// defaultCapabilities is keyed by model name prefix, see getDefault
+var defaultCapabilities = map[string]Capability{
+	// https://platform.openai.com/docs/models
+	"gpt-3.5-turbo":          chat(16385, 4096, false, true, true),
+	"gpt-3.5-turbo-0301":     chat(4096, 4096, false, false, false),
+	"gpt-3.5-turbo-0613":     chat(4096, 4096, false, true, false),
+	"gpt-3.5-turbo-16k":      chat(16385, 4096, false, true, false),
+	"gpt-3.5-turbo-instruct": chat(4096, 4096, false, false, false),
+	"gpt-4":                  chat(8192, 8192, false, true, false),
+	"gpt-4-0314":             chat(8192, 8192, false, false, false),
+	"gpt-4-32k":              chat(32768, 8192, false, true, false),
+	"gpt-4-32k-0314":         chat(32768, 8192, false, false, false),
+	"gpt-4-1106-preview":     chat(128000, 4096, false, true, true),
+	"gpt-4-0125-preview":     chat(128000, 4096, false, true, true),
+	"gpt-4-turbo-preview":    chat(128000, 4096, false, true, true),
+	"gpt-4-turbo":            chat(128000, 4096, true, true, true),
+	"gpt-4-vision-preview":   chat(128000, 4096, true, false, false),
+	"gpt-4o":                 chat(128000, 16384, true, true, true),
+	"chatgpt-4o-latest":      chat(128000, 16384, true, false, true),
+	"gpt-4.1":                chat(1047576, 32768, true, true, true),
+	"gpt-4.5-preview":        chat(128000, 16384, true, true, true),
+	"o1":                     chat(200000, 100000, true, true, true),
+	"o1-mini":                chat(128000, 65536, false, false, false),
+	"o1-preview":             chat(128000, 32768, false, false, false),
+	"o3":                     chat(200000, 100000, true, true, true),
+	"o3-mini":                chat(200000, 100000, false, true, true),
+	"o4-mini":                chat(200000, 100000, true, true, true),
+	// https://docs.anthropic.com/en/docs/about-claude/models
+	"claude-instant-1":  chat(100000, 4096, false, false, false),
+	"claude-2":          chat(100000, 4096, false, false, false),
+	"claude-2.1":        chat(200000, 4096, false, false, false),
+	"claude-3-haiku":    chat(200000, 4096, true, true, false),
+	"claude-3-sonnet":   chat(200000, 4096, true, true, false),
+	"claude-3-opus":     chat(200000, 4096, true, true, false),
+	"claude-3-5-haiku":  chat(200000, 8192, false, true, false),
+	"claude-3-5-sonnet": chat(200000, 8192, true, true, false),
+	"claude-3-7-sonnet": chat(200000, 64000, true, true, false),
+	"claude-sonnet-4":   chat(200000, 64000, true, true, false),
+	"claude-opus-4":     chat(200000, 32000, true, true, false),
+	// https://ai.google.dev/gemini-api/docs/models
+	"gemini-pro":        chat(32760, 8192, false, true, false),
+	"gemini-pro-vision": chat(16384, 2048, true, false, false),
+	"gemini-1.0-pro":    chat(32760, 8192, false, true, false),
+	"gemini-1.5-pro":    chat(2097152, 8192, true, true, true),
+	"gemini-1.5-flash":  chat(1048576, 8192, true, true, true),
+	"gemini-2.0-flash":  chat(1048576, 8192, true, true, true),
+	"gemini-2.5-pro":    chat(1048576, 65536, true, true, true),
+	"gemini-2.5-flash":  chat(1048576, 65536, true, true, true),
+	// https://api-docs.deepseek.com/quick_start/pricing
+	"deepseek-chat":     chat(64000, 8192, false, true, true),
+	"deepseek-reasoner": chat(64000, 8192, false, false, false),
+}
@@ -45,3 +45,50 @@ func ToAPIType(channelType int) int {
 
 	return apiType
 }
+
+// HasNativeCompletions reports whether the channel serves the legacy /v1/completions
+// endpoint, completion requests to any other channel are bridged to chat completions
+func HasNativeCompletions(channelType int) bool {
+	switch channelType {
+	case OpenAI,
+		API2D,
+		Azure,
+		CloseAI,
+		OpenAISB,
+		OpenAIMax,
+		OhMyGPT,
+		Custom,
+		Ails,
+		AIProxy,
+		API2GPT,
+		AIGC2D,
+		OpenRouter,
+		TogetherAI,
+		Cloudflare,
+		Proxy,
+		OpenAICompatible:
+		return true
+	}
+	return false
+}
+
+// HasNativeMultipleChoices reports whether the channel honours n > 1, which holds for
+// OpenAI, Azure and the services relaying to them. Most other OpenAI compatible vendors
+// reject or ignore n, so the choices are emulated for any channel not listed here
+func HasNativeMultipleChoices(channelType int) bool {
+	switch channelType {
+	case OpenAI,
+		Azure,
+		API2D,
+		CloseAI,
+		OpenAISB,
+		OpenAIMax,
+		OhMyGPT,
+		AIProxy,
+		API2GPT,
+		AIGC2D,
+		TogetherAI:
+		return true
+	}
+	return false
+}
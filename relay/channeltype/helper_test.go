@@ -0,0 +1,24 @@
+package channeltype
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestHasNativeMultipleChoices(t *testing.T) {
+	Convey("channels honouring n", t, func() {
+		So(HasNativeMultipleChoices(OpenAI), ShouldBeTrue)
+		So(HasNativeMultipleChoices(Azure), ShouldBeTrue)
+		So(HasNativeMultipleChoices(TogetherAI), ShouldBeTrue)
+	})
+	Convey("OpenAI compatible channels ignoring n", t, func() {
+		So(HasNativeMultipleChoices(DeepSeek), ShouldBeFalse)
+		So(HasNativeMultipleChoices(Groq), ShouldBeFalse)
+		So(HasNativeMultipleChoices(Moonshot), ShouldBeFalse)
+		So(HasNativeMultipleChoices(OpenAICompatible), ShouldBeFalse)
+	})
+	Convey("channels converting to the api of another vendor", t, func() {
+		So(HasNativeMultipleChoices(Anthropic), ShouldBeFalse)
+		So(HasNativeMultipleChoices(Gemini), ShouldBeFalse)
+	})
+}
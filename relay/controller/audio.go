@@ -214,14 +214,20 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		return RelayErrorHandler(resp)
 	}
 	succeed = true
+	usage := &relaymodel.Usage{}
+	if relayMode == relaymode.AudioSpeech {
+		usage.PromptTokens = openai.CountTokenText(ttsRequest.Input, audioModel)
+	} else {
+		usage.CompletionTokens = int(quota)
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	c.Set(ctxkey.Usage, usage)
 	quotaDelta := quota - preConsumedQuota
 	defer func(ctx context.Context) {
 		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
 	}(c.Request.Context())
 
-	for k, v := range resp.Header {
-		c.Writer.Header().Set(k, v[0])
-	}
+	openai.CopyResponseHeaders(c, resp)
 	c.Writer.WriteHeader(resp.StatusCode)
 
 	_, err = io.Copy(c.Writer, resp.Body)
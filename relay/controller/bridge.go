@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// responseBridge translates the OpenAI-shaped output of the text relay into
+// the wire format of an inbound protocol (Anthropic, Gemini, Ollama, ...).
+type responseBridge interface {
+	// convertResponse converts a complete non-stream chat completion body
+	convertResponse(body []byte) ([]byte, error)
+	// convertStreamData converts the payload of one "data: " line, "[DONE]" included
+	convertStreamData(data string) []byte
+}
+
+// streamContentTyper is implemented by bridges whose stream is not SSE
+type streamContentTyper interface {
+	streamContentType() string
+}
+
+// bridgeResponseWriter sits in front of the real writer while RelayTextHelper
+// runs, so adaptors keep writing OpenAI chat completions and the bridge
+// rewrites them for the client.
+type bridgeResponseWriter struct {
+	gin.ResponseWriter
+	bridge     responseBridge
+	isStream   bool
+	statusCode int
+	buffer     bytes.Buffer
+	pending    []byte
+}
+
+func newBridgeResponseWriter(c *gin.Context, bridge responseBridge, isStream bool) *bridgeResponseWriter {
+	return &bridgeResponseWriter{
+		ResponseWriter: c.Writer,
+		bridge:         bridge,
+		isStream:       isStream,
+	}
+}
+
+func (w *bridgeResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	if w.isStream {
+		w.setStreamHeaders()
+		w.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (w *bridgeResponseWriter) setStreamHeaders() {
+	// adaptors may set the SSE content type again before each event, so it is
+	// replaced until the header is actually sent
+	if w.ResponseWriter.Written() {
+		return
+	}
+	if typer, ok := w.bridge.(streamContentTyper); ok {
+		w.ResponseWriter.Header().Set("Content-Type", typer.streamContentType())
+	}
+}
+
+func (w *bridgeResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bridgeResponseWriter) Write(data []byte) (int, error) {
+	if !w.isStream {
+		return w.buffer.Write(data)
+	}
+	// SSE events may arrive split across several writes, so only complete lines are converted
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.pending[:idx]), "\r")
+		w.pending = w.pending[idx+1:]
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if converted := w.bridge.convertStreamData(payload); len(converted) > 0 {
+			w.setStreamHeaders()
+			if _, err := w.ResponseWriter.Write(converted); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(data), nil
+}
+
+func (w *bridgeResponseWriter) Flush() {
+	// flushing sends the header even when nothing was converted yet
+	if w.isStream {
+		w.setStreamHeaders()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finalize converts and writes the buffered non-stream response
+func (w *bridgeResponseWriter) finalize() error {
+	if w.isStream {
+		return nil
+	}
+	body := w.buffer.Bytes()
+	statusCode := w.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	converted, err := w.bridge.convertResponse(body)
+	if err != nil {
+		return err
+	}
+	// the upstream length no longer matches the converted body
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(statusCode)
+	_, err = w.ResponseWriter.Write(converted)
+	return err
+}
+
+var _ gin.ResponseWriter = (*bridgeResponseWriter)(nil)
+var _ http.Flusher = (*bridgeResponseWriter)(nil)
+
+// getInboundRequestBody returns the body as originally sent by the client.
+// Protocol bridges replace the cached request body with the converted chat
+// completion request, so retries must read the original from here.
+func getInboundRequestBody(c *gin.Context) ([]byte, error) {
+	if body, ok := c.Get(ctxkey.InboundRequestBody); ok {
+		return body.([]byte), nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(ctxkey.InboundRequestBody, body)
+	return body, nil
+}
+
+// getInboundRequestURL returns the URL as originally requested by the client,
+// for bridges that take parameters from the path or query.
+func getInboundRequestURL(c *gin.Context) *url.URL {
+	if inboundURL, ok := c.Get(ctxkey.InboundRequestURL); ok {
+		return inboundURL.(*url.URL)
+	}
+	inboundURL := *c.Request.URL
+	c.Set(ctxkey.InboundRequestURL, &inboundURL)
+	return &inboundURL
+}
+
+// setBridgedChatRequest replaces the request with an OpenAI chat completion so
+// that meta, adaptors and billing treat it exactly like /v1/chat/completions.
+func setBridgedChatRequest(c *gin.Context, body []byte) {
+	setBridgedRequest(c, "/v1/chat/completions", body)
+}
+
+// setBridgedRequest replaces the request with the OpenAI request at path
+func setBridgedRequest(c *gin.Context, path string, body []byte) {
+	getInboundRequestURL(c)
+	c.Request.URL.Path = path
+	c.Request.URL.RawQuery = ""
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Set(ctxkey.KeyRequestBody, body)
+}
+
+// relayBridgedText runs the text relay with the response bridged back into the inbound protocol
+func relayBridgedText(c *gin.Context, bridge responseBridge, isStream bool) *model.ErrorWithStatusCode {
+	originWriter := c.Writer
+	writer := newBridgeResponseWriter(c, bridge, isStream)
+	c.Writer = writer
+	bizErr := RelayTextHelper(c)
+	c.Writer = originWriter
+	if bizErr != nil {
+		return bizErr
+	}
+	if err := writer.finalize(); err != nil {
+		return openai.ErrorWrapper(err, "convert_response_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const responseCacheKeyPrefix = "response_cache:"
+
+type cachedResponse struct {
+	IsStream         bool   `json:"is_stream"`
+	ContentType      string `json:"content_type"`
+	Body             string `json:"body"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	// ChannelType is the type of the channel which answered, its model ratio prices the hits
+	ChannelType int `json:"channel_type"`
+}
+
+func isResponseCacheable(relayMode int) bool {
+	return config.ResponseCacheEnabled &&
+		(relayMode == relaymode.ChatCompletions || relayMode == relaymode.Embeddings)
+}
+
+// getResponseCacheKey hashes the request with its keys sorted, so that requests
+// differing only in formatting or the user field share one entry
+func getResponseCacheKey(c *gin.Context) (string, error) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	var request map[string]any
+	if err = json.Unmarshal(requestBody, &request); err != nil {
+		return "", err
+	}
+	delete(request, "user")
+	normalized, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	for _, part := range []string{c.Request.URL.Path, c.GetString(ctxkey.Group), c.GetString(ctxkey.RequestModel)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{'\n'})
+	}
+	hash.Write(normalized)
+	return responseCacheKeyPrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ServeCachedResponse answers the request from the response cache when the same request
+// has been answered before. On a miss it returns false and records the response, which
+// StoreCachedResponse puts in the cache once the request succeeds. The Cache-Control
+// directives no-cache and no-store of the request skip the lookup and the storing.
+func ServeCachedResponse(c *gin.Context, relayMode int) (bool, *model.ErrorWithStatusCode) {
+	if !isResponseCacheable(relayMode) {
+		return false, nil
+	}
+	key, err := getResponseCacheKey(c)
+	if err != nil {
+		return false, nil
+	}
+	cacheControl := strings.ToLower(c.Request.Header.Get("Cache-Control"))
+	if !strings.Contains(cacheControl, "no-cache") {
+		if value, ok := dbmodel.CacheGetResponse(key); ok {
+			var response cachedResponse
+			if err = json.Unmarshal([]byte(value), &response); err == nil {
+				return true, serveCachedResponse(c, &response)
+			}
+			logger.Errorf(c.Request.Context(), "invalid cached response: %s", err.Error())
+		}
+	}
+	if !strings.Contains(cacheControl, "no-store") {
+		recorder := &responseCacheRecorder{ResponseWriter: c.Writer, key: key}
+		c.Writer = recorder
+		c.Set(ctxkey.ResponseCacheRecorder, recorder)
+	}
+	return false, nil
+}
+
+func serveCachedResponse(c *gin.Context, response *cachedResponse) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	textRequest, err := getAndValidateTextRequest(c, meta.Mode)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	}
+	meta.IsStream = response.IsStream
+	meta.IsCacheHit = true
+	// no channel is involved in answering, the hit is priced as the response it repeats
+	// rather than by the channel selected for the request
+	meta.ChannelId = 0
+	if response.ChannelType != 0 {
+		meta.ChannelType = response.ChannelType
+	}
+	meta.OriginModelName = textRequest.Model
+	textRequest.Model, _ = getMappedModelName(textRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = textRequest.Model
+	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio * getBatchRatio(meta) * config.ResponseCacheRatio
+	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, response.PromptTokens, ratio, meta)
+	if bizErr != nil {
+		return bizErr
+	}
+
+	c.Header("X-Cache", "HIT")
+	if response.IsStream {
+		common.SetEventStreamHeaders(c)
+		for _, event := range strings.Split(response.Body, "\n\n") {
+			if strings.TrimSpace(event) == "" {
+				continue
+			}
+			_, _ = c.Writer.WriteString(event + "\n\n")
+			c.Writer.Flush()
+		}
+	} else {
+		c.Data(http.StatusOK, response.ContentType, []byte(response.Body))
+	}
+	logger.Infof(ctx, "served from response cache")
+
+	usage := &model.Usage{
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+		TotalTokens:      response.PromptTokens + response.CompletionTokens,
+	}
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, false)
+	return nil
+}
+
+// StoreCachedResponse puts the response recorded by ServeCachedResponse in the cache
+func StoreCachedResponse(c *gin.Context) {
+	value, ok := c.Get(ctxkey.ResponseCacheRecorder)
+	if !ok {
+		return
+	}
+	recorder := value.(*responseCacheRecorder)
+	if recorder.overflow || recorder.Status() != http.StatusOK {
+		return
+	}
+	// hits are billed by the usage of the original response
+	usage, ok := c.Get(ctxkey.Usage)
+	if !ok || usage.(*model.Usage) == nil {
+		return
+	}
+	response := cachedResponse{
+		ContentType:      recorder.Header().Get("Content-Type"),
+		Body:             recorder.body.String(),
+		PromptTokens:     usage.(*model.Usage).PromptTokens,
+		CompletionTokens: usage.(*model.Usage).CompletionTokens,
+		ChannelType:      c.GetInt(ctxkey.Channel),
+	}
+	response.IsStream = strings.HasPrefix(response.ContentType, "text/event-stream")
+	if response.IsStream && !strings.Contains(response.Body, "[DONE]") {
+		// the stream was cut short
+		return
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "failed to marshal cached response: %s", err.Error())
+		return
+	}
+	dbmodel.CacheSetResponse(recorder.key, string(data), config.ResponseCacheTTL)
+}
+
+// responseCacheRecorder keeps a copy of what is written to the client
+type responseCacheRecorder struct {
+	gin.ResponseWriter
+	key      string
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseCacheRecorder) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > config.ResponseCacheMaxSize {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+func (w *responseCacheRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func getTestResponseCacheKey(t *testing.T, group string, body string) string {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	c.Set(ctxkey.Group, group)
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	key, err := getResponseCacheKey(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestGetResponseCacheKey(t *testing.T) {
+	key := getTestResponseCacheKey(t, "default", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":0}`)
+	same := getTestResponseCacheKey(t, "default", `{"temperature": 0, "model": "gpt-4o", "user": "bob",
+		"messages": [{"content": "hi", "role": "user"}]}`)
+	if key != same {
+		t.Error("requests differing in formatting and user should share a key")
+	}
+	if getTestResponseCacheKey(t, "vip", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":0}`) == key {
+		t.Error("groups should not share keys")
+	}
+	if getTestResponseCacheKey(t, "default", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"temperature":1}`) == key {
+		t.Error("different requests should not share keys")
+	}
+}
+
+func TestStoreCachedResponse(t *testing.T) {
+	enabled, redisEnabled := config.ResponseCacheEnabled, common.RedisEnabled
+	defer func() {
+		config.ResponseCacheEnabled, common.RedisEnabled = enabled, redisEnabled
+	}()
+	config.ResponseCacheEnabled = true
+	common.RedisEnabled = false
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"store"}]}`))
+	c.Set(ctxkey.RequestModel, "gpt-4o")
+	c.Set(ctxkey.Channel, channeltype.Azure)
+	if served, _ := ServeCachedResponse(c, relaymode.ChatCompletions); served {
+		t.Fatal("first request should miss")
+	}
+	c.JSON(http.StatusOK, gin.H{"id": "a"})
+	c.Set(ctxkey.Usage, &model.Usage{PromptTokens: 3, CompletionTokens: 2})
+	StoreCachedResponse(c)
+
+	key, _ := getResponseCacheKey(c)
+	value, ok := dbmodel.CacheGetResponse(key)
+	if !ok {
+		t.Fatal("response should be cached")
+	}
+	var response cachedResponse
+	if err := json.Unmarshal([]byte(value), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Body != `{"id":"a"}` || response.PromptTokens != 3 || response.CompletionTokens != 2 {
+		t.Errorf("unexpected cached response: %+v", response)
+	}
+	if response.ChannelType != channeltype.Azure {
+		t.Errorf("hits should be priced by the channel which answered, got type %d", response.ChannelType)
+	}
+}
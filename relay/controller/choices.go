@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// maxEmulatedChoices bounds the upstream requests a single chat completion fans out to
+const maxEmulatedChoices = 10
+
+// isChoicesEmulated reports whether n > 1 has to be emulated with one upstream
+// request per choice because the adaptor of the channel drops it
+func isChoicesEmulated(meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) bool {
+	return textRequest.N > 1 &&
+		meta.Mode == relaymode.ChatCompletions &&
+		!channeltype.HasNativeMultipleChoices(meta.ChannelType)
+}
+
+type choiceResult struct {
+	usage  *model.Usage
+	err    *model.ErrorWithStatusCode
+	writer *choiceResponseWriter
+}
+
+// relayEmulatedChoices sends the request to the channel once per choice in parallel
+// and merges the answers into one response, the returned usage is the sum of all
+func relayEmulatedChoices(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, a adaptor.Adaptor) (*model.Usage, *model.ErrorWithStatusCode) {
+	ctx := c.Request.Context()
+	n := textRequest.N
+	if n > maxEmulatedChoices {
+		return nil, openai.ErrorWrapper(fmt.Errorf("n must be at most %d on this channel", maxEmulatedChoices), "invalid_request_error", http.StatusBadRequest)
+	}
+	textRequest.N = 0
+	convertedRequest, err := a.ConvertRequest(c, meta.Mode, textRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	requestBody, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "emulating %d choices with request: %s", n, string(requestBody))
+
+	merger := &choiceMerger{c: c, includeUsage: textRequest.StreamOptions != nil && textRequest.StreamOptions.IncludeUsage}
+	results := make([]choiceResult, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			results[index] = relayChoice(c, meta, requestBody, merger, index)
+		}(i)
+	}
+	wg.Wait()
+
+	usage := &model.Usage{}
+	var firstErr *model.ErrorWithStatusCode
+	for _, result := range results {
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
+		}
+		if result.usage != nil {
+			usage.PromptTokens += result.usage.PromptTokens
+			usage.CompletionTokens += result.usage.CompletionTokens
+			usage.TotalTokens += result.usage.TotalTokens
+		}
+	}
+	if !meta.IsStream {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		if err = merger.writeResponse(results, usage); err != nil {
+			return nil, openai.ErrorWrapper(err, "merge_response_failed", http.StatusInternalServerError)
+		}
+		return usage, nil
+	}
+	if firstErr != nil {
+		if !merger.started {
+			return nil, firstErr
+		}
+		// the other choices have already been sent, so only they are billed
+		logger.Errorf(ctx, "emulated choice failed: %s", firstErr.Message)
+	}
+	merger.finishStream(usage)
+	return usage, nil
+}
+
+// relayChoice runs one upstream request on a copy of the context whose writer feeds the merger
+func relayChoice(c *gin.Context, meta *meta.Meta, requestBody []byte, merger *choiceMerger, index int) choiceResult {
+	choiceMeta := *meta
+	choiceContext := c.Copy()
+	writer := newChoiceResponseWriter(c.Writer, merger, index, meta.IsStream)
+	choiceContext.Writer = writer
+	a := relay.GetAdaptor(choiceMeta.APIType)
+	a.Init(&choiceMeta)
+	resp, err := a.DoRequest(choiceContext, &choiceMeta, bytes.NewReader(requestBody))
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "DoRequest failed: %s", err.Error())
+		return choiceResult{err: openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)}
+	}
+	if isErrorHappened(&choiceMeta, resp) {
+		return choiceResult{err: RelayErrorHandler(resp)}
+	}
+	usage, respErr := a.DoResponse(choiceContext, resp, &choiceMeta)
+	if respErr != nil {
+		return choiceResult{err: respErr}
+	}
+	return choiceResult{usage: usage, writer: writer}
+}
+
+// choiceMerger interleaves the stream chunks of all choices on the client writer
+type choiceMerger struct {
+	sync.Mutex
+	c            *gin.Context
+	includeUsage bool
+	started      bool
+	id           string
+	model        string
+	created      int64
+}
+
+func (m *choiceMerger) writeChunk(index int, data string) {
+	if data == "[DONE]" {
+		return
+	}
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return
+	}
+	if len(chunk.Choices) == 0 {
+		// usage is summed up and sent once all choices are done
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !m.started {
+		m.started = true
+		m.id, m.model, m.created = chunk.Id, chunk.Model, chunk.Created
+		common.SetEventStreamHeaders(m.c)
+	}
+	chunk.Id = m.id
+	chunk.Usage = nil
+	for i := range chunk.Choices {
+		chunk.Choices[i].Index = index
+	}
+	if err := render.ObjectData(m.c, chunk); err != nil {
+		logger.SysError(err.Error())
+	}
+}
+
+func (m *choiceMerger) finishStream(usage *model.Usage) {
+	if m.includeUsage {
+		_ = render.ObjectData(m.c, openai.ChatCompletionsStreamResponse{
+			Id:      m.id,
+			Object:  "chat.completion.chunk",
+			Created: m.created,
+			Model:   m.model,
+			Choices: []openai.ChatCompletionsStreamResponseChoice{},
+			Usage:   usage,
+		})
+	}
+	render.Done(m.c)
+}
+
+// writeResponse merges the buffered responses into one chat completion with indexed choices
+func (m *choiceMerger) writeResponse(results []choiceResult, usage *model.Usage) error {
+	var merged *openai.TextResponse
+	for index, result := range results {
+		var response openai.TextResponse
+		if err := json.Unmarshal(result.writer.buffer.Bytes(), &response); err != nil {
+			return err
+		}
+		for i := range response.Choices {
+			response.Choices[i].Index = index
+		}
+		if merged == nil {
+			merged = &response
+			continue
+		}
+		merged.Choices = append(merged.Choices, response.Choices...)
+	}
+	merged.Usage = *usage
+	m.c.JSON(http.StatusOK, merged)
+	return nil
+}
+
+// choiceResponseWriter takes the place of the client writer for one choice, stream
+// events go to the merger and a non-stream body is kept for merging
+type choiceResponseWriter struct {
+	gin.ResponseWriter
+	merger     *choiceMerger
+	index      int
+	isStream   bool
+	header     http.Header
+	statusCode int
+	size       int
+	buffer     bytes.Buffer
+	pending    []byte
+}
+
+func newChoiceResponseWriter(w gin.ResponseWriter, merger *choiceMerger, index int, isStream bool) *choiceResponseWriter {
+	return &choiceResponseWriter{
+		ResponseWriter: w,
+		merger:         merger,
+		index:          index,
+		isStream:       isStream,
+		header:         http.Header{},
+		size:           -1,
+	}
+}
+
+func (w *choiceResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *choiceResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *choiceResponseWriter) WriteHeaderNow() {
+	if w.size < 0 {
+		w.size = 0
+	}
+}
+
+func (w *choiceResponseWriter) Status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+func (w *choiceResponseWriter) Size() int {
+	return w.size
+}
+
+func (w *choiceResponseWriter) Written() bool {
+	return w.size >= 0
+}
+
+func (w *choiceResponseWriter) Flush() {}
+
+func (w *choiceResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *choiceResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	w.size += len(data)
+	if !w.isStream {
+		return w.buffer.Write(data)
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.pending[:idx]), "\r")
+		w.pending = w.pending[idx+1:]
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		w.merger.writeChunk(w.index, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+	}
+	return len(data), nil
+}
+
+var _ gin.ResponseWriter = (*choiceResponseWriter)(nil)
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// newChoicesUpstream answers every request with one choice, the failing-th request fails
+func newChoicesUpstream(failing int32) *httptest.Server {
+	var calls int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request model.GeneralOpenAIRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		call := atomic.AddInt32(&calls, 1)
+		if call == failing || request.N > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+			return
+		}
+		if request.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(w, "data: {\"id\":\"c%d\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"answer\"}}]}\n\n", call)
+			_, _ = fmt.Fprintf(w, "data: {\"id\":\"c%d\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n", call)
+			_, _ = fmt.Fprintf(w, "data: {\"id\":\"c%d\",\"object\":\"chat.completion.chunk\",\"created\":1,\"model\":\"gpt-4o\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5,\"total_tokens\":15}}\n\n", call)
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"c%d","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"answer"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`, call)
+	}))
+}
+
+func relayTestChoices(t *testing.T, upstream *httptest.Server, stream bool) (*httptest.ResponseRecorder, *model.Usage, *model.ErrorWithStatusCode) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Request.Header.Set("Content-Type", "application/json")
+	requestMeta := &meta.Meta{
+		Mode:            relaymode.ChatCompletions,
+		APIType:         apitype.OpenAI,
+		ChannelType:     channeltype.OpenAI,
+		BaseURL:         upstream.URL,
+		APIKey:          "key",
+		RequestURLPath:  "/v1/chat/completions",
+		OriginModelName: "gpt-4o",
+		ActualModelName: "gpt-4o",
+		IsStream:        stream,
+		PromptTokens:    10,
+	}
+	textRequest := &model.GeneralOpenAIRequest{
+		Model:    "gpt-4o",
+		Messages: []model.Message{{Role: "user", Content: "hi"}},
+		N:        3,
+		Stream:   stream,
+	}
+	if stream {
+		textRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	a := relay.GetAdaptor(requestMeta.APIType)
+	a.Init(requestMeta)
+	usage, bizErr := relayEmulatedChoices(c, requestMeta, textRequest, a)
+	return w, usage, bizErr
+}
+
+func TestRelayEmulatedChoices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client.Init()
+
+	upstream := newChoicesUpstream(0)
+	defer upstream.Close()
+	w, usage, bizErr := relayTestChoices(t, upstream, false)
+	if bizErr != nil {
+		t.Fatalf("choices should succeed, got %+v", bizErr)
+	}
+	if *usage != (model.Usage{PromptTokens: 30, CompletionTokens: 15, TotalTokens: 45}) {
+		t.Errorf("usage should be summed up over the choices, got %+v", usage)
+	}
+	var response openai.TextResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Choices) != 3 || response.Usage.TotalTokens != 45 {
+		t.Fatalf("expected 3 choices and the summed usage, got %s", w.Body.String())
+	}
+	for i, choice := range response.Choices {
+		if choice.Index != i {
+			t.Errorf("choice %d has index %d", i, choice.Index)
+		}
+	}
+
+	w, usage, bizErr = relayTestChoices(t, upstream, true)
+	if bizErr != nil {
+		t.Fatalf("stream choices should succeed, got %+v", bizErr)
+	}
+	if usage.TotalTokens != 45 {
+		t.Errorf("stream usage should be summed up over the choices, got %+v", usage)
+	}
+	body := w.Body.String()
+	for i := 0; i < 3; i++ {
+		if !strings.Contains(body, fmt.Sprintf(`"index":%d`, i)) {
+			t.Errorf("stream should have choice %d, got %s", i, body)
+		}
+	}
+	if strings.Count(body, `"total_tokens":45`) != 1 || strings.Count(body, "[DONE]") != 1 {
+		t.Errorf("stream should end with the summed usage and a single [DONE], got %s", body)
+	}
+}
+
+func TestRelayEmulatedChoicesPartialFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	client.Init()
+
+	upstream := newChoicesUpstream(2)
+	defer upstream.Close()
+	if _, _, bizErr := relayTestChoices(t, upstream, false); bizErr == nil || bizErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("a failed choice should fail the whole response, got %+v", bizErr)
+	}
+
+	upstream = newChoicesUpstream(2)
+	defer upstream.Close()
+	w, usage, bizErr := relayTestChoices(t, upstream, true)
+	if bizErr != nil {
+		t.Fatalf("a stream already sent should go on without the failed choice, got %+v", bizErr)
+	}
+	// only the choices sent are billed
+	if usage.TotalTokens != 30 || !strings.Contains(w.Body.String(), `"total_tokens":30`) {
+		t.Errorf("usage should sum up the choices which succeeded, got %+v", usage)
+	}
+}
+
+func TestGetPreConsumedQuotaChoices(t *testing.T) {
+	request := &model.GeneralOpenAIRequest{MaxTokens: 100}
+	single := getPreConsumedQuota(request, 10, 1)
+	request.N = 3
+	if quota := getPreConsumedQuota(request, 10, 1); quota != config.PreConsumedQuota+3*110 || quota <= single {
+		t.Errorf("every choice should be pre-consumed, got %d", quota)
+	}
+}
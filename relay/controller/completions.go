@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayCompletionsHelper relays /v1/completions as is to the channels serving it
+// and through chat completions to the chat-only ones
+func RelayCompletionsHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	requestBody, err := getInboundRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	if channeltype.HasNativeCompletions(c.GetInt(ctxkey.Channel)) {
+		// a previous attempt on a chat-only channel may have bridged the request
+		setBridgedRequest(c, getInboundRequestURL(c).Path, requestBody)
+		return RelayTextHelper(c)
+	}
+	request := &model.GeneralOpenAIRequest{}
+	if err = json.Unmarshal(requestBody, request); err != nil {
+		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	}
+	chatRequest, err := openai.CompletionsRequest2Chat(request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	}
+	body, err := json.Marshal(chatRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted completion request: %s", string(body))
+	setBridgedChatRequest(c, body)
+	return relayBridgedText(c, &completionsBridge{}, chatRequest.Stream)
+}
+
+// completionsBridge rewrites chat completions as text_completion objects
+type completionsBridge struct{}
+
+func (b *completionsBridge) convertResponse(body []byte) ([]byte, error) {
+	var chatResponse openai.TextResponse
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, err
+	}
+	return json.Marshal(openai.ResponseChat2Completions(&chatResponse))
+}
+
+func (b *completionsBridge) convertStreamData(data string) []byte {
+	if data == "[DONE]" {
+		return []byte("data: [DONE]\n\n")
+	}
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	response := openai.StreamResponseChat2Completions(&chunk)
+	if response == nil {
+		return nil
+	}
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return nil
+	}
+	return []byte(fmt.Sprintf("data: %s\n\n", jsonData))
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/capability"
+	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/truncation"
+)
+
+// fitContextWindow checks the request against the capabilities of the mapped model,
+// then applies the context strategy of the token or its group when the prompt and the
+// requested completion do not fit in the context window of the model, it returns the
+// prompt tokens of the request that is sent
+func fitContextWindow(ctx context.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, promptTokens int) (int, *model.ErrorWithStatusCode) {
+	adapted, err := validator.ValidateCapability(textRequest, meta.Mode)
+	if err != nil {
+		return promptTokens, openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+	}
+	meta.RequestAdapted = meta.RequestAdapted || adapted
+	promptTokens = truncateMessages(ctx, meta, textRequest, promptTokens)
+	adapted, err = validator.ValidateContextWindow(textRequest, promptTokens, openai.IsTokenCountExact(textRequest.Model))
+	if err != nil {
+		return promptTokens, openai.ErrorWrapper(err, "context_length_exceeded", http.StatusBadRequest)
+	}
+	meta.RequestAdapted = meta.RequestAdapted || adapted
+	return promptTokens, nil
+}
+
+func truncateMessages(ctx context.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, promptTokens int) int {
+	if meta.Mode != relaymode.ChatCompletions && meta.Mode != relaymode.Responses {
+		return promptTokens
+	}
+	modelCapability, ok := capability.Get(textRequest.Model)
+	if !ok || modelCapability.ContextWindow <= 0 {
+		return promptTokens
+	}
+	strategy := truncation.Get(meta.ContextStrategy, meta.Group)
+	if strategy.Name == truncation.Reject {
+		return promptTokens
+	}
+	// room for the completion if it fits, otherwise max tokens gets lowered by the validator
+	budget := modelCapability.ContextWindow
+	if textRequest.MaxTokens > 0 && textRequest.MaxTokens < budget {
+		budget -= textRequest.MaxTokens
+	}
+	if promptTokens <= budget {
+		return promptTokens
+	}
+	// the tokens of tools, reply priming and the like stay whatever messages are dropped
+	messagesTokens := 0
+	costs := make([]int, len(textRequest.Messages))
+	for i := range textRequest.Messages {
+		costs[i] = openai.CountTokenMessages(textRequest.Messages[i:i+1], textRequest.Model) - openai.CountTokenMessages(nil, textRequest.Model)
+		messagesTokens += costs[i]
+	}
+	fixedTokens := promptTokens - messagesTokens
+	messages, keptTokens, err := strategy.Truncate(textRequest.Messages, costs, budget-fixedTokens)
+	if err != nil {
+		logger.Warnf(ctx, "context strategy %s cannot fit %d prompt tokens in %d", strategy.String(), promptTokens, budget)
+		return promptTokens
+	}
+	dropped := len(textRequest.Messages) - len(messages)
+	if dropped == 0 {
+		return promptTokens
+	}
+	textRequest.Messages = messages
+	meta.TruncatedMessages = dropped
+	promptTokens = fixedTokens + keptTokens
+	meta.PromptTokens = promptTokens
+	logger.Infof(ctx, "context strategy %s dropped %d messages, prompt tokens: %d", strategy.String(), dropped, promptTokens)
+	return promptTokens
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/constant/role"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/routing"
+)
+
+const sseEventSeparator = "\n\n"
+
+// streamFailover sits between the stream handler of the adaptor and the client. It keeps
+// the text sent so far and holds back [DONE], so that a stream which ends before its
+// finish_reason can be continued by another channel as if nothing happened.
+type streamFailover struct {
+	gin.ResponseWriter
+	pending bytes.Buffer
+	// text is what the client has received so far
+	text     strings.Builder
+	id       string
+	model    string
+	created  any
+	finished bool
+	toolCall bool
+	done     bool
+	// continuing is set once another channel continues the stream
+	continuing bool
+}
+
+// startStreamFailover puts a streamFailover in front of the writer of the context when the
+// request is a chat completion stream which can be continued, nil otherwise
+func startStreamFailover(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *streamFailover {
+	if !config.StreamFailoverEnabled || !meta.IsStream || meta.Mode != relaymode.ChatCompletions || textRequest.N > 1 {
+		return nil
+	}
+	if _, ok := c.Get(ctxkey.SpecificChannelId); ok {
+		return nil
+	}
+	failover := &streamFailover{ResponseWriter: c.Writer}
+	c.Writer = failover
+	return failover
+}
+
+func (f *streamFailover) Write(data []byte) (int, error) {
+	f.pending.Write(data)
+	for {
+		event, rest, found := strings.Cut(f.pending.String(), sseEventSeparator)
+		if !found {
+			break
+		}
+		f.pending.Reset()
+		f.pending.WriteString(rest)
+		if err := f.forward(event); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (f *streamFailover) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// forward inspects an event and passes it on to the client
+func (f *streamFailover) forward(event string) error {
+	data, isData := strings.CutPrefix(event, "data: ")
+	if isData && strings.HasPrefix(data, "[DONE]") {
+		f.done = true
+		return nil
+	}
+	var chunk map[string]any
+	if isData && json.Unmarshal([]byte(data), &chunk) == nil {
+		if f.continuing {
+			// the client should not notice the change of channel
+			chunk["id"], chunk["model"], chunk["created"] = f.id, f.model, f.created
+			if rewritten, err := json.Marshal(chunk); err == nil {
+				event = "data: " + string(rewritten)
+			}
+		} else if f.id == "" {
+			f.id, _ = chunk["id"].(string)
+			f.model, _ = chunk["model"].(string)
+			f.created = chunk["created"]
+		}
+		var streamResponse openai.ChatCompletionsStreamResponse
+		if json.Unmarshal([]byte(data), &streamResponse) == nil {
+			for _, choice := range streamResponse.Choices {
+				f.text.WriteString(conv.AsString(choice.Delta.Content))
+				if len(choice.Delta.ToolCalls) != 0 {
+					f.toolCall = true
+				}
+				if choice.FinishReason != nil && *choice.FinishReason != "" {
+					f.finished = true
+				}
+			}
+		}
+	}
+	_, err := f.ResponseWriter.WriteString(event + sseEventSeparator)
+	return err
+}
+
+// interrupted reports whether the stream ended without its finish_reason, a tool call cut
+// short cannot be continued and neither can a stream the client has left
+func (f *streamFailover) interrupted(c *gin.Context) bool {
+	return !f.finished && !f.toolCall && c.Request.Context().Err() == nil
+}
+
+// finish sends what is left to the client and restores the writer of the context
+func (f *streamFailover) finish(c *gin.Context) {
+	if f.pending.Len() != 0 {
+		_, _ = f.ResponseWriter.Write(f.pending.Bytes())
+		f.pending.Reset()
+	}
+	c.Writer = f.ResponseWriter
+	if f.done || f.continuing {
+		render.Done(c)
+	}
+}
+
+// canPrefill reports whether the channel continues a trailing assistant message rather than
+// answering it anew. Claude does, while OpenAI and most compatible upstreams start another
+// answer, so only channels serving Claude are asked to continue a stream.
+func canPrefill(channel *dbmodel.Channel, modelName string) bool {
+	switch channel.Type {
+	case channeltype.Anthropic:
+		return true
+	case channeltype.AwsClaude, channeltype.VertextAI:
+		modelName, _ = getMappedModelName(modelName, channel.GetModelMapping())
+		return strings.Contains(strings.ToLower(modelName), "claude")
+	}
+	return false
+}
+
+// continueStream asks other channels able to prefill to continue an interrupted stream, with
+// the text received so far as the beginning of the assistant message. Each continuation
+// pre-consumes its quota as a request of its own, is billed to the channel which produced
+// it and counted against its limits, and the usage of the whole answer is returned.
+func (f *streamFailover) continueStream(c *gin.Context, requestMeta *meta.Meta, textRequest *model.GeneralOpenAIRequest, usage *model.Usage, groupRatio float64, systemPromptReset bool) *model.Usage {
+	ctx := c.Request.Context()
+	total := *usage
+	lastChannelId := requestMeta.ChannelId
+	// channelTokens are the tokens used by the channel of the lease of the request
+	channelTokens := usage.TotalTokens
+	defer func() {
+		middleware.ReleaseChannelLeaseWithTokens(c, channelTokens)
+	}()
+	for i := 0; i < config.StreamFailoverTimes && f.interrupted(c); i++ {
+		channel, lease := getOtherChannel(requestMeta.Group, requestMeta.OriginModelName, lastChannelId, func(channel *dbmodel.Channel) bool {
+			return canPrefill(channel, requestMeta.OriginModelName)
+		})
+		if channel == nil {
+			logger.Errorf(ctx, "no other channel able to continue the interrupted stream")
+			break
+		}
+		lastChannelId = channel.Id
+		logger.Infof(ctx, "stream interrupted after %d characters, continuing with channel #%d", f.text.Len(), channel.Id)
+		middleware.ReleaseChannelLeaseWithTokens(c, channelTokens)
+		middleware.SetupContextForSelectedChannel(c, channel, requestMeta.OriginModelName)
+		middleware.SetChannelLease(c, lease)
+		channelTokens = 0
+		continuationMeta := meta.GetByContext(c)
+		continuationMeta.IsStream = true
+		continuationMeta.OriginModelName = requestMeta.OriginModelName
+		continuationMeta.TruncatedMessages = requestMeta.TruncatedMessages
+
+		continuationRequest := *textRequest
+		continuationRequest.Messages = append([]model.Message(nil), textRequest.Messages...)
+		setSystemPrompt(ctx, &continuationRequest, continuationMeta.ForcedSystemPrompt)
+		if f.text.Len() != 0 {
+			continuationRequest.Messages = append(continuationRequest.Messages, model.Message{
+				Role:    role.Assistant,
+				Content: f.text.String(),
+			})
+		}
+		continuationRequest.Model, _ = getMappedModelName(requestMeta.OriginModelName, continuationMeta.ModelMapping)
+		continuationMeta.ActualModelName = continuationRequest.Model
+		continuationMeta.PromptTokens = getPromptTokens(&continuationRequest, continuationMeta.Mode)
+
+		adaptor := relay.GetAdaptor(continuationMeta.APIType)
+		if adaptor == nil {
+			continue
+		}
+		adaptor.Init(continuationMeta)
+		requestBody, err := convertRequestBody(c, continuationMeta, &continuationRequest, adaptor)
+		if err != nil {
+			logger.Errorf(ctx, "failed to convert the continuation request: %s", err.Error())
+			continue
+		}
+		modelRatio := billingratio.GetModelRatio(continuationRequest.Model, continuationMeta.ChannelType)
+		ratio := modelRatio * groupRatio * getBatchRatio(continuationMeta)
+		preConsumedQuota, bizErr := preConsumeQuota(ctx, &continuationRequest, continuationMeta.PromptTokens, ratio, continuationMeta)
+		if bizErr != nil {
+			// the quota left does not allow another request, the answer stays as it is
+			logger.Warnf(ctx, "preConsumeQuota of the continuation failed: %+v", *bizErr)
+			break
+		}
+		resp, err := adaptor.DoRequest(c, continuationMeta, requestBody)
+		if err != nil {
+			logger.Errorf(ctx, "channel #%d failed to continue the stream: %s", channel.Id, err.Error())
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, continuationMeta.TokenId)
+			monitor.Emit(channel.Id, requestMeta.OriginModelName, c.GetTime(ctxkey.ChannelSelectedAt), false)
+			routing.RecordRequest(channel.Id, requestMeta.OriginModelName, 0, false)
+			continue
+		}
+		if isErrorHappened(continuationMeta, resp) {
+			logger.Errorf(ctx, "channel #%d failed to continue the stream: %s", channel.Id, RelayErrorHandler(resp).Message)
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, continuationMeta.TokenId)
+			monitor.Emit(channel.Id, requestMeta.OriginModelName, c.GetTime(ctxkey.ChannelSelectedAt), false)
+			routing.RecordRequest(channel.Id, requestMeta.OriginModelName, 0, false)
+			continue
+		}
+		f.continuing = true
+		f.finished = false
+		textLen := f.text.Len()
+		partUsage, respErr := adaptor.DoResponse(c, resp, continuationMeta)
+		monitor.Emit(channel.Id, requestMeta.OriginModelName, c.GetTime(ctxkey.ChannelSelectedAt), respErr == nil)
+		routing.RecordRequest(channel.Id, requestMeta.OriginModelName, time.Since(continuationMeta.StartTime), respErr == nil)
+		if respErr != nil {
+			logger.Errorf(ctx, "channel #%d failed while continuing the stream: %s", channel.Id, respErr.Message)
+			partUsage = openai.ResponseText2Usage(f.text.String()[textLen:], continuationMeta.ActualModelName, continuationMeta.PromptTokens)
+		}
+		if partUsage == nil {
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, continuationMeta.TokenId)
+			continue
+		}
+		channelTokens = partUsage.TotalTokens
+		total.CompletionTokens += partUsage.CompletionTokens
+		total.TotalTokens = total.PromptTokens + total.CompletionTokens
+		go postConsumeQuota(ctx, partUsage, continuationMeta, &continuationRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	}
+	return &total
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/render"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestStreamFailover(t *testing.T) {
+	config.StreamFailoverEnabled = true
+	defer func() {
+		config.StreamFailoverEnabled = false
+	}()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	failover := startStreamFailover(c, &meta.Meta{Mode: relaymode.ChatCompletions, IsStream: true}, &model.GeneralOpenAIRequest{})
+	if failover == nil {
+		t.Fatal("chat completion streams should be continued")
+	}
+
+	render.StringData(c, `{"id":"a","created":1,"model":"m","choices":[{"index":0,"delta":{"content":"Hel"}}]}`)
+	// events may arrive in pieces
+	_, _ = c.Writer.WriteString(`data: {"id":"a","created":1,"model":"m","choices":[{"index":0,"delta":{"content":"lo"}}]}`)
+	_, _ = c.Writer.WriteString("\n\n")
+	render.Done(c)
+	if strings.Contains(w.Body.String(), "[DONE]") {
+		t.Error("[DONE] should be held back")
+	}
+	if !failover.interrupted(c) || failover.text.String() != "Hello" {
+		t.Fatalf("stream without finish_reason should be interrupted, text %q", failover.text.String())
+	}
+
+	failover.continuing = true
+	render.StringData(c, `{"id":"b","created":2,"model":"n","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":"stop"}]}`)
+	render.Done(c)
+	failover.finish(c)
+	if failover.interrupted(c) {
+		t.Error("stream with finish_reason should not be interrupted")
+	}
+	body := w.Body.String()
+	if strings.Contains(body, `"id":"b"`) || strings.Count(body, `"id":"a"`) != 3 {
+		t.Errorf("continuation should keep the id of the stream, got %s", body)
+	}
+	if strings.Count(body, "[DONE]") != 1 || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("[DONE] should be sent once at the end, got %s", body)
+	}
+	if c.Writer == gin.ResponseWriter(failover) {
+		t.Error("finish should restore the writer")
+	}
+}
+
+func TestCanPrefill(t *testing.T) {
+	cases := []struct {
+		channel *dbmodel.Channel
+		model   string
+		want    bool
+	}{
+		{&dbmodel.Channel{Type: channeltype.Anthropic}, "claude-3-5-sonnet-20241022", true},
+		{&dbmodel.Channel{Type: channeltype.OpenAI}, "claude-3-5-sonnet-20241022", false},
+		{&dbmodel.Channel{Type: channeltype.AwsClaude}, "claude-3-5-sonnet-20241022", true},
+		{&dbmodel.Channel{Type: channeltype.VertextAI}, "gemini-1.5-pro", false},
+		{&dbmodel.Channel{Type: channeltype.VertextAI, ModelMapping: stringPtr(`{"sonnet":"claude-3-5-sonnet@20240620"}`)}, "sonnet", true},
+	}
+	for _, tc := range cases {
+		if got := canPrefill(tc.channel, tc.model); got != tc.want {
+			t.Errorf("canPrefill(%d, %q) = %v, want %v", tc.channel.Type, tc.model, got, tc.want)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func TestContinueStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, memoryCacheEnabled, redisEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled
+	defer func() {
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled = sqlitePath, memoryCacheEnabled, redisEnabled
+		config.StreamFailoverEnabled = false
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	config.MemoryCacheEnabled = false
+	common.RedisEnabled = false
+	config.StreamFailoverEnabled = true
+	dbmodel.InitDB()
+	dbmodel.InitLogDB()
+	client.Init()
+
+	var calls sync.Map
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Store(r.URL.Path, true)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"message_start\",\"message\":{\"id\":\"msg\",\"model\":\"claude-3-5-sonnet-20241022\",\"usage\":{\"input_tokens\":10}}}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"lo\"}}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":1}}\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+	modelName := "claude-3-5-sonnet-20241022"
+	// the OpenAI channel is picked first but cannot continue the assistant message, the
+	// Anthropic one is the only one weighted when the lower priorities are picked from
+	for _, channel := range []*dbmodel.Channel{
+		{Id: 2, Type: channeltype.OpenAI, Priority: int64Ptr(10), Weight: uintPtr(0)},
+		{Id: 3, Type: channeltype.Anthropic, Priority: int64Ptr(5), Weight: uintPtr(1)},
+	} {
+		channel.Key, channel.Name, channel.Models, channel.Group = "key", "channel", modelName, "default"
+		channel.BaseURL, channel.Status = &upstream.URL, dbmodel.ChannelStatusEnabled
+		if err := channel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := &dbmodel.User{Id: 1, Username: "user", Password: "12345678", Group: "default", Status: dbmodel.UserStatusEnabled, AffCode: "user", AccessToken: "user", Quota: 1}
+	if err := dbmodel.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := dbmodel.DB.Create(&dbmodel.Token{Id: 1, UserId: 1, Key: "token", Name: "token", Status: dbmodel.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	interrupt := func() (*httptest.ResponseRecorder, *gin.Context, *streamFailover, *meta.Meta) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 1)
+		c.Set(ctxkey.Group, "default")
+		c.Set(ctxkey.RequestModel, modelName)
+		c.Set(ctxkey.ChannelId, 1)
+		requestMeta := meta.GetByContext(c)
+		requestMeta.IsStream = true
+		failover := startStreamFailover(c, requestMeta, &model.GeneralOpenAIRequest{})
+		render.StringData(c, `{"id":"a","created":1,"model":"m","choices":[{"index":0,"delta":{"content":"Hel"}}]}`)
+		return w, c, failover, requestMeta
+	}
+	textRequest := &model.GeneralOpenAIRequest{Model: modelName, Stream: true, Messages: []model.Message{{Role: "user", Content: "hi"}}}
+	usage := &model.Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11}
+
+	// the quota left does not allow another request
+	_, c, failover, requestMeta := interrupt()
+	total := failover.continueStream(c, requestMeta, textRequest, usage, 1, false)
+	failover.finish(c)
+	if _, ok := calls.Load("/v1/messages"); ok || *total != *usage {
+		t.Errorf("a continuation beyond the quota should not be sent, got usage %+v", total)
+	}
+
+	if err := dbmodel.DB.Model(user).Update("quota", 1000000).Error; err != nil {
+		t.Fatal(err)
+	}
+	w, c, failover, requestMeta := interrupt()
+	total = failover.continueStream(c, requestMeta, textRequest, usage, 1, false)
+	failover.finish(c)
+	if _, ok := calls.Load("/v1/chat/completions"); ok {
+		t.Error("a channel unable to prefill should not continue the stream")
+	}
+	if failover.text.String() != "Hello" || total.CompletionTokens != 2 {
+		t.Errorf("the Anthropic channel should continue the stream, got %q and %+v", failover.text.String(), total)
+	}
+	if !strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n") {
+		t.Errorf("the continued stream should end with [DONE], got %s", w.Body.String())
+	}
+	// the continuation is billed in the background, to the channel which produced it
+	var log dbmodel.Log
+	for i := 0; i < 100 && dbmodel.LOG_DB.Where("type = ?", dbmodel.LogTypeConsume).First(&log).Error != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if log.ChannelId != 3 || log.CompletionTokens != 1 {
+		t.Errorf("the continuation should be billed to the Anthropic channel, got %+v", log)
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayGeminiGenerateContentHelper handles the native Gemini generateContent and
+// streamGenerateContent endpoints by converting to/from chat completions
+func RelayGeminiGenerateContentHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	inboundURL := getInboundRequestURL(c)
+	modelName, action := gemini.ParseInboundPath(inboundURL.Path)
+	sse := inboundURL.Query().Get("alt") == "sse"
+	if modelName == "" {
+		return openai.ErrorWrapper(fmt.Errorf("model is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	var stream bool
+	switch action {
+	case gemini.InboundActionGenerateContent:
+	case gemini.InboundActionStreamGenerateContent:
+		stream = true
+	default:
+		return openai.ErrorWrapper(fmt.Errorf("unsupported action: %s", action), "invalid_request_error", http.StatusNotFound)
+	}
+	requestBody, err := getInboundRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	generateRequest := &gemini.InboundRequest{}
+	if err = json.Unmarshal(requestBody, generateRequest); err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	if len(generateRequest.Contents) == 0 {
+		return openai.ErrorWrapper(fmt.Errorf("contents is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	chatRequest, err := gemini.ConvertInboundRequest(generateRequest, modelName, stream)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	chatBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted gemini generateContent request: %s", string(chatBody))
+	setBridgedChatRequest(c, chatBody)
+	bridge := &geminiGenerateContentBridge{
+		converter: gemini.StreamConverter{Model: modelName},
+		sse:       sse,
+	}
+	return relayBridgedText(c, bridge, stream)
+}
+
+// geminiGenerateContentBridge writes SSE when the client asks for alt=sse,
+// otherwise a JSON array of chunks as the Gemini API does by default
+type geminiGenerateContentBridge struct {
+	converter gemini.StreamConverter
+	sse       bool
+	started   bool
+}
+
+func (b *geminiGenerateContentBridge) streamContentType() string {
+	if b.sse {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (b *geminiGenerateContentBridge) convertResponse(body []byte) ([]byte, error) {
+	var chatResponse openai.TextResponse
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, err
+	}
+	return json.Marshal(gemini.ResponseOpenAI2Gemini(&chatResponse))
+}
+
+func (b *geminiGenerateContentBridge) encode(response *gemini.InboundResponse, last bool) []byte {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return nil
+	}
+	if b.sse {
+		return []byte(fmt.Sprintf("data: %s\r\n\r\n", jsonData))
+	}
+	var converted []byte
+	if b.started {
+		converted = append(converted, ",\r\n"...)
+	} else {
+		converted = append(converted, '[')
+	}
+	b.started = true
+	converted = append(converted, jsonData...)
+	if last {
+		converted = append(converted, ']')
+	}
+	return converted
+}
+
+func (b *geminiGenerateContentBridge) convertStreamData(data string) []byte {
+	if data == "[DONE]" {
+		return b.encode(b.converter.Finish(), true)
+	}
+	var chunk openai.ChatCompletionsStreamResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.SysError("error unmarshalling stream response: " + err.Error())
+		return nil
+	}
+	response := b.converter.Convert(&chunk)
+	if response == nil {
+		return nil
+	}
+	return b.encode(response, false)
+}
+
+// GeminiErrorStatus maps an HTTP status code to the canonical status used by Google APIs
+func GeminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+)
+
+func TestGeminiGenerateContentBridgeStream(t *testing.T) {
+	chunks := []string{
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		`{"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}`,
+		`{"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		"[DONE]",
+	}
+	const (
+		hel  = `{"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]},"index":0}],"modelVersion":"gemini-1.5-pro"}`
+		lo   = `{"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"index":0}],"modelVersion":"gemini-1.5-pro"}`
+		last = `{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":2,"totalTokenCount":5},"modelVersion":"gemini-1.5-pro"}`
+	)
+	tests := []struct {
+		name        string
+		sse         bool
+		contentType string
+		want        string
+	}{
+		{
+			name:        "alt=sse",
+			sse:         true,
+			contentType: "text/event-stream",
+			want:        "data: " + hel + "\r\n\r\n" + "data: " + lo + "\r\n\r\n" + "data: " + last + "\r\n\r\n",
+		},
+		{
+			name:        "json array",
+			contentType: "application/json",
+			want:        "[" + hel + ",\r\n" + lo + ",\r\n" + last + "]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &geminiGenerateContentBridge{converter: gemini.StreamConverter{Model: "gemini-1.5-pro"}, sse: tt.sse}
+			assert.Equal(t, tt.contentType, bridge.streamContentType())
+			var got []byte
+			for _, data := range chunks {
+				got = append(got, bridge.convertStreamData(data)...)
+			}
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	// a stream without any chunk is still a valid JSON array
+	bridge := &geminiGenerateContentBridge{converter: gemini.StreamConverter{Model: "gemini-1.5-pro"}}
+	assert.JSONEq(t, `[{"candidates":[{"content":{"role":"model","parts":[]},"finishReason":"STOP","index":0}],"modelVersion":"gemini-1.5-pro"}]`,
+		string(bridge.convertStreamData("[DONE]")))
+}
+
+func TestGeminiGenerateContentBridgeResponse(t *testing.T) {
+	bridge := &geminiGenerateContentBridge{}
+	got, err := bridge.convertResponse([]byte(`{"id":"c1","object":"chat.completion","model":"gpt-4o",
+		"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],
+		"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]},"finishReason":"STOP","index":0}],
+		"usageMetadata":{"promptTokenCount":3,"candidatesTokenCount":1,"totalTokenCount":4},"modelVersion":"gpt-4o"}`, string(got))
+
+	_, err = bridge.convertResponse([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestGeminiErrorStatus(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		want       string
+	}{
+		{http.StatusBadRequest, "INVALID_ARGUMENT"},
+		{http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{http.StatusForbidden, "PERMISSION_DENIED"},
+		{http.StatusNotFound, "NOT_FOUND"},
+		{http.StatusTooManyRequests, "RESOURCE_EXHAUSTED"},
+		{http.StatusServiceUnavailable, "UNAVAILABLE"},
+		{http.StatusInternalServerError, "INTERNAL"},
+		{http.StatusBadGateway, "INTERNAL"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, GeminiErrorStatus(tt.statusCode), "status code %d", tt.statusCode)
+	}
+}
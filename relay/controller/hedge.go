@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// hedgeAttempt is one of the upstream requests racing to answer a hedged request
+type hedgeAttempt struct {
+	ctx     *gin.Context
+	meta    *meta.Meta
+	adaptor adaptor.Adaptor
+	// channel is the channel of the hedge, nil for the channel of the request
+	channel *dbmodel.Channel
+	body    io.Reader
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+}
+
+func (a *hedgeAttempt) failed() bool {
+	return a.err != nil || isErrorHappened(a.meta, a.resp)
+}
+
+func (a *hedgeAttempt) discard() {
+	a.cancel()
+	if a.resp != nil {
+		_ = a.resp.Body.Close()
+	}
+	if a.ctx != nil {
+		middleware.ReleaseChannelLease(a.ctx)
+	}
+}
+
+// hedgeResponseBody puts the peeked first byte back in front of the body
+type hedgeResponseBody struct {
+	io.Reader
+	io.Closer
+}
+
+// newAttemptContext copies the context for an upstream request which can be canceled
+// without touching the request of the client, and which is canceled when the client goes away
+func newAttemptContext(c *gin.Context) (*gin.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attemptCtx := c.Copy()
+	attemptCtx.Request = c.Request.Clone(c.Request.Context())
+	attemptCtx.Set(ctxkey.UpstreamContext, ctx)
+	// the lease of the channel of the request stays with the request
+	attemptCtx.Set(ctxkey.ChannelLease, nil)
+	return attemptCtx, cancel
+}
+
+func (a *hedgeAttempt) start(done chan<- *hedgeAttempt) {
+	go func() {
+		a.resp, a.err = a.adaptor.DoRequest(a.ctx, a.meta, a.body)
+		if a.err == nil && a.resp != nil && !isErrorHappened(a.meta, a.resp) {
+			// the headers may come long before the first token, wait for the first byte
+			reader := bufio.NewReader(a.resp.Body)
+			if _, err := reader.Peek(1); err != nil && err != io.EOF {
+				_ = a.resp.Body.Close()
+				a.resp, a.err = nil, err
+			} else {
+				a.resp.Body = hedgeResponseBody{Reader: reader, Closer: a.resp.Body}
+			}
+		}
+		done <- a
+	}()
+}
+
+// doHedgedRequest sends the request to the channel of the context and, when no byte of
+// the response has arrived after the hedge delay of the group or model, to a second
+// channel as well. The first attempt to answer wins and the other one is canceled, the
+// caller cancels the winner once its response has been read.
+func doHedgedRequest(c *gin.Context, requestMeta *meta.Meta, textRequest *model.GeneralOpenAIRequest, requestAdaptor adaptor.Adaptor, requestBody io.Reader) *hedgeAttempt {
+	primary := &hedgeAttempt{meta: requestMeta, adaptor: requestAdaptor, body: requestBody}
+	_, isSpecificChannel := c.Get(ctxkey.SpecificChannelId)
+	delay := hedge.GetDelay(requestMeta.Group, requestMeta.OriginModelName)
+	if delay <= 0 || isSpecificChannel {
+		primary.resp, primary.err = requestAdaptor.DoRequest(c, requestMeta, requestBody)
+		primary.cancel = func() {}
+		return primary
+	}
+	ctx := c.Request.Context()
+	done := make(chan *hedgeAttempt, 2)
+	primary.ctx, primary.cancel = newAttemptContext(c)
+	primary.start(done)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case attempt := <-done:
+		return attempt
+	case <-timer.C:
+	}
+
+	hedged := newHedgeAttempt(c, requestMeta, textRequest)
+	if hedged == nil {
+		return <-done
+	}
+	logger.Infof(ctx, "channel #%d has not answered in %s, hedging with channel #%d", requestMeta.ChannelId, delay, hedged.meta.ChannelId)
+	hedged.start(done)
+	winner := <-done
+	if winner.failed() {
+		// the other one may still answer
+		if other := <-done; !other.failed() || winner == hedged {
+			winner.discard()
+			winner = other
+		} else {
+			other.discard()
+		}
+	} else {
+		loser := primary
+		if winner == primary {
+			loser = hedged
+		}
+		loser.cancel()
+		go func() {
+			(<-done).discard()
+		}()
+	}
+	if winner == hedged {
+		winner.meta.StartTime = requestMeta.StartTime
+		logger.Infof(ctx, "hedged channel #%d answered first", hedged.meta.ChannelId)
+	}
+	monitor.RecordHedge(ctx, winner == hedged)
+	return winner
+}
+
+// newHedgeAttempt prepares the request for another channel able to serve the model,
+// it returns nil when there is none
+func newHedgeAttempt(c *gin.Context, requestMeta *meta.Meta, textRequest *model.GeneralOpenAIRequest) *hedgeAttempt {
+	ctx := c.Request.Context()
+	channel, lease := getOtherChannel(requestMeta.Group, requestMeta.OriginModelName, requestMeta.ChannelId, nil)
+	if channel == nil {
+		logger.Debugf(ctx, "no other channel to hedge channel #%d with", requestMeta.ChannelId)
+		return nil
+	}
+	attemptCtx, cancel := newAttemptContext(c)
+	middleware.SetupContextForSelectedChannel(attemptCtx, channel, requestMeta.OriginModelName)
+	middleware.SetChannelLease(attemptCtx, lease)
+	abandon := func() {
+		cancel()
+		middleware.ReleaseChannelLease(attemptCtx)
+	}
+	attemptMeta := meta.GetByContext(attemptCtx)
+	attemptMeta.IsStream = requestMeta.IsStream
+	attemptMeta.OriginModelName = requestMeta.OriginModelName
+	attemptMeta.PromptTokens = requestMeta.PromptTokens
+	attemptMeta.TruncatedMessages = requestMeta.TruncatedMessages
+	attemptMeta.RequestAdapted = requestMeta.RequestAdapted
+
+	attemptRequest := *textRequest
+	attemptRequest.Messages = append([]model.Message(nil), textRequest.Messages...)
+	attemptRequest.Model, _ = getMappedModelName(requestMeta.OriginModelName, attemptMeta.ModelMapping)
+	attemptMeta.ActualModelName = attemptRequest.Model
+	setSystemPrompt(ctx, &attemptRequest, attemptMeta.ForcedSystemPrompt)
+
+	attemptAdaptor := relay.GetAdaptor(attemptMeta.APIType)
+	if attemptAdaptor == nil {
+		abandon()
+		return nil
+	}
+	attemptAdaptor.Init(attemptMeta)
+	if isChoicesEmulated(attemptMeta, &attemptRequest) {
+		abandon()
+		return nil
+	}
+	rawBody, err := common.GetRequestBody(c)
+	if err != nil {
+		abandon()
+		return nil
+	}
+	attemptCtx.Request.Body = io.NopCloser(bytes.NewBuffer(rawBody))
+	body, err := getRequestBody(attemptCtx, attemptMeta, &attemptRequest, attemptAdaptor)
+	if err != nil {
+		logger.Errorf(ctx, "failed to convert the request for hedged channel #%d: %s", channel.Id, err.Error())
+		abandon()
+		return nil
+	}
+	return &hedgeAttempt{
+		ctx:     attemptCtx,
+		meta:    attemptMeta,
+		adaptor: attemptAdaptor,
+		channel: channel,
+		body:    body,
+		cancel:  cancel,
+	}
+}
+
+// useHedgeWinner makes the hedged channel the channel of the request, so that the
+// response is converted, billed and logged as coming from it
+func useHedgeWinner(c *gin.Context, attempt *hedgeAttempt, textRequest *model.GeneralOpenAIRequest) {
+	// the lease of the hedged channel replaces the one of the request
+	middleware.ReleaseChannelLease(c)
+	for key, value := range attempt.ctx.Keys {
+		if key != ctxkey.UpstreamContext {
+			c.Set(key, value)
+		}
+	}
+	c.Request.Header.Set("Authorization", attempt.ctx.Request.Header.Get("Authorization"))
+	textRequest.Model = attempt.meta.ActualModelName
+}
@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/limit"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// hedgeUpstream answers as the channel of the key does in the case named by the message
+type hedgeUpstream struct {
+	behaviours map[string]map[string]string
+	calls      sync.Map
+	canceled   chan string
+}
+
+func (u *hedgeUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request model.GeneralOpenAIRequest
+	_ = json.NewDecoder(r.Body).Decode(&request)
+	name := request.Messages[0].StringContent()
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	u.calls.Store(name+"/"+key, true)
+	switch u.behaviours[name][key] {
+	case "fail":
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":{"message":"upstream failed","type":"server_error"}}`))
+		return
+	case "slow":
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+			u.canceled <- name + "/" + key
+			return
+		}
+	case "hang":
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+			u.canceled <- name + "/" + key
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(w, `{"id":"%s","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`, key)
+}
+
+func TestDoHedgedRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, memoryCacheEnabled, redisEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled
+	defer func() {
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled = sqlitePath, memoryCacheEnabled, redisEnabled
+		_ = hedge.UpdateGroupHedgeDelayByJSONString("{}")
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	config.MemoryCacheEnabled = false
+	common.RedisEnabled = false
+	dbmodel.InitDB()
+	client.Init()
+	if err := hedge.UpdateGroupHedgeDelayByJSONString(`{"default":50}`); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := &hedgeUpstream{
+		behaviours: map[string]map[string]string{
+			"fast":        {"primary": ""},
+			"hedged":      {"primary": "hang", "hedged": ""},
+			"hedge fails": {"primary": "slow", "hedged": "fail"},
+			"disconnect":  {"primary": "hang"},
+		},
+		canceled: make(chan string, 4),
+	}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	var channels []*dbmodel.Channel
+	for i, key := range []string{"primary", "hedged"} {
+		channel := &dbmodel.Channel{Id: i + 1, Type: 1, Key: key, Name: key, Models: "gpt-4o", Group: "default",
+			BaseURL: &server.URL, Status: dbmodel.ChannelStatusEnabled, Config: `{"max_concurrency":1}`}
+		if err := channel.Insert(); err != nil {
+			t.Fatal(err)
+		}
+		channels = append(channels, channel)
+	}
+	primary, hedged := channels[0], channels[1]
+	held := func(channel *dbmodel.Channel) bool {
+		lease, ok := limit.TryAcquire(channel.Id, channel.GetLimits())
+		lease.Release(0)
+		return !ok
+	}
+	waitCanceled := func(name string) {
+		select {
+		case canceled := <-upstream.canceled:
+			if canceled != name {
+				t.Errorf("expected %s to be canceled, got %s", name, canceled)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s should be canceled", name)
+		}
+	}
+	request := func(ctx context.Context, name string) (*gin.Context, *model.GeneralOpenAIRequest, *hedgeAttempt) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		body := fmt.Sprintf(`{"model":"gpt-4o","messages":[{"role":"user","content":%q}]}`, name)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)).WithContext(ctx)
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(ctxkey.Group, "default")
+		c.Set(ctxkey.RequestModel, "gpt-4o")
+		middleware.SetupContextForSelectedChannel(c, primary, "gpt-4o")
+		lease, ok := limit.TryAcquire(primary.Id, primary.GetLimits())
+		if !ok {
+			t.Fatalf("%s: the lease of the primary channel should be free", name)
+		}
+		middleware.SetChannelLease(c, lease)
+		requestMeta := meta.GetByContext(c)
+		textRequest, err := getAndValidateTextRequest(c, requestMeta.Mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestMeta.ActualModelName = textRequest.Model
+		requestAdaptor := relay.GetAdaptor(requestMeta.APIType)
+		requestAdaptor.Init(requestMeta)
+		requestBody, err := getRequestBody(c, requestMeta, textRequest, requestAdaptor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, textRequest, doHedgedRequest(c, requestMeta, textRequest, requestAdaptor, requestBody)
+	}
+	answeredBy := func(attempt *hedgeAttempt) string {
+		if attempt.failed() {
+			return ""
+		}
+		defer attempt.cancel()
+		var response struct {
+			Id string `json:"id"`
+		}
+		_ = json.NewDecoder(attempt.resp.Body).Decode(&response)
+		_ = attempt.resp.Body.Close()
+		return response.Id
+	}
+
+	// the channel of the request answers before the hedge delay
+	c, _, attempt := request(context.Background(), "fast")
+	if attempt.channel != nil || answeredBy(attempt) != "primary" {
+		t.Error("fast: the channel of the request should answer")
+	}
+	if _, ok := upstream.calls.Load("fast/hedged"); ok || held(hedged) {
+		t.Error("fast: no hedge should be sent")
+	}
+	middleware.ReleaseChannelLease(c)
+
+	// the hedge answers first, the channel of the request is canceled
+	c, textRequest, attempt := request(context.Background(), "hedged")
+	if attempt.channel == nil || attempt.channel.Id != hedged.Id {
+		t.Fatal("hedged: the hedged channel should answer")
+	}
+	waitCanceled("hedged/primary")
+	useHedgeWinner(c, attempt, textRequest)
+	if c.GetInt(ctxkey.ChannelId) != hedged.Id || answeredBy(attempt) != "hedged" {
+		t.Error("hedged: the hedged channel should become the channel of the request")
+	}
+	if held(primary) || !held(hedged) {
+		t.Error("hedged: the lease of the hedged channel should replace the one of the request")
+	}
+	middleware.ReleaseChannelLease(c)
+	if held(hedged) {
+		t.Error("hedged: the lease of the hedged channel should be released with the request")
+	}
+
+	// the hedge fails first, the channel of the request still answers
+	c, _, attempt = request(context.Background(), "hedge fails")
+	if attempt.channel != nil || answeredBy(attempt) != "primary" {
+		t.Error("hedge fails: the channel of the request should answer")
+	}
+	if _, ok := upstream.calls.Load("hedge fails/hedged"); !ok {
+		t.Error("hedge fails: a hedge should be sent")
+	}
+	if held(hedged) || !held(primary) {
+		t.Error("hedge fails: the lease of the failed hedge should be released")
+	}
+	middleware.ReleaseChannelLease(c)
+
+	// the client goes away before any channel answers
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	c, _, attempt = request(ctx, "disconnect")
+	waitCanceled("disconnect/primary")
+	if !attempt.failed() {
+		t.Error("disconnect: the request should fail")
+	}
+	attempt.cancel()
+	middleware.ReleaseChannelLease(c)
+}
@@ -21,6 +21,7 @@ import (
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
+	"github.com/songquanpeng/one-api/relay/limit"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
@@ -49,7 +50,9 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 	switch relayMode {
 	case relaymode.ChatCompletions, relaymode.Responses:
 		// Both ChatCompletions and Responses mode use messages internally
-		return openai.CountTokenMessages(textRequest.Messages, textRequest.Model)
+		return openai.CountTokenMessages(textRequest.Messages, textRequest.Model) +
+			openai.CountTokenTools(textRequest.Tools, textRequest.Functions, textRequest.Model) +
+			openai.CountTokenResponseFormat(textRequest.ResponseFormat, textRequest.Model)
 	case relaymode.Completions:
 		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model)
 	case relaymode.Moderations:
@@ -58,17 +61,34 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 	return 0
 }
 
+// getBatchRatio returns the discount of requests executed on behalf of a batch, 1 otherwise
+func getBatchRatio(meta *meta.Meta) float64 {
+	if meta.BatchId != "" {
+		return config.BatchDiscountRatio
+	}
+	return 1
+}
+
 func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64) int64 {
-	preConsumedTokens := config.PreConsumedQuota + int64(promptTokens)
+	requestTokens := int64(promptTokens)
 	if textRequest.MaxTokens != 0 {
-		preConsumedTokens += int64(textRequest.MaxTokens)
+		requestTokens += int64(textRequest.MaxTokens)
+	}
+	if textRequest.N > 1 {
+		// every choice is a completion of its own, and a request of its own when emulated
+		requestTokens *= int64(textRequest.N)
 	}
+	preConsumedTokens := config.PreConsumedQuota + requestTokens
 	return int64(float64(preConsumedTokens) * ratio)
 }
 
 func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
-	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	return preConsumeFixedQuota(ctx, getPreConsumedQuota(textRequest, promptTokens, ratio), meta)
+}
 
+// preConsumeFixedQuota checks the quota of the user and the token against a quota known
+// before the request, and pre-consumes it unless the user has plenty left
+func preConsumeFixedQuota(ctx context.Context, preConsumedQuota int64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
@@ -124,6 +144,15 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
 	logContent := fmt.Sprintf("ratio: %.2f × %.2f × %.2f", modelRatio, groupRatio, completionRatio)
+	if meta.BatchId != "" {
+		logContent += fmt.Sprintf(" × %.2f (batch)", config.BatchDiscountRatio)
+	}
+	if meta.IsCacheHit {
+		logContent += fmt.Sprintf(" × %.2f (cache)", config.ResponseCacheRatio)
+	}
+	if meta.TruncatedMessages > 0 {
+		logContent += fmt.Sprintf(", context truncated: %d messages dropped", meta.TruncatedMessages)
+	}
 	model.RecordConsumeLog(ctx, &model.Log{
 		UserId:            meta.UserId,
 		ChannelId:         meta.ChannelId,
@@ -136,6 +165,8 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		IsStream:          meta.IsStream,
 		ElapsedTime:       helper.CalcElapsedTime(meta.StartTime),
 		SystemPromptReset: systemPromptReset,
+		BatchId:           meta.BatchId,
+		IsCacheHit:        meta.IsCacheHit,
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
@@ -197,3 +228,23 @@ func setSystemPrompt(ctx context.Context, request *relaymodel.GeneralOpenAIReque
 	logger.Infof(ctx, "add system prompt")
 	return true
 }
+
+// otherChannelPicks is the number of random picks tried to find another channel
+const otherChannelPicks = 3
+
+// getOtherChannel picks a channel able to serve the model other than the given one, along
+// with its lease, falling back to the lower priorities. Channels are only picked when accept
+// is nil or accepts them. The channel is nil when there is none.
+func getOtherChannel(group string, modelName string, channelId int, accept func(*model.Channel) bool) (*model.Channel, *limit.Lease) {
+	for i := 0; i < otherChannelPicks; i++ {
+		channel, lease, err := model.CacheGetRandomSatisfiedChannel(group, modelName, i != 0)
+		if err != nil {
+			return nil, nil
+		}
+		if channel.Id != channelId && (accept == nil || accept(channel)) {
+			return channel, lease
+		}
+		lease.Release(0)
+	}
+	return nil, nil
+}
@@ -3,15 +3,19 @@ package controller
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
@@ -21,11 +25,17 @@ import (
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
-func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
+func getImageRequest(c *gin.Context, relayMode int) (*relaymodel.ImageRequest, error) {
 	imageRequest := &relaymodel.ImageRequest{}
-	err := common.UnmarshalBodyReusable(c, imageRequest)
+	var err error
+	if relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations {
+		err = getMultipartImageRequest(c, imageRequest)
+	} else {
+		err = common.UnmarshalBodyReusable(c, imageRequest)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +51,122 @@ func getImageRequest(c *gin.Context, _ int) (*relaymodel.ImageRequest, error) {
 	return imageRequest, nil
 }
 
+func getMultipartImageRequest(c *gin.Context, imageRequest *relaymodel.ImageRequest) error {
+	form, err := parseImageMultipartForm(c)
+	if err != nil {
+		return err
+	}
+	value := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	imageRequest.Model = value("model")
+	imageRequest.Prompt = value("prompt")
+	imageRequest.Size = value("size")
+	imageRequest.Quality = value("quality")
+	imageRequest.ResponseFormat = value("response_format")
+	imageRequest.User = value("user")
+	if n := value("n"); n != "" {
+		imageRequest.N, err = strconv.Atoi(n)
+		if err != nil {
+			return fmt.Errorf("invalid n: %w", err)
+		}
+	}
+	// newer models accept several images as image[], the first one is used for conversion
+	imageRequest.Image, err = getMultipartDataURL(form, "image", "image[]")
+	if err != nil {
+		return err
+	}
+	imageRequest.Mask, err = getMultipartDataURL(form, "mask")
+	return err
+}
+
+// parseImageMultipartForm parses the cached request body, so it also works on retries. The
+// body is limited to config.MaxImageUploadSize, which makes the whole form fit in memory.
+func parseImageMultipartForm(c *gin.Context) (*multipart.Form, error) {
+	if c.Request.MultipartForm != nil {
+		return c.Request.MultipartForm, nil
+	}
+	// the body is usually read and limited by the auth middleware already
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxImageUploadSize)
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	if err = c.Request.ParseMultipartForm(config.MaxImageUploadSize); err != nil {
+		return nil, fmt.Errorf("invalid multipart form: %w", err)
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+	return c.Request.MultipartForm, nil
+}
+
+func getMultipartDataURL(form *multipart.Form, keys ...string) (string, error) {
+	for _, key := range keys {
+		files := form.File[key]
+		if len(files) == 0 {
+			continue
+		}
+		file, err := files[0].Open()
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return "", err
+		}
+		mimeType := files[0].Header.Get("Content-Type")
+		if mimeType == "" || mimeType == "application/octet-stream" {
+			mimeType = http.DetectContentType(data)
+		}
+		return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data)), nil
+	}
+	return "", nil
+}
+
+// rewriteImageMultipartModel rebuilds the multipart body with a mapped model name
+func rewriteImageMultipartModel(form *multipart.Form, modelName string) (*bytes.Buffer, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, values := range form.Value {
+		if key == "model" {
+			continue
+		}
+		for _, value := range values {
+			if err := writer.WriteField(key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := writer.WriteField("model", modelName); err != nil {
+		return nil, "", err
+	}
+	for key, files := range form.File {
+		for _, fileHeader := range files {
+			part, err := writer.CreatePart(fileHeader.Header)
+			if err != nil {
+				return nil, "", err
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				return nil, "", err
+			}
+			_, err = io.Copy(part, file)
+			_ = file.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("copy %s failed: %w", key, err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body, writer.FormDataContentType(), nil
+}
+
 func isValidImageSize(model string, size string) bool {
 	if model == "cogview-3" || billingratio.ImageSizeRatios[model] == nil {
 		return true
@@ -66,12 +192,22 @@ func getImageSizeRatio(model string, size string) float64 {
 	return 1
 }
 
-func validateImageRequest(imageRequest *relaymodel.ImageRequest, _ *meta.Meta) *relaymodel.ErrorWithStatusCode {
-	// check prompt length
-	if imageRequest.Prompt == "" {
+func validateImageRequest(imageRequest *relaymodel.ImageRequest, meta *meta.Meta) *relaymodel.ErrorWithStatusCode {
+	// check prompt length, variations have no prompt
+	if imageRequest.Prompt == "" && meta.Mode != relaymode.ImagesVariations {
 		return openai.ErrorWrapper(errors.New("prompt is required"), "prompt_missing", http.StatusBadRequest)
 	}
 
+	if imageRequest.Image == "" && (meta.Mode == relaymode.ImagesEdits || meta.Mode == relaymode.ImagesVariations) {
+		return openai.ErrorWrapper(errors.New("image is required"), "image_missing", http.StatusBadRequest)
+	}
+
+	// the image apis of Zhipu (CogView) and Baidu (ERNIE) only generate images from a
+	// prompt, neither has an endpoint taking an image to edit or vary
+	if imageRequest.Image != "" && (meta.ChannelType == channeltype.Zhipu || meta.ChannelType == channeltype.Baidu) {
+		return openai.ErrorWrapper(errors.New("image edits and variations are not supported by this channel"), "image_edits_not_supported", http.StatusBadRequest)
+	}
+
 	// model validation
 	if !isValidImageSize(imageRequest.Model, imageRequest.Size) {
 		return openai.ErrorWrapper(errors.New("size not supported for this image model"), "size_not_supported", http.StatusBadRequest)
@@ -135,7 +271,17 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	c.Set("response_format", imageRequest.ResponseFormat)
 
 	var requestBody io.Reader
-	if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
+	// the content type forwarded upstream, multipart for edits and variations unless converted
+	contentType := c.Request.Header.Get("Content-Type")
+	if relayMode == relaymode.ImagesEdits || relayMode == relaymode.ImagesVariations {
+		requestBody = c.Request.Body
+		if isModelMapped {
+			requestBody, contentType, err = rewriteImageMultipartModel(c.Request.MultipartForm, imageRequest.Model)
+			if err != nil {
+				return openai.ErrorWrapper(err, "rewrite_image_request_failed", http.StatusInternalServerError)
+			}
+		}
+	} else if isModelMapped || meta.ChannelType == channeltype.Azure { // make Azure channel request body
 		jsonStr, err := json.Marshal(imageRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
@@ -166,11 +312,12 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			return openai.ErrorWrapper(err, "marshal_image_request_failed", http.StatusInternalServerError)
 		}
 		requestBody = bytes.NewBuffer(jsonStr)
+		contentType = "application/json"
 	}
 
 	modelRatio := billingratio.GetModelRatio(imageModel, meta.ChannelType)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
-	ratio := modelRatio * groupRatio
+	ratio := modelRatio * groupRatio * getBatchRatio(meta)
 	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
 
 	var quota int64
@@ -186,8 +333,11 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
 
-	// do request
+	// do request, keeping the client content type for retries on other channels
+	originContentType := c.Request.Header.Get("Content-Type")
+	c.Request.Header.Set("Content-Type", contentType)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	c.Request.Header.Set("Content-Type", originContentType)
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
@@ -211,6 +361,9 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if quota != 0 {
 			tokenName := c.GetString(ctxkey.TokenName)
 			logContent := fmt.Sprintf("ratio: %.2f × %.2f", modelRatio, groupRatio)
+			if meta.BatchId != "" {
+				logContent += fmt.Sprintf(" × %.2f (batch)", config.BatchDiscountRatio)
+			}
 			model.RecordConsumeLog(ctx, &model.Log{
 				UserId:           meta.UserId,
 				ChannelId:        meta.ChannelId,
@@ -220,6 +373,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 				TokenName:        tokenName,
 				Quota:            int(quota),
 				Content:          logContent,
+				BatchId:          meta.BatchId,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 			channelId := c.GetInt(ctxkey.ChannelId)
@@ -228,11 +382,15 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}(c.Request.Context())
 
 	// do response
-	_, respErr := adaptor.DoResponse(c, resp, meta)
+	usage, respErr := adaptor.DoResponse(c, resp, meta)
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		return respErr
 	}
-
+	if usage == nil || usage.TotalTokens == 0 {
+		promptTokens := openai.CountTokenText(imageRequest.Prompt, imageRequest.Model)
+		usage = &relaymodel.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	c.Set(ctxkey.Usage, usage)
 	return nil
 }
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newImageEditContext(t *testing.T, fields map[string]string, files map[string][]byte) *gin.Context {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		_ = writer.WriteField(key, value)
+	}
+	for key, data := range files {
+		part, err := writer.CreateFormFile(key, key+".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write(data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/edits", body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func TestGetMultipartImageRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newImageEditContext(t, map[string]string{"model": "dall-e-2", "prompt": "a cat", "n": "2"},
+		map[string][]byte{"image": pngHeader, "mask": pngHeader})
+	imageRequest, err := getImageRequest(c, relaymode.ImagesEdits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imageRequest.Model != "dall-e-2" || imageRequest.Prompt != "a cat" || imageRequest.N != 2 || imageRequest.Size != "1024x1024" {
+		t.Errorf("unexpected fields of the form %+v", imageRequest)
+	}
+	// files uploaded as application/octet-stream are sniffed
+	if !strings.HasPrefix(imageRequest.Image, "data:image/png;base64,") || !strings.HasPrefix(imageRequest.Mask, "data:image/png;base64,") {
+		t.Errorf("image and mask should be data URLs, got %.40q and %.40q", imageRequest.Image, imageRequest.Mask)
+	}
+
+	c = newImageEditContext(t, map[string]string{"prompt": "a cat", "n": "two"}, map[string][]byte{"image[]": pngHeader})
+	if _, err = getImageRequest(c, relaymode.ImagesEdits); err == nil {
+		t.Error("invalid n should be rejected")
+	}
+}
+
+func TestGetMultipartImageRequestTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	maxImageUploadSize := config.MaxImageUploadSize
+	defer func() {
+		config.MaxImageUploadSize = maxImageUploadSize
+	}()
+	config.MaxImageUploadSize = 1024
+	c := newImageEditContext(t, map[string]string{"prompt": "a cat"}, map[string][]byte{"image": bytes.Repeat([]byte("a"), 2048)})
+	_, err := getImageRequest(c, relaymode.ImagesEdits)
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		t.Errorf("body beyond the upload limit should be rejected, got %v", err)
+	}
+}
+
+func TestValidateImageEditRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        int
+		channelType int
+		request     relaymodel.ImageRequest
+		code        string
+	}{
+		{"edit", relaymode.ImagesEdits, channeltype.OpenAI, relaymodel.ImageRequest{Model: "dall-e-2", Prompt: "a cat", Image: "data:", Size: "1024x1024", N: 1}, ""},
+		{"variation without prompt", relaymode.ImagesVariations, channeltype.OpenAI, relaymodel.ImageRequest{Model: "dall-e-2", Image: "data:", Size: "1024x1024", N: 1}, ""},
+		{"edit without image", relaymode.ImagesEdits, channeltype.OpenAI, relaymodel.ImageRequest{Model: "dall-e-2", Prompt: "a cat", Size: "1024x1024", N: 1}, "image_missing"},
+		{"edit on zhipu", relaymode.ImagesEdits, channeltype.Zhipu, relaymodel.ImageRequest{Model: "cogview-3", Prompt: "a cat", Image: "data:", N: 1}, "image_edits_not_supported"},
+		{"edit on baidu", relaymode.ImagesEdits, channeltype.Baidu, relaymodel.ImageRequest{Model: "ernie-vilg", Prompt: "a cat", Image: "data:", N: 1}, "image_edits_not_supported"},
+		{"generation on zhipu", relaymode.ImagesGenerations, channeltype.Zhipu, relaymodel.ImageRequest{Model: "cogview-3", Prompt: "a cat", N: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bizErr := validateImageRequest(&tt.request, &meta.Meta{Mode: tt.mode, ChannelType: tt.channelType})
+			var code string
+			if bizErr != nil {
+				code, _ = bizErr.Code.(string)
+			}
+			if code != tt.code {
+				t.Errorf("validateImageRequest() = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRewriteImageMultipartModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newImageEditContext(t, map[string]string{"model": "my-dall-e", "prompt": "a cat"}, map[string][]byte{"image": pngHeader})
+	form, err := parseImageMultipartForm(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, contentType, err := rewriteImageMultipartModel(form, "dall-e-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/v1/images/edits", body)
+	request.Header.Set("Content-Type", contentType)
+	if err = request.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if request.FormValue("model") != "dall-e-2" || request.FormValue("prompt") != "a cat" {
+		t.Errorf("model should be replaced and the other fields kept, got %v", request.MultipartForm.Value)
+	}
+	files := request.MultipartForm.File["image"]
+	if len(files) != 1 || files[0].Filename != "image.png" || files[0].Size != int64(len(pngHeader)) {
+		t.Errorf("image should be kept, got %+v", files)
+	}
+}
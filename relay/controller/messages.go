@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayAnthropicMessagesHelper handles the native Anthropic /v1/messages endpoint
+// by converting to/from chat completions, so any channel can serve Claude clients
+func RelayAnthropicMessagesHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	requestBody, err := getInboundRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	messagesRequest := &anthropic.InboundRequest{}
+	if err = json.Unmarshal(requestBody, messagesRequest); err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	if messagesRequest.Model == "" {
+		return openai.ErrorWrapper(fmt.Errorf("model is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	if len(messagesRequest.Messages) == 0 {
+		return openai.ErrorWrapper(fmt.Errorf("messages is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	chatRequest, err := anthropic.ConvertInboundRequest(messagesRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+	chatBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted anthropic messages request: %s", string(chatBody))
+	setBridgedChatRequest(c, chatBody)
+	bridge := &anthropicMessagesBridge{
+		converter: anthropic.StreamConverter{Model: messagesRequest.Model},
+	}
+	return relayBridgedText(c, bridge, messagesRequest.Stream)
+}
+
+type anthropicMessagesBridge struct {
+	converter anthropic.StreamConverter
+}
+
+func (b *anthropicMessagesBridge) convertResponse(body []byte) ([]byte, error) {
+	var chatResponse openai.TextResponse
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, err
+	}
+	return json.Marshal(anthropic.ResponseOpenAI2Claude(&chatResponse))
+}
+
+func (b *anthropicMessagesBridge) convertStreamData(data string) []byte {
+	var events []anthropic.StreamEvent
+	if data == "[DONE]" {
+		events = b.converter.Finish()
+	} else {
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			return nil
+		}
+		events = b.converter.Convert(&chunk)
+	}
+	var converted []byte
+	for _, event := range events {
+		converted = append(converted, anthropic.EncodeStreamEvent(event)...)
+	}
+	return converted
+}
+
+// AnthropicErrorType maps an OpenAI style error to the error type used by the Messages API
+func AnthropicErrorType(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
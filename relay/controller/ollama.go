@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/adaptor/ollama"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayOllamaHelper handles the native Ollama /api/chat, /api/generate and
+// /api/embed endpoints by converting to/from chat completions and embeddings
+func RelayOllamaHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	requestBody, err := getInboundRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	var request *model.GeneralOpenAIRequest
+	switch relayMode {
+	case relaymode.OllamaChat:
+		chatRequest := &ollama.InboundChatRequest{}
+		if err = json.Unmarshal(requestBody, chatRequest); err != nil {
+			return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+		}
+		if len(chatRequest.Messages) == 0 {
+			return openai.ErrorWrapper(fmt.Errorf("messages is required"), "invalid_request_error", http.StatusBadRequest)
+		}
+		if request, err = ollama.ConvertInboundChatRequest(chatRequest); err != nil {
+			return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+		}
+	case relaymode.OllamaGenerate:
+		generateRequest := &ollama.GenerateRequest{}
+		if err = json.Unmarshal(requestBody, generateRequest); err != nil {
+			return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+		}
+		request = ollama.ConvertGenerateRequest(generateRequest)
+	case relaymode.OllamaEmbed:
+		embeddingRequest := &ollama.InboundEmbeddingRequest{}
+		if err = json.Unmarshal(requestBody, embeddingRequest); err != nil {
+			return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+		}
+		request = ollama.ConvertInboundEmbeddingRequest(embeddingRequest)
+	}
+	if request.Model == "" {
+		return openai.ErrorWrapper(fmt.Errorf("model is required"), "invalid_request_error", http.StatusBadRequest)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted ollama request: %s", string(body))
+	if relayMode == relaymode.OllamaEmbed {
+		setBridgedRequest(c, "/v1/embeddings", body)
+		return relayBridgedText(c, &ollamaEmbedBridge{}, false)
+	}
+	setBridgedChatRequest(c, body)
+	bridge := &ollamaChatBridge{
+		converter: ollama.StreamConverter{Model: request.Model, Generate: relayMode == relaymode.OllamaGenerate},
+	}
+	return relayBridgedText(c, bridge, request.Stream)
+}
+
+// ollamaChatBridge writes newline delimited JSON, the stream format of Ollama
+type ollamaChatBridge struct {
+	converter ollama.StreamConverter
+}
+
+func (b *ollamaChatBridge) streamContentType() string {
+	return "application/x-ndjson"
+}
+
+func (b *ollamaChatBridge) convertResponse(body []byte) ([]byte, error) {
+	var chatResponse openai.TextResponse
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, err
+	}
+	return ollama.MarshalResponse(ollama.ResponseOpenAI2Ollama(&chatResponse, b.converter.Generate), b.converter.Generate)
+}
+
+func (b *ollamaChatBridge) convertStreamData(data string) []byte {
+	var response *ollama.ChatResponse
+	if data == "[DONE]" {
+		response = b.converter.Finish()
+	} else {
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			return nil
+		}
+		if response = b.converter.Convert(&chunk); response == nil {
+			return nil
+		}
+	}
+	jsonData, err := ollama.MarshalResponse(response, b.converter.Generate)
+	if err != nil {
+		logger.SysError("error marshalling stream response: " + err.Error())
+		return nil
+	}
+	return append(jsonData, '\n')
+}
+
+type ollamaEmbedBridge struct{}
+
+func (b *ollamaEmbedBridge) convertResponse(body []byte) ([]byte, error) {
+	var embeddingResponse openai.EmbeddingResponse
+	if err := json.Unmarshal(body, &embeddingResponse); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ollama.EmbeddingResponseOpenAI2Ollama(&embeddingResponse))
+}
+
+func (b *ollamaEmbedBridge) convertStreamData(data string) []byte {
+	return nil
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// https://platform.openai.com/docs/guides/realtime-websocket
+
+var realtimeUpgrader = websocket.Upgrader{
+	Subprotocols: []string{"realtime"},
+	// the api is open to any origin, the same as the CORS policy of the other endpoints
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// RelayRealtimeHelper proxies a realtime WebSocket session to the selected channel
+// and bills every response.done event while the session is open
+func RelayRealtimeHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	meta.IsStream = true
+	meta.ActualModelName, _ = getMappedModelName(meta.OriginModelName, meta.ModelMapping)
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		return openai.ErrorWrapper(errors.New("the realtime api requires a websocket connection"), "websocket_upgrade_required", http.StatusBadRequest)
+	}
+	tokenKey := c.GetString(ctxkey.TokenKey)
+	if err := realtimeQuotaError(ctx, meta, tokenKey); err != nil {
+		return openai.ErrorWrapper(err, "insufficient_quota", http.StatusForbidden)
+	}
+
+	upstreamURL, err := openai.GetRealtimeURL(meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_channel_type", http.StatusBadRequest)
+	}
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	upstream, resp, err := dialer.DialContext(ctx, upstreamURL, openai.GetRealtimeHeader(meta))
+	if err != nil {
+		logger.Errorf(ctx, "dial realtime upstream failed: %s", err.Error())
+		if resp != nil {
+			// the handshake was rejected, the body holds the upstream error
+			return RelayErrorHandler(resp)
+		}
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	client, err := realtimeUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already replied to the client
+		logger.Errorf(ctx, "upgrade realtime connection failed: %s", err.Error())
+		_ = upstream.Close()
+		return nil
+	}
+
+	session := &realtimeSession{
+		ctx:        ctx,
+		meta:       meta,
+		tokenKey:   tokenKey,
+		client:     client,
+		upstream:   upstream,
+		modelRatio: billingratio.GetModelRatio(meta.ActualModelName, meta.ChannelType),
+		groupRatio: billingratio.GetGroupRatio(meta.Group),
+	}
+	session.run()
+	c.Set(ctxkey.Usage, &session.usage)
+	return nil
+}
+
+// realtimeQuotaError returns an error once the user or the token can no longer pay for a
+// response, it is checked after every response so both are read from the cache
+func realtimeQuotaError(ctx context.Context, meta *meta.Meta, tokenKey string) error {
+	userQuota, err := dbmodel.CacheGetUserQuota(ctx, meta.UserId)
+	if err != nil {
+		return err
+	}
+	if userQuota <= 0 {
+		return errors.New("user quota is not enough")
+	}
+	token, err := dbmodel.CacheGetTokenByKey(tokenKey)
+	if err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		return errors.New("token quota is not enough")
+	}
+	return nil
+}
+
+type realtimeSession struct {
+	ctx        context.Context
+	meta       *meta.Meta
+	tokenKey   string
+	client     *websocket.Conn
+	upstream   *websocket.Conn
+	modelRatio float64
+	groupRatio float64
+	closeOnce  sync.Once
+	// usage sums up the responses of the session
+	usage model.Usage
+}
+
+// run forwards messages in both directions until either side goes away
+func (s *realtimeSession) run() {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer s.close(websocket.CloseNormalClosure, "")
+		for {
+			messageType, data, err := s.client.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = s.upstream.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}()
+	s.relayUpstream()
+	wg.Wait()
+}
+
+func (s *realtimeSession) relayUpstream() {
+	for {
+		messageType, data, err := s.upstream.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+				s.close(closeErr.Code, closeErr.Text)
+			} else {
+				s.close(websocket.CloseNormalClosure, "")
+			}
+			return
+		}
+		var quotaErr error
+		if messageType == websocket.TextMessage {
+			quotaErr = s.meter(data)
+		}
+		if err = s.client.WriteMessage(messageType, data); err != nil {
+			s.close(websocket.CloseNormalClosure, "")
+			return
+		}
+		if quotaErr != nil {
+			logger.Infof(s.ctx, "closing realtime session of user %d: %s", s.meta.UserId, quotaErr.Error())
+			_ = s.client.WriteJSON(model.RealtimeErrorEvent{
+				Type: "error",
+				Error: model.Error{
+					Message: quotaErr.Error(),
+					Type:    "insufficient_quota",
+					Code:    "insufficient_quota",
+				},
+			})
+			s.close(websocket.ClosePolicyViolation, "insufficient quota")
+			return
+		}
+	}
+}
+
+// close tells both sides the session is over and drops the connections
+func (s *realtimeSession) close(code int, text string) {
+	s.closeOnce.Do(func() {
+		message := websocket.FormatCloseMessage(code, text)
+		deadline := time.Now().Add(time.Second)
+		_ = s.client.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.upstream.WriteControl(websocket.CloseMessage, message, deadline)
+		_ = s.client.Close()
+		_ = s.upstream.Close()
+	})
+}
+
+// meter bills a finished response and reports whether the session may go on
+func (s *realtimeSession) meter(data []byte) error {
+	var event model.RealtimeEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		logger.Errorf(s.ctx, "unmarshal realtime event failed: %s", err.Error())
+		return nil
+	}
+	if event.Type != model.RealtimeEventTypeResponseDone || event.Response == nil || event.Response.Usage == nil {
+		return nil
+	}
+	s.consume(event.Response.Usage)
+	return realtimeQuotaError(s.ctx, s.meta, s.tokenKey)
+}
+
+func (s *realtimeSession) consume(usage *model.RealtimeUsage) {
+	s.usage.PromptTokens += usage.InputTokens
+	s.usage.CompletionTokens += usage.OutputTokens
+	s.usage.TotalTokens += usage.InputTokens + usage.OutputTokens
+	modelName := s.meta.ActualModelName
+	textInput, audioInput := usage.InputTokenDetails.TextTokens, usage.InputTokenDetails.AudioTokens
+	if textInput+audioInput == 0 {
+		textInput = usage.InputTokens
+	}
+	textOutput, audioOutput := usage.OutputTokenDetails.TextTokens, usage.OutputTokenDetails.AudioTokens
+	if textOutput+audioOutput == 0 {
+		textOutput = usage.OutputTokens
+	}
+	completionRatio := billingratio.GetCompletionRatio(modelName, s.meta.ChannelType)
+	audioRatio := billingratio.GetAudioRatio(modelName)
+	audioCompletionRatio := billingratio.GetAudioCompletionRatio(modelName)
+	ratio := s.modelRatio * s.groupRatio
+	tokens := float64(textInput) + float64(textOutput)*completionRatio +
+		(float64(audioInput)+float64(audioOutput)*audioCompletionRatio)*audioRatio
+	quota := int64(math.Ceil(tokens * ratio))
+	if ratio != 0 && quota <= 0 && usage.TotalTokens > 0 {
+		quota = 1
+	}
+	if quota == 0 {
+		return
+	}
+	err := dbmodel.PostConsumeTokenQuota(s.meta.TokenId, quota)
+	if err != nil {
+		logger.Error(s.ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = dbmodel.CacheUpdateUserQuota(s.ctx, s.meta.UserId)
+	if err != nil {
+		logger.Error(s.ctx, "error update user quota cache: "+err.Error())
+	}
+	logContent := fmt.Sprintf("ratio: %.2f × %.2f × %.2f, audio: %.2f × %.2f (%d in, %d out)",
+		s.modelRatio, s.groupRatio, completionRatio, audioRatio, audioCompletionRatio, audioInput, audioOutput)
+	dbmodel.RecordConsumeLog(s.ctx, &dbmodel.Log{
+		UserId:           s.meta.UserId,
+		ChannelId:        s.meta.ChannelId,
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		ModelName:        modelName,
+		TokenName:        s.meta.TokenName,
+		Quota:            int(quota),
+		Content:          logContent,
+		IsStream:         true,
+		ElapsedTime:      helper.CalcElapsedTime(s.meta.StartTime),
+	})
+	dbmodel.UpdateUserUsedQuotaAndRequestCount(s.meta.UserId, quota)
+	dbmodel.UpdateChannelUsedQuota(s.meta.ChannelId, quota)
+}
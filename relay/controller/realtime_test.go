@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// lastConsumeQuota returns the quota of the latest consume log, or 0 if there is none
+func lastConsumeQuota() int {
+	var log dbmodel.Log
+	if err := dbmodel.LOG_DB.Where("type = ?", dbmodel.LogTypeConsume).Order("id desc").Limit(1).Find(&log).Error; err != nil {
+		return 0
+	}
+	return log.Quota
+}
+
+func TestRealtimeSessionConsume(t *testing.T) {
+	setupTextRelay(t)
+	tests := []struct {
+		name       string
+		modelRatio float64
+		usage      model.RealtimeUsage
+		want       int
+	}{
+		{
+			// 10 + 5×4 + (20 + 10×2)×8
+			name:       "text and audio",
+			modelRatio: 1,
+			usage: model.RealtimeUsage{TotalTokens: 45, InputTokens: 30, OutputTokens: 15,
+				InputTokenDetails:  model.RealtimeTokenDetails{TextTokens: 10, AudioTokens: 20},
+				OutputTokenDetails: model.RealtimeTokenDetails{TextTokens: 5, AudioTokens: 10}},
+			want: 350,
+		},
+		{
+			// without details every token is a text token, 10 + 5×4
+			name:       "no token details",
+			modelRatio: 1,
+			usage:      model.RealtimeUsage{TotalTokens: 15, InputTokens: 10, OutputTokens: 5},
+			want:       30,
+		},
+		{
+			name:       "model ratio",
+			modelRatio: 2.5,
+			usage:      model.RealtimeUsage{TotalTokens: 15, InputTokens: 10, OutputTokens: 5},
+			want:       75,
+		},
+		{
+			name:       "minimum quota",
+			modelRatio: 1,
+			usage:      model.RealtimeUsage{TotalTokens: 1},
+			want:       1,
+		},
+		{
+			name:       "free model",
+			modelRatio: 0,
+			usage:      model.RealtimeUsage{TotalTokens: 15, InputTokens: 10, OutputTokens: 5},
+			want:       0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbmodel.LOG_DB.Where("1 = 1").Delete(&dbmodel.Log{})
+			s := &realtimeSession{
+				ctx:        context.Background(),
+				meta:       &meta.Meta{UserId: 1, TokenId: 1, ChannelId: 1, ChannelType: channeltype.OpenAI, ActualModelName: "gpt-4o-realtime-preview-2024-12-17"},
+				tokenKey:   "token",
+				modelRatio: tt.modelRatio,
+				groupRatio: 1,
+			}
+			s.consume(&tt.usage)
+			assert.Equal(t, tt.want, lastConsumeQuota())
+			assert.Equal(t, tt.usage.InputTokens, s.usage.PromptTokens)
+			assert.Equal(t, tt.usage.OutputTokens, s.usage.CompletionTokens)
+		})
+	}
+}
+
+func TestRealtimeSessionMeter(t *testing.T) {
+	setupTextRelay(t)
+	token := &dbmodel.Token{Id: 2, UserId: 1, Key: "limited", Name: "limited", Status: dbmodel.TokenStatusEnabled, ExpiredTime: -1, RemainQuota: 40}
+	if err := dbmodel.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := &realtimeSession{
+		ctx:        context.Background(),
+		meta:       &meta.Meta{UserId: 1, TokenId: 2, ChannelId: 1, ChannelType: channeltype.OpenAI, ActualModelName: "gpt-4o-realtime-preview-2024-12-17"},
+		tokenKey:   "limited",
+		modelRatio: 1,
+		groupRatio: 1,
+	}
+	done := []byte(`{"type":"response.done","response":{"id":"r1","status":"completed","usage":{"total_tokens":15,"input_tokens":10,"output_tokens":5}}}`)
+
+	// events other than a finished response are not billed
+	assert.NoError(t, s.meter([]byte(`{"type":"response.text.delta","delta":"hi"}`)))
+	assert.NoError(t, s.meter([]byte(`not json`)))
+	assert.Equal(t, 0, s.usage.TotalTokens)
+
+	// the token pays for the first response and runs out with the second
+	assert.NoError(t, s.meter(done))
+	assert.Error(t, s.meter(done))
+	assert.Equal(t, 30, s.usage.TotalTokens)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RelayRerankHelper reranks documents against a query, Cohere models are billed
+// per search unit of documents and every other model per token
+func RelayRerankHelper(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := meta.GetByContext(c)
+	rerankRequest := &model.RerankRequest{}
+	if err := common.UnmarshalBodyReusable(c, rerankRequest); err != nil {
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.Model == "" {
+		return openai.ErrorWrapper(errors.New("model is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if rerankRequest.Query == "" {
+		return openai.ErrorWrapper(errors.New("query is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if len(rerankRequest.Documents) == 0 {
+		return openai.ErrorWrapper(errors.New("documents is required"), "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model, _ = getMappedModelName(rerankRequest.Model, meta.ModelMapping)
+	meta.ActualModelName = rerankRequest.Model
+
+	a := relay.GetAdaptor(meta.APIType)
+	if a == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	rerankAdaptor, ok := a.(adaptor.RerankAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(fmt.Errorf("channel type %d does not support rerank", meta.ChannelType), "invalid_channel_type", http.StatusBadRequest)
+	}
+	a.Init(meta)
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(rerankRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	logger.Debugf(ctx, "converted rerank request: %s", string(jsonData))
+
+	modelRatio := billingratio.GetModelRatio(rerankRequest.Model, meta.ChannelType)
+	groupRatio := billingratio.GetGroupRatio(meta.Group)
+	ratio := modelRatio * groupRatio * getBatchRatio(meta)
+	searchUnits := 0
+	if billingratio.IsSearchUnitRerankModel(rerankRequest.Model) {
+		searchUnits = billingratio.GetRerankSearchUnits(len(rerankRequest.Documents))
+	}
+	// the model scores every document together with the query
+	documentTexts := rerankRequest.DocumentTexts()
+	queryTokens := openai.CountTokenText(rerankRequest.Query, rerankRequest.Model)
+	promptTokens := queryTokens * len(documentTexts)
+	for _, text := range documentTexts {
+		promptTokens += openai.CountTokenText(text, rerankRequest.Model)
+	}
+	meta.PromptTokens = promptTokens
+
+	textRequest := &model.GeneralOpenAIRequest{Model: rerankRequest.Model}
+	// the search units are known before the request and billed as they are
+	searchUnitQuota := int64(ratio*1000) * int64(searchUnits)
+	var preConsumedQuota int64
+	var bizErr *model.ErrorWithStatusCode
+	if searchUnits > 0 {
+		preConsumedQuota, bizErr = preConsumeFixedQuota(ctx, searchUnitQuota, meta)
+	} else {
+		preConsumedQuota, bizErr = preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	}
+	if bizErr != nil {
+		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
+		return bizErr
+	}
+
+	resp, err := a.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return RelayErrorHandler(resp)
+	}
+	usage, respErr := a.DoResponse(c, resp, meta)
+	if respErr != nil {
+		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+
+	if usage == nil || usage.TotalTokens == 0 {
+		// jina and xinference always count tokens, a local server may not
+		usage = &model.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	c.Set(ctxkey.Usage, usage)
+	if searchUnits > 0 {
+		go postConsumeSearchUnitQuota(ctx, meta, searchUnitQuota, preConsumedQuota, searchUnits, modelRatio, groupRatio)
+		return nil
+	}
+	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, false)
+	return nil
+}
+
+func postConsumeSearchUnitQuota(ctx context.Context, meta *meta.Meta, quota int64, preConsumedQuota int64, searchUnits int, modelRatio float64, groupRatio float64) {
+	err := dbmodel.PostConsumeTokenQuota(meta.TokenId, quota-preConsumedQuota)
+	if err != nil {
+		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
+	}
+	err = dbmodel.CacheUpdateUserQuota(ctx, meta.UserId)
+	if err != nil {
+		logger.Error(ctx, "error update user quota cache: "+err.Error())
+	}
+	if quota == 0 {
+		return
+	}
+	logContent := fmt.Sprintf("ratio: %.2f × %.2f", modelRatio, groupRatio)
+	if meta.BatchId != "" {
+		logContent += fmt.Sprintf(" × %.2f (batch)", config.BatchDiscountRatio)
+	}
+	logContent += fmt.Sprintf(", search units: %d", searchUnits)
+	dbmodel.RecordConsumeLog(ctx, &dbmodel.Log{
+		UserId:       meta.UserId,
+		ChannelId:    meta.ChannelId,
+		PromptTokens: meta.PromptTokens,
+		ModelName:    meta.ActualModelName,
+		TokenName:    meta.TokenName,
+		Quota:        int(quota),
+		Content:      logContent,
+		ElapsedTime:  helper.CalcElapsedTime(meta.StartTime),
+		BatchId:      meta.BatchId,
+	})
+	dbmodel.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
+	dbmodel.UpdateChannelUsedQuota(meta.ChannelId, quota)
+}
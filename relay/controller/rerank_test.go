@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestRelayRerankSearchUnitQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sqlitePath, redisEnabled, approximateTokenEnabled := common.SQLitePath, common.RedisEnabled, config.ApproximateTokenEnabled
+	defer func() {
+		common.SQLitePath, common.RedisEnabled, config.ApproximateTokenEnabled = sqlitePath, redisEnabled, approximateTokenEnabled
+	}()
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	common.RedisEnabled = false
+	// the encoders of tiktoken are downloaded
+	config.ApproximateTokenEnabled = true
+	dbmodel.InitDB()
+	dbmodel.InitLogDB()
+	client.Init()
+
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"results":[{"index":0,"relevance_score":0.9}]}`)
+	}))
+	defer upstream.Close()
+	user := &dbmodel.User{Id: 1, Username: "user", Password: "12345678", Group: "default", Status: dbmodel.UserStatusEnabled, AffCode: "user", AccessToken: "user", Quota: 500}
+	if err := dbmodel.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := &dbmodel.Token{Id: 1, UserId: 1, Key: "token", Name: "token", Status: dbmodel.TokenStatusEnabled, ExpiredTime: -1, RemainQuota: 500}
+	if err := dbmodel.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+	rerank := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/rerank", strings.NewReader(`{"model":"rerank-v3.5","query":"q","documents":["a","b"]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set("Authorization", "Bearer key")
+		c.Set(ctxkey.Id, 1)
+		c.Set(ctxkey.TokenId, 1)
+		c.Set(ctxkey.Group, "default")
+		c.Set(ctxkey.Channel, channeltype.OpenAI)
+		c.Set(ctxkey.ChannelId, 1)
+		c.Set(ctxkey.BaseURL, upstream.URL)
+		if bizErr := RelayRerankHelper(c); bizErr != nil {
+			w.Code = bizErr.StatusCode
+		}
+		return w
+	}
+	// one search unit of rerank-v3.5 costs 1000
+	const searchUnitQuota = 1000
+
+	if w := rerank(); w.Code != http.StatusForbidden || atomic.LoadInt32(&calls) != 0 {
+		t.Errorf("search units beyond the quota of the user should be rejected, got %d", w.Code)
+	}
+	if err := dbmodel.DB.Model(user).Update("quota", 50000).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := rerank(); w.Code != http.StatusForbidden || atomic.LoadInt32(&calls) != 0 {
+		t.Errorf("search units beyond the quota of the token should be rejected, got %d", w.Code)
+	}
+
+	if err := dbmodel.DB.Model(token).Update("remain_quota", 10000).Error; err != nil {
+		t.Fatal(err)
+	}
+	if w := rerank(); w.Code != http.StatusOK || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("search units within the quota should be relayed, got %d", w.Code)
+	}
+	// the search units are billed in the background, on top of the pre-consumed quota
+	var log dbmodel.Log
+	for i := 0; i < 100 && dbmodel.LOG_DB.Where("type = ?", dbmodel.LogTypeConsume).First(&log).Error != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if log.Quota != searchUnitQuota {
+		t.Errorf("one search unit should be billed, got %d", log.Quota)
+	}
+	remainQuota, _ := dbmodel.GetTokenById(1)
+	userQuota, _ := dbmodel.GetUserQuota(1)
+	if remainQuota.RemainQuota != 10000-searchUnitQuota || userQuota != 50000-searchUnitQuota {
+		t.Errorf("search units should be consumed once, %d left on the token and %d on the user", remainQuota.RemainQuota, userQuota)
+	}
+}
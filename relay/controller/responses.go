@@ -1,17 +1,20 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/model"
 )
@@ -21,17 +24,20 @@ import (
 func RelayResponsesHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	ctx := c.Request.Context()
 
-	// Parse responses request
-	responsesReq := &model.ResponsesRequest{}
-	err := common.UnmarshalBodyReusable(c, responsesReq)
+	// Parse responses request, retries must read the original body
+	requestBody, err := getInboundRequestBody(c)
 	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	responsesReq := &model.ResponsesRequest{}
+	if err = json.Unmarshal(requestBody, responsesReq); err != nil {
 		logger.Errorf(ctx, "failed to parse responses request: %s", err.Error())
 		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
 	}
 
 	// Log request details (without sensitive data) - use debug level for high-traffic scenarios
-	logger.Debugf(ctx, "responses request: model=%s, stream=%v, has_input=%v, has_messages=%v",
-		responsesReq.Model, responsesReq.Stream, responsesReq.Input != nil, len(responsesReq.Messages) > 0)
+	logger.Debugf(ctx, "responses request: model=%s, stream=%v, has_input=%v, has_messages=%v, previous_response_id=%s",
+		responsesReq.Model, responsesReq.Stream, responsesReq.Input != nil, len(responsesReq.Messages) > 0, responsesReq.PreviousResponseID)
 
 	// Validate request
 	if responsesReq.Model == "" {
@@ -39,21 +45,30 @@ func RelayResponsesHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 
 	// Convert to messages format
-	messages := responsesReq.ParseInput()
-	if len(messages) == 0 {
+	input := responsesReq.ParseInput()
+	if len(input) == 0 {
 		return openai.ErrorWrapper(fmt.Errorf("either input or messages must be provided"), "invalid_request_error", http.StatusBadRequest)
 	}
 
+	// Rebuild the conversation stored on the server
+	history, bizErr := loadResponseHistory(c, responsesReq.PreviousResponseID)
+	if bizErr != nil {
+		return bizErr
+	}
+	var messages []model.Message
+	// instructions apply to this request only, they are not stored with the turn
+	if responsesReq.Instructions != "" {
+		messages = append(messages, model.Message{Role: "system", Content: responsesReq.Instructions})
+	}
+	messages = append(messages, history...)
+	messages = append(messages, input...)
+
 	logger.Debugf(ctx, "converted to %d message(s) for chat completion", len(messages))
 
 	// Create a ChatCompletion request from Responses request
-	chatReq := &model.GeneralOpenAIRequest{
-		Model:       responsesReq.Model,
-		Messages:    messages,
-		Stream:      responsesReq.Stream,
-		MaxTokens:   responsesReq.MaxTokens,
-		Temperature: responsesReq.Temperature,
-		TopP:        responsesReq.TopP,
+	chatReq, err := convertResponsesToChatRequest(responsesReq, messages)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
 	}
 
 	// Marshal back to JSON and set as request body for downstream processing
@@ -65,282 +80,365 @@ func RelayResponsesHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	logger.Debugf(ctx, "converted request body length: %d bytes", len(reqBody))
 
-	// Replace request body with chat completions format
-	c.Request.Body = io.NopCloser(strings.NewReader(string(reqBody)))
-	c.Request.ContentLength = int64(len(reqBody))
-	// Update cached request body so downstream validation uses the converted payload
-	c.Set(ctxkey.KeyRequestBody, reqBody)
-
-	// Store original stream setting for response conversion
-	c.Set("responses_mode", true)
-	c.Set("responses_stream", responsesReq.Stream)
+	setBridgedChatRequest(c, reqBody)
+	store := config.ResponsesStoreDefault
+	if responsesReq.Store != nil {
+		store = *responsesReq.Store
+	}
+	bridge := &responsesBridge{
+		request:  responsesReq,
+		store:    store,
+		isStream: responsesReq.Stream,
+	}
+	bridge.stream.template = bridge.newResponse("resp_"+random.GetRandomString(24), helper.GetTimestamp())
+	if bizErr = relayBridgedText(c, bridge, responsesReq.Stream); bizErr != nil {
+		return bizErr
+	}
+	if store {
+		// the client already has its response, a storage failure only breaks later chaining
+		if err = storeResponse(c, bridge.getResponse(), input); err != nil {
+			logger.Errorf(ctx, "failed to store response %s: %s", bridge.stream.template.ID, err.Error())
+		}
+	}
+	return nil
+}
 
-	// Call the existing text relay helper which handles all the pipeline
-	// We need to intercept the response to convert it back to Responses format
+// convertResponsesToChatRequest maps the Responses API parameters onto a chat completion request
+func convertResponsesToChatRequest(responsesReq *model.ResponsesRequest, messages []model.Message) (*model.GeneralOpenAIRequest, error) {
+	chatReq := &model.GeneralOpenAIRequest{
+		Model:            responsesReq.Model,
+		Messages:         messages,
+		Stream:           responsesReq.Stream,
+		MaxTokens:        responsesReq.MaxTokens,
+		Temperature:      responsesReq.Temperature,
+		TopP:             responsesReq.TopP,
+		ParallelTooCalls: responsesReq.ParallelToolCalls,
+		User:             responsesReq.User,
+	}
+	if responsesReq.MaxOutputTokens > 0 {
+		chatReq.MaxTokens = responsesReq.MaxOutputTokens
+	}
 	if responsesReq.Stream {
-		return relayResponsesStream(c, chatReq)
-	} else {
-		return relayResponsesNonStream(c, chatReq)
+		// usage is part of the response.completed event
+		chatReq.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+	for _, tool := range responsesReq.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported, only function tools are", tool.Type)
+		}
+		chatReq.Tools = append(chatReq.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
 	}
+	switch toolChoice := responsesReq.ToolChoice.(type) {
+	case nil:
+	case string:
+		chatReq.ToolChoice = toolChoice
+	case map[string]any:
+		name, _ := toolChoice["name"].(string)
+		if toolChoice["type"] != "function" || name == "" {
+			return nil, fmt.Errorf("tool_choice of type %v is not supported", toolChoice["type"])
+		}
+		chatReq.ToolChoice = map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": name},
+		}
+	}
+	if responsesReq.Text != nil && responsesReq.Text.Format != nil {
+		switch format := responsesReq.Text.Format; format.Type {
+		case "json_schema":
+			chatReq.ResponseFormat = &model.ResponseFormat{
+				Type: "json_schema",
+				JsonSchema: &model.JSONSchema{
+					Name:        format.Name,
+					Description: format.Description,
+					Schema:      format.Schema,
+					Strict:      format.Strict,
+				},
+			}
+		case "json_object":
+			chatReq.ResponseFormat = &model.ResponseFormat{Type: "json_object"}
+		}
+	}
+	if responsesReq.Reasoning != nil {
+		chatReq.ReasoningEffort = responsesReq.Reasoning.Effort
+	}
+	return chatReq, nil
 }
 
-// relayResponsesNonStream handles non-streaming responses
-func relayResponsesNonStream(c *gin.Context, chatReq *model.GeneralOpenAIRequest) *model.ErrorWithStatusCode {
-	// Use existing text helper but we'll intercept and convert the response
-	// Create a custom response writer to capture the response
-	writer := &responsesResponseWriter{
-		ResponseWriter: c.Writer,
-		context:        c,
-		isStream:       false,
-		buffer:         make([]byte, 0, 4096),
-	}
-	c.Writer = writer
-
-	// Call existing chat completions pipeline
-	err := RelayTextHelper(c)
+// GetStoredResponse loads a stored response of the user
+func GetStoredResponse(id string, userId int) (*dbmodel.Response, *model.StoredResponse, error) {
+	record, err := dbmodel.GetResponseById(id, userId)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	// Finalize and convert the buffered response
-	if finalizeErr := writer.finalizeNonStream(); finalizeErr != nil {
-		logger.Errorf(c.Request.Context(), "failed to finalize non-stream response: %s", finalizeErr.Error())
-		return openai.ErrorWrapper(finalizeErr, "finalize_response_failed", http.StatusInternalServerError)
+	content, err := record.Open()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return nil
+	defer content.Close()
+	stored := &model.StoredResponse{}
+	if err = json.NewDecoder(content).Decode(stored); err != nil {
+		return nil, nil, err
+	}
+	return record, stored, nil
 }
 
-// relayResponsesStream handles streaming responses
-func relayResponsesStream(c *gin.Context, chatReq *model.GeneralOpenAIRequest) *model.ErrorWithStatusCode {
-	// Use existing text helper with stream mode
-	writer := &responsesResponseWriter{
-		ResponseWriter: c.Writer,
-		context:        c,
-		isStream:       true,
-		buffer:         make([]byte, 0),
-	}
-	c.Writer = writer
+// loadResponseHistory follows previous_response_id back to the first stored
+// turn and returns the messages of the whole conversation in order
+func loadResponseHistory(c *gin.Context, previousResponseId string) ([]model.Message, *model.ErrorWithStatusCode) {
+	var turns [][]model.Message
+	for id := previousResponseId; id != ""; {
+		if len(turns) >= config.ResponsesMaxChainDepth {
+			return nil, openai.ErrorWrapper(fmt.Errorf("the conversation is longer than %d stored responses", config.ResponsesMaxChainDepth),
+				"previous_response_chain_too_long", http.StatusBadRequest)
+		}
+		record, stored, err := GetStoredResponse(id, c.GetInt(ctxkey.Id))
+		if err != nil {
+			logger.Warnf(c.Request.Context(), "failed to load previous response %s: %s", id, err.Error())
+			return nil, openai.ErrorWrapper(fmt.Errorf("previous response with id '%s' not found", id),
+				"previous_response_not_found", http.StatusNotFound)
+		}
+		turns = append(turns, append(stored.Input, stored.Output...))
+		id = record.PreviousResponseId
+	}
+	var messages []model.Message
+	for i := len(turns) - 1; i >= 0; i-- {
+		messages = append(messages, turns[i]...)
+	}
+	return messages, nil
+}
 
-	// Call existing chat completions pipeline
-	err := RelayTextHelper(c)
+func storeResponse(c *gin.Context, response *model.ResponsesResponse, input []model.Message) error {
+	content, err := json.Marshal(model.StoredResponse{
+		Input:    input,
+		Output:   convertResponsesOutputToMessages(response.Output),
+		Response: response,
+	})
 	if err != nil {
 		return err
 	}
-
-	return nil
-}
-
-// responsesResponseWriter intercepts the response and converts ChatCompletion to Responses format
-type responsesResponseWriter struct {
-	gin.ResponseWriter
-	context    *gin.Context
-	isStream   bool
-	buffer     []byte
-	statusCode int
+	return dbmodel.CreateResponse(&dbmodel.Response{
+		Id:                 response.ID,
+		UserId:             c.GetInt(ctxkey.Id),
+		TokenId:            c.GetInt(ctxkey.TokenId),
+		PreviousResponseId: response.PreviousResponseID,
+		Model:              response.Model,
+	}, bytes.NewReader(content))
 }
 
-func (w *responsesResponseWriter) Write(data []byte) (int, error) {
-	if !w.isStream {
-		// Non-streaming: buffer all data until we have the complete response
-		w.buffer = append(w.buffer, data...)
-		// Return the length of data to indicate successful write
-		return len(data), nil
+// convertResponsesOutputToMessages turns the output of a response back into the
+// assistant message replayed by later turns, reasoning is not sent back upstream
+func convertResponsesOutputToMessages(output []model.ResponsesOutputItem) []model.Message {
+	message := model.Message{Role: "assistant"}
+	var content string
+	for _, item := range output {
+		switch item.Type {
+		case model.ResponsesOutputTypeMessage:
+			for _, part := range item.Content {
+				content += part.Text
+			}
+		case model.ResponsesOutputTypeFunctionCall:
+			message.ToolCalls = append(message.ToolCalls, model.Tool{
+				Id:       item.CallID,
+				Type:     "function",
+				Function: model.Function{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
 	}
+	if content != "" {
+		message.Content = content
+	}
+	if message.Content == nil && len(message.ToolCalls) == 0 {
+		return nil
+	}
+	return []model.Message{message}
+}
 
-	// Streaming: need to convert each SSE chunk
-	return w.writeStreamChunk(data)
+// responsesBridge converts chat completions into Responses API objects and
+// keeps the final response so it can be stored once the relay finished
+type responsesBridge struct {
+	request  *model.ResponsesRequest
+	store    bool
+	isStream bool
+	response *model.ResponsesResponse
+	stream   responsesStreamConverter
 }
 
-// WriteHeader captures the status code
-func (w *responsesResponseWriter) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-	// Don't write header yet for non-stream, we'll do it after conversion
-	if w.isStream {
-		w.ResponseWriter.WriteHeader(statusCode)
+// newResponse returns a response echoing the request parameters, without output
+func (b *responsesBridge) newResponse(id string, createdAt int64) *model.ResponsesResponse {
+	maxOutputTokens := b.request.MaxOutputTokens
+	if maxOutputTokens == 0 {
+		maxOutputTokens = b.request.MaxTokens
+	}
+	tools := b.request.Tools
+	if tools == nil {
+		tools = []model.ResponsesTool{}
+	}
+	return &model.ResponsesResponse{
+		ID:                 id,
+		Object:             "response",
+		Created:            createdAt,
+		CreatedAt:          createdAt,
+		Status:             "in_progress",
+		Model:              b.request.Model,
+		Output:             []model.ResponsesOutputItem{},
+		Instructions:       b.request.Instructions,
+		Tools:              tools,
+		ToolChoice:         b.request.ToolChoice,
+		ParallelToolCalls:  b.request.ParallelToolCalls,
+		Temperature:        b.request.Temperature,
+		TopP:               b.request.TopP,
+		MaxOutputTokens:    maxOutputTokens,
+		Text:               b.request.Text,
+		Reasoning:          b.request.Reasoning,
+		Metadata:           b.request.Metadata,
+		PreviousResponseID: b.request.PreviousResponseID,
+		Store:              b.store,
 	}
 }
 
-// Flush is called after all writes are done, convert and send the response
-func (w *responsesResponseWriter) finalizeNonStream() error {
-	if w.isStream || len(w.buffer) == 0 {
-		return nil
+// getResponse returns the response object sent to the client, so the stored copy matches it
+func (b *responsesBridge) getResponse() *model.ResponsesResponse {
+	if b.isStream {
+		return b.stream.template
 	}
+	return b.response
+}
 
-	// Try to unmarshal as chat completion response
+func (b *responsesBridge) convertResponse(body []byte) ([]byte, error) {
 	var chatResp openai.TextResponse
-	err := json.Unmarshal(w.buffer, &chatResp)
-	if err != nil {
-		// If it's an error response or can't parse, pass through as-is
-		logger.Warnf(w.context.Request.Context(), "failed to parse chat response for conversion, passing through: %s", err.Error())
-		if w.statusCode != 0 {
-			w.ResponseWriter.WriteHeader(w.statusCode)
-		}
-		_, writeErr := w.ResponseWriter.Write(w.buffer)
-		return writeErr
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, err
 	}
-
-	// Check if response has valid data
 	if len(chatResp.Choices) == 0 {
-		logger.Warnf(w.context.Request.Context(), "chat response has no choices, returning error")
-		// Return an error response instead of empty response
-		errorData := map[string]any{
-			"error": map[string]string{
-				"message": "upstream provider returned empty response",
-				"type":    "upstream_error",
-				"code":    "empty_response",
-			},
-		}
-		w.ResponseWriter.WriteHeader(http.StatusBadGateway)
-		errorBytes, _ := json.Marshal(errorData)
-		_, writeErr := w.ResponseWriter.Write(errorBytes)
-		return writeErr
+		return nil, errors.New("upstream provider returned empty response")
 	}
+	converted := convertChatCompletionToResponses(&chatResp)
+	template := b.stream.template
+	b.response = b.newResponse(template.ID, template.CreatedAt)
+	b.response.Output = converted.Output
+	b.response.Usage = converted.Usage
+	b.response.Status = converted.Status
+	b.response.IncompleteDetails = converted.IncompleteDetails
+	return json.Marshal(b.response)
+}
 
-	// Convert to Responses format
-	responsesResp := convertChatCompletionToResponses(&chatResp)
-	
-	// Log warning if output is empty
-	if len(responsesResp.Output) == 0 || (len(responsesResp.Output) > 0 && len(responsesResp.Output[0].Content) == 0) {
-		logger.Warnf(w.context.Request.Context(), "converted response has empty output, chat response had %d choices", len(chatResp.Choices))
-	}
-	
-	respData, err := json.Marshal(responsesResp)
-	if err != nil {
-		logger.Errorf(w.context.Request.Context(), "failed to marshal responses response: %s", err.Error())
-		if w.statusCode != 0 {
-			w.ResponseWriter.WriteHeader(w.statusCode)
+func (b *responsesBridge) convertStreamData(data string) []byte {
+	var events []*model.ResponsesStreamEvent
+	if data == "[DONE]" {
+		events = b.stream.finish()
+	} else {
+		var chunk openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			logger.SysError("error unmarshalling stream response: " + err.Error())
+			return nil
 		}
-		_, writeErr := w.ResponseWriter.Write(w.buffer)
-		return writeErr
+		events = b.stream.convert(&chunk)
 	}
-
-	// Write the converted response
-	if w.statusCode != 0 {
-		w.ResponseWriter.WriteHeader(w.statusCode)
+	var converted []byte
+	for _, event := range events {
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			logger.SysError("error marshalling stream response: " + err.Error())
+			continue
+		}
+		converted = append(converted, fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, encoded)...)
 	}
-	_, writeErr := w.ResponseWriter.Write(respData)
-	return writeErr
+	return converted
 }
 
-func (w *responsesResponseWriter) writeStreamChunk(data []byte) (int, error) {
-	// Parse SSE format
-	lines := strings.Split(string(data), "\n")
-	var convertedLines []string
-
-	for _, line := range lines {
-		if strings.HasPrefix(line, "data: ") {
-			dataStr := strings.TrimPrefix(line, "data: ")
-			dataStr = strings.TrimSpace(dataStr)
-
-			if dataStr == "[DONE]" {
-				convertedLines = append(convertedLines, "data: [DONE]")
-				continue
-			}
+func newResponsesItemId(prefix string) string {
+	return fmt.Sprintf("%s_%s", prefix, uuid.New().String()[:model.ResponsesIDPrefixLength])
+}
 
-			var chatStreamResp openai.ChatCompletionsStreamResponse
-			err := json.Unmarshal([]byte(dataStr), &chatStreamResp)
-			if err != nil {
-				// Pass through if not parseable
-				convertedLines = append(convertedLines, line)
-				continue
-			}
+// responsesStatus maps a chat finish reason to the response status and incomplete details
+func responsesStatus(finishReason string) (string, *model.ResponsesIncompleteDetails) {
+	switch finishReason {
+	case "length":
+		return "incomplete", &model.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		return "incomplete", &model.ResponsesIncompleteDetails{Reason: "content_filter"}
+	}
+	return "completed", nil
+}
 
-			// Convert to Responses stream format
-			responsesStreamResp := convertChatStreamToResponsesStream(&chatStreamResp)
-			respData, err := json.Marshal(responsesStreamResp)
-			if err != nil {
-				convertedLines = append(convertedLines, line)
-				continue
-			}
+func reasoningText(reasoningContent any) string {
+	text, _ := reasoningContent.(string)
+	return text
+}
 
-			convertedLines = append(convertedLines, "data: "+string(respData))
-		} else {
-			convertedLines = append(convertedLines, line)
-		}
+func toolCallArguments(arguments any) string {
+	switch arguments := arguments.(type) {
+	case nil:
+		return ""
+	case string:
+		return arguments
+	default:
+		encoded, _ := json.Marshal(arguments)
+		return string(encoded)
 	}
-
-	convertedData := []byte(strings.Join(convertedLines, "\n"))
-	return w.ResponseWriter.Write(convertedData)
 }
 
 // convertChatCompletionToResponses converts ChatCompletion response to Responses format
 func convertChatCompletionToResponses(chatResp *openai.TextResponse) *model.ResponsesResponse {
 	output := make([]model.ResponsesOutputItem, 0, len(chatResp.Choices))
+	status := "completed"
+	var incompleteDetails *model.ResponsesIncompleteDetails
 
 	for _, choice := range chatResp.Choices {
+		if reasoning := reasoningText(choice.Message.ReasoningContent); reasoning != "" {
+			output = append(output, model.ResponsesOutputItem{
+				ID:      newResponsesItemId("rs"),
+				Type:    model.ResponsesOutputTypeReasoning,
+				Summary: []model.ResponsesSummaryText{{Type: model.ResponsesContentTypeSummaryText, Text: reasoning}},
+			})
+		}
 		content := choice.Message.StringContent()
-		outputItem := model.ResponsesOutputItem{
-			ID:   fmt.Sprintf("msg_%s", uuid.New().String()[:model.ResponsesIDPrefixLength]),
-			Type: model.ResponsesOutputTypeMessage,
-			Role: choice.Message.Role,
-			Content: []model.ResponsesOutputContent{
-				{
-					Type: model.ResponsesContentTypeOutputText,
-					Text: content,
+		if content != "" || len(choice.Message.ToolCalls) == 0 {
+			output = append(output, model.ResponsesOutputItem{
+				ID:     newResponsesItemId("msg"),
+				Type:   model.ResponsesOutputTypeMessage,
+				Status: "completed",
+				Role:   choice.Message.Role,
+				Content: []model.ResponsesOutputContent{
+					{
+						Type:        model.ResponsesContentTypeOutputText,
+						Text:        content,
+						Annotations: []any{},
+					},
 				},
-			},
-		}
-		output = append(output, outputItem)
-	}
-
-	return &model.ResponsesResponse{
-		ID:      chatResp.Id,
-		Object:  "response",
-		Created: chatResp.Created,
-		Model:   chatResp.Model,
-		Output:  output,
-		Usage:   &chatResp.Usage,
-	}
-}
-
-// convertChatStreamToResponsesStream converts streaming ChatCompletion to Responses stream format
-func convertChatStreamToResponsesStream(chatResp *openai.ChatCompletionsStreamResponse) *model.ResponsesStreamResponse {
-	output := make([]model.ResponsesStreamResponseOutputItem, 0, len(chatResp.Choices))
-
-	for _, choice := range chatResp.Choices {
-		var content []model.ResponsesStreamResponseOutputContent
-		
-		// Get delta content
-		deltaContent := choice.Delta.StringContent()
-		if deltaContent != "" {
-			content = append(content, model.ResponsesStreamResponseOutputContent{
-				Type:  model.ResponsesContentTypeOutputText,
-				Delta: &deltaContent,
 			})
 		}
-
-		// Get role if present
-		var role *string
-		if choice.Delta.Role != "" {
-			role = &choice.Delta.Role
+		for _, toolCall := range choice.Message.ToolCalls {
+			output = append(output, model.ResponsesOutputItem{
+				ID:        newResponsesItemId("fc"),
+				Type:      model.ResponsesOutputTypeFunctionCall,
+				Status:    "completed",
+				CallID:    toolCall.Id,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCallArguments(toolCall.Function.Arguments),
+			})
 		}
-
-		outputItem := model.ResponsesStreamResponseOutputItem{
-			Index:   choice.Index,
-			Type:    model.ResponsesOutputTypeMessage,
-			Role:    role,
-			Content: content,
+		if choice.FinishReason != "" && status == "completed" {
+			status, incompleteDetails = responsesStatus(choice.FinishReason)
 		}
-
-		output = append(output, outputItem)
-	}
-
-	return &model.ResponsesStreamResponse{
-		ID:      chatResp.Id,
-		Object:  "response.delta",
-		Created: chatResp.Created,
-		Model:   chatResp.Model,
-		Output:  output,
-		Usage:   chatResp.Usage,
 	}
-}
 
-func (w *responsesResponseWriter) Flush() {
-	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
-		flusher.Flush()
+	return &model.ResponsesResponse{
+		ID:                chatResp.Id,
+		Object:            "response",
+		Created:           chatResp.Created,
+		CreatedAt:         chatResp.Created,
+		Status:            status,
+		IncompleteDetails: incompleteDetails,
+		Model:             chatResp.Model,
+		Output:            output,
+		Usage:             model.NewResponsesUsage(chatResp.Usage),
 	}
 }
-
-var _ gin.ResponseWriter = (*responsesResponseWriter)(nil)
-var _ http.Flusher = (*responsesResponseWriter)(nil)
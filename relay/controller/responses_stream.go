@@ -0,0 +1,198 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// responsesStreamConverter turns chat completion chunks into the Responses API
+// event sequence, every output item is opened with output_item.added and closed
+// with output_item.done before the next one starts
+type responsesStreamConverter struct {
+	// template is the response being built, it holds the final state after finish
+	template     *model.ResponsesResponse
+	sequence     int
+	started      bool
+	current      int // index of the open item in template.Output, -1 if none
+	buffer       strings.Builder
+	finishReason string
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func (s *responsesStreamConverter) event(eventType string) *model.ResponsesStreamEvent {
+	event := &model.ResponsesStreamEvent{Type: eventType, SequenceNumber: s.sequence}
+	s.sequence++
+	return event
+}
+
+func (s *responsesStreamConverter) responseEvent(eventType string) *model.ResponsesStreamEvent {
+	event := s.event(eventType)
+	response := *s.template
+	event.Response = &response
+	return event
+}
+
+func (s *responsesStreamConverter) itemEvent(eventType string) *model.ResponsesStreamEvent {
+	event := s.event(eventType)
+	event.OutputIndex = intPtr(s.current)
+	event.ItemID = s.template.Output[s.current].ID
+	return event
+}
+
+func (s *responsesStreamConverter) snapshotItem(event *model.ResponsesStreamEvent) *model.ResponsesStreamEvent {
+	item := s.template.Output[s.current]
+	event.Item = &item
+	return event
+}
+
+func (s *responsesStreamConverter) start() []*model.ResponsesStreamEvent {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.current = -1
+	return []*model.ResponsesStreamEvent{
+		s.responseEvent("response.created"),
+		s.responseEvent("response.in_progress"),
+	}
+}
+
+// open closes the current item unless it already has the given type and
+// reuse is allowed, then starts a new one
+func (s *responsesStreamConverter) open(item model.ResponsesOutputItem, reuse bool) []*model.ResponsesStreamEvent {
+	if reuse && s.current >= 0 && s.template.Output[s.current].Type == item.Type {
+		return nil
+	}
+	events := s.close()
+	s.template.Output = append(s.template.Output, item)
+	s.current = len(s.template.Output) - 1
+	s.buffer.Reset()
+	events = append(events, s.snapshotItem(s.itemEvent("response.output_item.added")))
+	switch item.Type {
+	case model.ResponsesOutputTypeMessage:
+		event := s.itemEvent("response.content_part.added")
+		event.ContentIndex = intPtr(0)
+		event.Part = &model.ResponsesOutputContent{Type: model.ResponsesContentTypeOutputText, Annotations: []any{}}
+		events = append(events, event)
+	case model.ResponsesOutputTypeReasoning:
+		event := s.itemEvent("response.reasoning_summary_part.added")
+		event.SummaryIndex = intPtr(0)
+		event.Part = &model.ResponsesOutputContent{Type: model.ResponsesContentTypeSummaryText}
+		events = append(events, event)
+	}
+	return events
+}
+
+// close emits the done events of the current item and stores its final state
+func (s *responsesStreamConverter) close() []*model.ResponsesStreamEvent {
+	if s.current < 0 {
+		return nil
+	}
+	var events []*model.ResponsesStreamEvent
+	text := s.buffer.String()
+	item := &s.template.Output[s.current]
+	switch item.Type {
+	case model.ResponsesOutputTypeMessage:
+		part := model.ResponsesOutputContent{Type: model.ResponsesContentTypeOutputText, Text: text, Annotations: []any{}}
+		event := s.itemEvent("response.output_text.done")
+		event.ContentIndex = intPtr(0)
+		event.Text = &text
+		events = append(events, event)
+		event = s.itemEvent("response.content_part.done")
+		event.ContentIndex = intPtr(0)
+		event.Part = &part
+		events = append(events, event)
+		item.Content = []model.ResponsesOutputContent{part}
+	case model.ResponsesOutputTypeReasoning:
+		event := s.itemEvent("response.reasoning_summary_text.done")
+		event.SummaryIndex = intPtr(0)
+		event.Text = &text
+		events = append(events, event)
+		event = s.itemEvent("response.reasoning_summary_part.done")
+		event.SummaryIndex = intPtr(0)
+		event.Part = &model.ResponsesOutputContent{Type: model.ResponsesContentTypeSummaryText, Text: text}
+		events = append(events, event)
+		item.Summary = []model.ResponsesSummaryText{{Type: model.ResponsesContentTypeSummaryText, Text: text}}
+	case model.ResponsesOutputTypeFunctionCall:
+		event := s.itemEvent("response.function_call_arguments.done")
+		event.Arguments = &text
+		events = append(events, event)
+		item.Arguments = text
+	}
+	if item.Type != model.ResponsesOutputTypeReasoning {
+		item.Status = "completed"
+	}
+	events = append(events, s.snapshotItem(s.itemEvent("response.output_item.done")))
+	s.current = -1
+	return events
+}
+
+func (s *responsesStreamConverter) delta(eventType string, delta string) *model.ResponsesStreamEvent {
+	s.buffer.WriteString(delta)
+	event := s.itemEvent(eventType)
+	event.Delta = delta
+	switch eventType {
+	case "response.output_text.delta":
+		event.ContentIndex = intPtr(0)
+	case "response.reasoning_summary_text.delta":
+		event.SummaryIndex = intPtr(0)
+	}
+	return event
+}
+
+func (s *responsesStreamConverter) convert(chunk *openai.ChatCompletionsStreamResponse) []*model.ResponsesStreamEvent {
+	events := s.start()
+	for _, choice := range chunk.Choices {
+		if reasoning := reasoningText(choice.Delta.ReasoningContent); reasoning != "" {
+			events = append(events, s.open(model.ResponsesOutputItem{
+				ID:      newResponsesItemId("rs"),
+				Type:    model.ResponsesOutputTypeReasoning,
+				Summary: []model.ResponsesSummaryText{},
+			}, true)...)
+			events = append(events, s.delta("response.reasoning_summary_text.delta", reasoning))
+		}
+		if content := choice.Delta.StringContent(); content != "" {
+			events = append(events, s.open(model.ResponsesOutputItem{
+				ID:      newResponsesItemId("msg"),
+				Type:    model.ResponsesOutputTypeMessage,
+				Status:  "in_progress",
+				Role:    "assistant",
+				Content: []model.ResponsesOutputContent{},
+			}, true)...)
+			events = append(events, s.delta("response.output_text.delta", content))
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			// a chunk carrying an id or a name starts the next call, the rest only add arguments
+			events = append(events, s.open(model.ResponsesOutputItem{
+				ID:     newResponsesItemId("fc"),
+				Type:   model.ResponsesOutputTypeFunctionCall,
+				Status: "in_progress",
+				CallID: toolCall.Id,
+				Name:   toolCall.Function.Name,
+			}, toolCall.Id == "" && toolCall.Function.Name == "")...)
+			if arguments := toolCallArguments(toolCall.Function.Arguments); arguments != "" {
+				events = append(events, s.delta("response.function_call_arguments.delta", arguments))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+	if chunk.Usage != nil {
+		s.template.Usage = model.NewResponsesUsage(*chunk.Usage)
+	}
+	return events
+}
+
+// finish closes the open item and emits the terminal response event
+func (s *responsesStreamConverter) finish() []*model.ResponsesStreamEvent {
+	events := s.start()
+	events = append(events, s.close()...)
+	s.template.Status, s.template.IncompleteDetails = responsesStatus(s.finishReason)
+	return append(events, s.responseEvent("response."+s.template.Status))
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -192,3 +193,191 @@ func TestChatCompletionToResponsesConversion(t *testing.T) {
 		assert.Equal(t, 0, len(responsesResp.Output))
 	})
 }
+
+func newTestResponsesBridge(request *model.ResponsesRequest) *responsesBridge {
+	bridge := &responsesBridge{request: request, store: true, isStream: request.Stream}
+	bridge.stream.template = bridge.newResponse("resp_123", 1234567890)
+	return bridge
+}
+
+func TestResponsesBridgeStream(t *testing.T) {
+	bridge := newTestResponsesBridge(&model.ResponsesRequest{Model: "gpt-3.5-turbo", Stream: true})
+	chunks := []string{
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"}}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","model":"gpt-3.5-turbo","choices":[{"index":0,"delta":{"content":" there"},"finish_reason":"stop"}]}`,
+		`{"id":"chatcmpl-1","object":"chat.completion.chunk","model":"gpt-3.5-turbo","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+	}
+	var converted string
+	for _, chunk := range chunks {
+		converted += string(bridge.convertStreamData(chunk))
+	}
+	converted += string(bridge.convertStreamData("[DONE]"))
+	assert.Contains(t, converted, `"id":"resp_123"`)
+	assert.NotContains(t, converted, "[DONE]")
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.completed",
+	}, streamEventTypes(t, converted))
+
+	// the merged completion is what gets stored for previous_response_id
+	response := bridge.getResponse()
+	assert.Equal(t, "resp_123", response.ID)
+	assert.Equal(t, "completed", response.Status)
+	assert.True(t, response.Store)
+	assert.Equal(t, 1, len(response.Output))
+	assert.Equal(t, "Hello there", response.Output[0].Content[0].Text)
+	assert.Equal(t, 5, response.Usage.TotalTokens)
+	assert.Equal(t, 3, response.Usage.InputTokens)
+}
+
+// streamEventTypes returns the event types in order and checks the sequence numbers
+func streamEventTypes(t *testing.T, stream string) []string {
+	var types []string
+	for _, line := range strings.Split(stream, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event model.ResponsesStreamEvent
+		assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+		assert.Equal(t, len(types), event.SequenceNumber)
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestResponsesBridgeStreamToolCalls(t *testing.T) {
+	bridge := newTestResponsesBridge(&model.ResponsesRequest{Model: "o3-mini", Stream: true})
+	chunks := []string{
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"Need the weather."}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"chatcmpl-1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+	}
+	var converted string
+	for _, chunk := range chunks {
+		converted += string(bridge.convertStreamData(chunk))
+	}
+	converted += string(bridge.convertStreamData("[DONE]"))
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.reasoning_summary_part.added",
+		"response.reasoning_summary_text.delta",
+		"response.reasoning_summary_text.done",
+		"response.reasoning_summary_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, streamEventTypes(t, converted))
+
+	response := bridge.getResponse()
+	assert.Equal(t, 2, len(response.Output))
+	assert.Equal(t, model.ResponsesOutputTypeReasoning, response.Output[0].Type)
+	assert.Equal(t, "Need the weather.", response.Output[0].Summary[0].Text)
+	assert.Equal(t, model.ResponsesOutputTypeFunctionCall, response.Output[1].Type)
+	assert.Equal(t, "call_1", response.Output[1].CallID)
+	assert.Equal(t, "get_weather", response.Output[1].Name)
+	assert.Equal(t, `{"city":"Paris"}`, response.Output[1].Arguments)
+
+	// reasoning is not replayed, the tool call is
+	messages := convertResponsesOutputToMessages(response.Output)
+	assert.Equal(t, 1, len(messages))
+	assert.Nil(t, messages[0].Content)
+	assert.Equal(t, "call_1", messages[0].ToolCalls[0].Id)
+}
+
+func TestChatCompletionWithToolCallsToResponses(t *testing.T) {
+	chatResp := &openai.TextResponse{
+		Id:    "chatcmpl-789",
+		Model: "o3-mini",
+		Choices: []openai.TextResponseChoice{
+			{
+				Message: model.Message{
+					Role:             "assistant",
+					ReasoningContent: "Need the weather.",
+					ToolCalls: []model.Tool{
+						{Id: "call_1", Type: "function", Function: model.Function{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+					},
+				},
+				FinishReason: "tool_calls",
+			},
+		},
+	}
+
+	responsesResp := convertChatCompletionToResponses(chatResp)
+	assert.Equal(t, "completed", responsesResp.Status)
+	assert.Equal(t, 2, len(responsesResp.Output))
+	assert.Equal(t, model.ResponsesOutputTypeReasoning, responsesResp.Output[0].Type)
+	assert.Equal(t, "Need the weather.", responsesResp.Output[0].Summary[0].Text)
+	assert.Equal(t, model.ResponsesOutputTypeFunctionCall, responsesResp.Output[1].Type)
+	assert.Equal(t, "call_1", responsesResp.Output[1].CallID)
+	assert.Equal(t, `{"city":"Paris"}`, responsesResp.Output[1].Arguments)
+
+	chatResp.Choices[0].FinishReason = "length"
+	responsesResp = convertChatCompletionToResponses(chatResp)
+	assert.Equal(t, "incomplete", responsesResp.Status)
+	assert.Equal(t, "max_output_tokens", responsesResp.IncompleteDetails.Reason)
+}
+
+func TestConvertResponsesToChatRequest(t *testing.T) {
+	strict := true
+	req := &model.ResponsesRequest{
+		Model:           "gpt-4o",
+		MaxOutputTokens: 256,
+		Tools: []model.ResponsesTool{
+			{Type: "function", Name: "get_weather", Parameters: map[string]any{"type": "object"}},
+		},
+		ToolChoice: map[string]any{"type": "function", "name": "get_weather"},
+		Text: &model.ResponsesText{Format: &model.ResponsesTextFormat{
+			Type: "json_schema", Name: "weather", Schema: map[string]any{"type": "object"}, Strict: &strict,
+		}},
+	}
+
+	chatReq, err := convertResponsesToChatRequest(req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, chatReq.MaxTokens)
+	assert.Equal(t, 1, len(chatReq.Tools))
+	assert.Equal(t, "get_weather", chatReq.Tools[0].Function.Name)
+	assert.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chatReq.ToolChoice)
+	assert.Equal(t, "json_schema", chatReq.ResponseFormat.Type)
+	assert.Equal(t, "weather", chatReq.ResponseFormat.JsonSchema.Name)
+
+	req.Tools = append(req.Tools, model.ResponsesTool{Type: "web_search_preview"})
+	_, err = convertResponsesToChatRequest(req, nil)
+	assert.Error(t, err)
+}
+
+func TestResponsesFunctionCallInputParsing(t *testing.T) {
+	req := &model.ResponsesRequest{
+		Input: []any{
+			map[string]any{"role": "developer", "content": "Be brief."},
+			map[string]any{"role": "user", "content": []any{map[string]any{"type": "input_text", "text": "Weather in Paris?"}}},
+			map[string]any{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": `{"city":"Paris"}`},
+			map[string]any{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+		},
+	}
+
+	messages := req.ParseInput()
+	assert.Equal(t, 4, len(messages))
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "Weather in Paris?", messages[1].Content)
+	assert.Equal(t, "assistant", messages[2].Role)
+	assert.Equal(t, "call_1", messages[2].ToolCalls[0].Id)
+	assert.Equal(t, "get_weather", messages[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, "tool", messages[3].Role)
+	assert.Equal(t, "call_1", messages[3].ToolCallId)
+	assert.Equal(t, "sunny", messages[3].Content)
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor"
@@ -20,6 +22,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/routing"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
 )
 
 func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
@@ -42,10 +46,14 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	// get model ratio & group ratio
 	modelRatio := billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
-	ratio := modelRatio * groupRatio
+	ratio := modelRatio * groupRatio * getBatchRatio(meta)
 	// pre-consume quota
 	promptTokens := getPromptTokens(textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
+	promptTokens, bizErr := fitContextWindow(ctx, meta, textRequest, promptTokens)
+	if bizErr != nil {
+		return bizErr
+	}
 	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
 	if bizErr != nil {
 		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
@@ -58,14 +66,33 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 	adaptor.Init(meta)
 
+	if isChoicesEmulated(meta, textRequest) {
+		usage, respErr := relayEmulatedChoices(c, meta, textRequest, adaptor)
+		if respErr != nil {
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+			return respErr
+		}
+		c.Set(ctxkey.Usage, usage)
+		go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+		return nil
+	}
+
 	// get request body
 	requestBody, err := getRequestBody(c, meta, textRequest, adaptor)
 	if err != nil {
 		return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
 	}
 
-	// do request
-	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	// do request, hedged with another channel when this one is slow to answer
+	attempt := doHedgedRequest(c, meta, textRequest, adaptor, requestBody)
+	defer attempt.cancel()
+	if attempt.channel != nil {
+		useHedgeWinner(c, attempt, textRequest)
+		meta, adaptor = attempt.meta, attempt.adaptor
+		modelRatio = billingratio.GetModelRatio(textRequest.Model, meta.ChannelType)
+		ratio = modelRatio * groupRatio * getBatchRatio(meta)
+	}
+	resp, err := attempt.resp, attempt.err
 	if err != nil {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
@@ -74,16 +101,40 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return RelayErrorHandler(resp)
 	}
+	if meta.IsStream {
+		// upstreams send the headers of a stream along with its first event
+		routing.RecordTTFT(meta.ChannelId, meta.OriginModelName, time.Since(meta.StartTime))
+	}
 
-	// do response
+	// do response, an interrupted stream is continued by another channel when enabled
+	failover := startStreamFailover(c, meta, textRequest)
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr != nil && failover != nil && failover.Written() {
+		// the client has part of the answer already, which is billed as it is
+		logger.Errorf(ctx, "stream interrupted: %+v", respErr)
+		usage, respErr = openai.ResponseText2Usage(failover.text.String(), meta.ActualModelName, meta.PromptTokens), nil
+	}
 	if respErr != nil {
+		if failover != nil {
+			failover.finish(c)
+		}
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
 		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return respErr
 	}
+	if usage != nil && !usage.Estimated {
+		// usage counted locally says nothing of the accuracy of the estimate
+		tokenizer.RecordUsage(meta.ActualModelName, promptTokens, usage.PromptTokens)
+	}
 	// post-consume quota
 	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, systemPromptReset)
+	if failover != nil {
+		if usage != nil {
+			usage = failover.continueStream(c, meta, textRequest, usage, groupRatio, systemPromptReset)
+		}
+		failover.finish(c)
+	}
+	c.Set(ctxkey.Usage, usage)
 	return nil
 }
 
@@ -92,12 +143,16 @@ func getRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralO
 		meta.APIType == apitype.OpenAI &&
 		meta.OriginModelName == meta.ActualModelName &&
 		meta.ChannelType != channeltype.Baichuan &&
-		meta.ForcedSystemPrompt == "" {
+		meta.ForcedSystemPrompt == "" &&
+		meta.TruncatedMessages == 0 &&
+		!meta.RequestAdapted {
 		// no need to convert request for openai
 		return c.Request.Body, nil
 	}
+	return convertRequestBody(c, meta, textRequest, adaptor)
+}
 
-	// get request body
+func convertRequestBody(c *gin.Context, meta *meta.Meta, textRequest *model.GeneralOpenAIRequest, adaptor adaptor.Adaptor) (io.Reader, error) {
 	var requestBody io.Reader
 	convertedRequest, err := adaptor.ConvertRequest(c, meta.Mode, textRequest)
 	if err != nil {
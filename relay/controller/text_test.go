@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/tokenizer"
+)
+
+// setupTextRelay opens a database with a user and a token of unlimited quota
+func setupTextRelay(t *testing.T) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	sqlitePath, memoryCacheEnabled, redisEnabled, approximateTokenEnabled := common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled, config.ApproximateTokenEnabled
+	t.Cleanup(func() {
+		common.SQLitePath, config.MemoryCacheEnabled, common.RedisEnabled, config.ApproximateTokenEnabled = sqlitePath, memoryCacheEnabled, redisEnabled, approximateTokenEnabled
+	})
+	common.SQLitePath = t.TempDir() + "/one-api.db"
+	config.MemoryCacheEnabled = false
+	common.RedisEnabled = false
+	// the encoders of tiktoken are downloaded
+	config.ApproximateTokenEnabled = true
+	dbmodel.InitDB()
+	dbmodel.InitLogDB()
+	client.Init()
+
+	user := &dbmodel.User{Id: 1, Username: "user", Password: "12345678", Group: "default", Status: dbmodel.UserStatusEnabled, AffCode: "user", AccessToken: "user", Quota: 100000000}
+	if err := dbmodel.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := &dbmodel.Token{Id: 1, UserId: 1, Key: "token", Name: "token", Status: dbmodel.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	if err := dbmodel.DB.Create(token).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// relayTestText relays a chat completion to an OpenAI channel and waits for it to be billed
+func relayTestText(baseURL string, body string, modelMapping map[string]string) int {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set("Authorization", "Bearer key")
+	c.Set(ctxkey.Id, 1)
+	c.Set(ctxkey.TokenId, 1)
+	c.Set(ctxkey.Group, "default")
+	c.Set(ctxkey.Channel, channeltype.OpenAI)
+	c.Set(ctxkey.ChannelId, 1)
+	c.Set(ctxkey.BaseURL, baseURL)
+	c.Set(ctxkey.ModelMapping, modelMapping)
+	var logs int64
+	dbmodel.LOG_DB.Model(&dbmodel.Log{}).Where("type = ?", dbmodel.LogTypeConsume).Count(&logs)
+	if bizErr := RelayTextHelper(c); bizErr != nil {
+		return bizErr.StatusCode
+	}
+	// the request is billed in the background
+	for count, i := logs, 0; i < 100 && count == logs; i++ {
+		time.Sleep(10 * time.Millisecond)
+		dbmodel.LOG_DB.Model(&dbmodel.Log{}).Where("type = ?", dbmodel.LogTypeConsume).Count(&count)
+	}
+	return http.StatusOK
+}
+
+func TestRelayTextRequestBody(t *testing.T) {
+	setupTextRelay(t)
+	bodies := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`)
+	}))
+	defer upstream.Close()
+	relayText := func(body string, modelMapping map[string]string) (int, string) {
+		status := relayTestText(upstream.URL, body, modelMapping)
+		if status != http.StatusOK {
+			return status, ""
+		}
+		return status, <-bodies
+	}
+	sent := func(body string) map[string]any {
+		var request map[string]any
+		if err := json.Unmarshal([]byte(body), &request); err != nil {
+			t.Fatal(err)
+		}
+		return request
+	}
+
+	// a request the model can take is sent as the client wrote it
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"max_tokens":100,"unknown_field":1}`
+	if status, upstreamBody := relayText(body, nil); status != http.StatusOK || upstreamBody != body {
+		t.Errorf("the body of the client should be sent as it is, got %d %s", status, upstreamBody)
+	}
+
+	// gpt-4o generates at most 16384 tokens
+	status, upstreamBody := relayText(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"max_tokens":100000}`, nil)
+	if status != http.StatusOK || sent(upstreamBody)["max_tokens"] != float64(16384) {
+		t.Errorf("max_tokens should be lowered in the body sent upstream, got %d %s", status, upstreamBody)
+	}
+
+	// o1-mini takes no tools, which are dropped when the client asks for none
+	status, upstreamBody = relayText(`{"model":"o1-mini","messages":[{"role":"user","content":"hi"}],"tool_choice":"none",
+		"tools":[{"type":"function","function":{"name":"f"}}]}`, nil)
+	if request := sent(upstreamBody); status != http.StatusOK || request["tools"] != nil || request["tool_choice"] != nil {
+		t.Errorf("tools should be dropped from the body sent upstream, got %d %s", status, upstreamBody)
+	}
+
+	// the capabilities are the ones of the mapped model, gpt-4 takes no images but claude does
+	image := `{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"text","text":"what is this?"},
+		{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="}}]}]}`
+	if status, _ = relayText(image, nil); status != http.StatusBadRequest {
+		t.Errorf("an image for a model without vision should be rejected, got %d", status)
+	}
+	status, upstreamBody = relayText(image, map[string]string{"gpt-4": "claude-3-5-sonnet-20241022"})
+	if status != http.StatusOK || sent(upstreamBody)["model"] != "claude-3-5-sonnet-20241022" {
+		t.Errorf("an image for a mapped model with vision should be relayed, got %d %s", status, upstreamBody)
+	}
+}
+
+func TestRelayTextRecordsTokenizerUsage(t *testing.T) {
+	setupTextRelay(t)
+	tokenizer.ResetStats()
+	defer tokenizer.ResetStats()
+	body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+	request := &model.GeneralOpenAIRequest{Model: "gpt-4o", Messages: []model.Message{{Role: "user", Content: "hi"}}}
+	estimate := getPromptTokens(request, relaymode.ChatCompletions)
+	var usage string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]%s}`, usage)
+	}))
+	defer upstream.Close()
+
+	// an exact estimate is as much a sample as any other
+	usage = fmt.Sprintf(`,"usage":{"prompt_tokens":%d,"completion_tokens":1,"total_tokens":%d}`, estimate, estimate+1)
+	if status := relayTestText(upstream.URL, body, nil); status != http.StatusOK {
+		t.Fatalf("request should be relayed, got %d", status)
+	}
+	stats := tokenizer.GetStats()
+	if len(stats) != 1 || stats[0].Samples != 1 || stats[0].MeanAbsoluteError != 0 || stats[0].Bias != 0 {
+		t.Fatalf("the exact estimate should be recorded, got %+v", stats)
+	}
+
+	// the usage counted locally when the upstream reports none is no sample
+	usage = ""
+	if status := relayTestText(upstream.URL, body, nil); status != http.StatusOK {
+		t.Fatalf("request should be relayed, got %d", status)
+	}
+	if stats = tokenizer.GetStats(); stats[0].Samples != 1 {
+		t.Errorf("usage counted locally should not be recorded, got %d samples", stats[0].Samples)
+	}
+}
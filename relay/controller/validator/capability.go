@@ -0,0 +1,97 @@
+package validator
+
+import (
+	"fmt"
+
+	"github.com/songquanpeng/one-api/relay/capability"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// ValidateCapability rejects the parts of a request the model is known not to
+// support, and lowers the max tokens to what the model can generate. It runs on
+// the mapped model and reports whether the request was changed.
+func ValidateCapability(textRequest *model.GeneralOpenAIRequest, relayMode int) (adapted bool, err error) {
+	modelCapability, ok := capability.Get(textRequest.Model)
+	if !ok {
+		return false, nil
+	}
+	if textRequest.Stream && !modelCapability.Streaming {
+		return false, fmt.Errorf("model %s does not support streaming", textRequest.Model)
+	}
+	if maxOutputTokens := modelCapability.MaxOutputTokens; maxOutputTokens > 0 {
+		if textRequest.MaxTokens > maxOutputTokens {
+			textRequest.MaxTokens = maxOutputTokens
+			adapted = true
+		}
+		if textRequest.MaxCompletionTokens != nil && *textRequest.MaxCompletionTokens > maxOutputTokens {
+			textRequest.MaxCompletionTokens = &maxOutputTokens
+			adapted = true
+		}
+	}
+	if relayMode != relaymode.ChatCompletions && relayMode != relaymode.Responses {
+		return adapted, nil
+	}
+	if !modelCapability.Vision && hasImageContent(textRequest.Messages) {
+		return adapted, fmt.Errorf("model %s does not support image input", textRequest.Model)
+	}
+	if !modelCapability.Tools && (len(textRequest.Tools) != 0 || textRequest.Functions != nil) {
+		if textRequest.ToolChoice != "none" {
+			return adapted, fmt.Errorf("model %s does not support tools", textRequest.Model)
+		}
+		// the client asked not to call any tool, which is what the model does without them
+		textRequest.Tools = nil
+		textRequest.Functions = nil
+		textRequest.ToolChoice = nil
+		adapted = true
+	}
+	if !modelCapability.JSONMode && textRequest.ResponseFormat != nil {
+		switch textRequest.ResponseFormat.Type {
+		case "json_object", "json_schema":
+			return adapted, fmt.Errorf("model %s does not support response_format %s", textRequest.Model, textRequest.ResponseFormat.Type)
+		}
+	}
+	return adapted, nil
+}
+
+func hasImageContent(messages []model.Message) bool {
+	for _, message := range messages {
+		for _, content := range message.ParseContent() {
+			if content.Type == model.ContentTypeImageURL {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// estimateMargin is how far an estimated prompt may be above its actual tokens
+const estimateMargin = 0.25
+
+// ValidateContextWindow rejects a prompt which does not fit in the context window
+// of the model, and lowers the max tokens to the room left for the completion. An
+// estimated prompt, not counted exactly, is taken at its lowest so that a request
+// which fits is never turned away. It reports whether the request was changed.
+func ValidateContextWindow(textRequest *model.GeneralOpenAIRequest, promptTokens int, exact bool) (adapted bool, err error) {
+	modelCapability, ok := capability.Get(textRequest.Model)
+	if !ok || modelCapability.ContextWindow <= 0 {
+		return false, nil
+	}
+	contextWindow := modelCapability.ContextWindow
+	if !exact {
+		promptTokens = int(float64(promptTokens) * (1 - estimateMargin))
+	}
+	if promptTokens >= contextWindow {
+		return false, fmt.Errorf("this model's maximum context length is %d tokens, however the messages resulted in about %d tokens", contextWindow, promptTokens)
+	}
+	room := contextWindow - promptTokens
+	if textRequest.MaxTokens > room {
+		textRequest.MaxTokens = room
+		adapted = true
+	}
+	if textRequest.MaxCompletionTokens != nil && *textRequest.MaxCompletionTokens > room {
+		textRequest.MaxCompletionTokens = &room
+		adapted = true
+	}
+	return adapted, nil
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestValidateCapability(t *testing.T) {
+	image := []any{
+		map[string]any{"type": "text", "text": "what is this?"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://example.com/a.png"}},
+	}
+	tools := []model.Tool{{Type: "function", Function: model.Function{Name: "f"}}}
+	cases := []struct {
+		name        string
+		request     model.GeneralOpenAIRequest
+		wantErr     bool
+		wantAdapted bool
+	}{
+		{"vision", model.GeneralOpenAIRequest{Model: "gpt-4o", Messages: []model.Message{{Role: "user", Content: image}}}, false, false},
+		{"no vision", model.GeneralOpenAIRequest{Model: "deepseek-chat", Messages: []model.Message{{Role: "user", Content: image}}}, true, false},
+		{"no tools", model.GeneralOpenAIRequest{Model: "o1-mini", Messages: []model.Message{{Role: "user", Content: "hi"}}, Tools: tools}, true, false},
+		{"no tools but tool_choice none", model.GeneralOpenAIRequest{Model: "o1-mini", Messages: []model.Message{{Role: "user", Content: "hi"}}, Tools: tools, ToolChoice: "none"}, false, true},
+		{"no json mode", model.GeneralOpenAIRequest{Model: "claude-3-5-sonnet-20241022", Messages: []model.Message{{Role: "user", Content: "hi"}}, ResponseFormat: &model.ResponseFormat{Type: "json_object"}}, true, false},
+		{"unknown model", model.GeneralOpenAIRequest{Model: "my-model", Messages: []model.Message{{Role: "user", Content: image}}, Tools: tools}, false, false},
+	}
+	for _, c := range cases {
+		adapted, err := ValidateCapability(&c.request, relaymode.ChatCompletions)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: got error %v, want error %v", c.name, err, c.wantErr)
+		}
+		if adapted != c.wantAdapted {
+			t.Errorf("%s: got adapted %v, want %v", c.name, adapted, c.wantAdapted)
+		}
+		if c.name == "no tools but tool_choice none" && c.request.Tools != nil {
+			t.Errorf("%s: tools should be dropped", c.name)
+		}
+	}
+}
+
+func TestValidateTokenLimits(t *testing.T) {
+	request := model.GeneralOpenAIRequest{Model: "gpt-4", Messages: []model.Message{{Role: "user", Content: "hi"}}, MaxTokens: 100000}
+	adapted, err := ValidateCapability(&request, relaymode.ChatCompletions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.MaxTokens != 8192 || !adapted {
+		t.Errorf("max_tokens = %d, want the max output tokens 8192", request.MaxTokens)
+	}
+	adapted, err = ValidateContextWindow(&request, 8000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.MaxTokens != 192 || !adapted {
+		t.Errorf("max_tokens = %d, want the 192 tokens left in the context window", request.MaxTokens)
+	}
+	if adapted, _ = ValidateContextWindow(&request, 100, true); adapted {
+		t.Error("max_tokens within the context window should be left as it is")
+	}
+	if _, err := ValidateContextWindow(&request, 9000, true); err == nil {
+		t.Error("a prompt over the context window should be rejected")
+	}
+
+	maxCompletionTokens := 100000
+	request = model.GeneralOpenAIRequest{Model: "gpt-4", MaxCompletionTokens: &maxCompletionTokens}
+	if _, err := ValidateContextWindow(&request, 8000, true); err != nil {
+		t.Fatal(err)
+	}
+	if *request.MaxCompletionTokens != 192 {
+		t.Errorf("max_completion_tokens = %d, want the 192 tokens left in the context window", *request.MaxCompletionTokens)
+	}
+}
+
+func TestValidateContextWindowEstimate(t *testing.T) {
+	// claude-3-5-sonnet has a context window of 200k tokens
+	request := model.GeneralOpenAIRequest{Model: "claude-3-5-sonnet-20241022", MaxTokens: 8192}
+	if _, err := ValidateContextWindow(&request, 210000, false); err != nil {
+		t.Errorf("an estimate a little over the context window may fit, got %v", err)
+	}
+	if request.MaxTokens != 8192 {
+		t.Errorf("max_tokens = %d, an estimate should leave it as it is while it may fit", request.MaxTokens)
+	}
+	if _, err := ValidateContextWindow(&request, 300000, false); err == nil {
+		t.Error("an estimate far over the context window should be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package hedge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+var delaysLock sync.RWMutex
+
+// GroupHedgeDelay maps a group to the delay in milliseconds after which a request
+// without a first byte is sent to a second channel, 0 disables hedging
+var GroupHedgeDelay = map[string]int{}
+
+// ModelHedgeDelay is the same per model, it overrides the delay of the group
+var ModelHedgeDelay = map[string]int{}
+
+func GroupHedgeDelay2JSONString() string {
+	return delays2JSONString(GroupHedgeDelay)
+}
+
+func UpdateGroupHedgeDelayByJSONString(jsonStr string) error {
+	delays, err := parseDelays(jsonStr)
+	if err != nil {
+		return err
+	}
+	delaysLock.Lock()
+	defer delaysLock.Unlock()
+	GroupHedgeDelay = delays
+	return nil
+}
+
+func ModelHedgeDelay2JSONString() string {
+	return delays2JSONString(ModelHedgeDelay)
+}
+
+func UpdateModelHedgeDelayByJSONString(jsonStr string) error {
+	delays, err := parseDelays(jsonStr)
+	if err != nil {
+		return err
+	}
+	delaysLock.Lock()
+	defer delaysLock.Unlock()
+	ModelHedgeDelay = delays
+	return nil
+}
+
+func delays2JSONString(delays map[string]int) string {
+	delaysLock.RLock()
+	defer delaysLock.RUnlock()
+	jsonBytes, err := json.Marshal(delays)
+	if err != nil {
+		logger.SysError("error marshalling hedge delays: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func parseDelays(jsonStr string) (map[string]int, error) {
+	delays := make(map[string]int)
+	if err := json.Unmarshal([]byte(jsonStr), &delays); err != nil {
+		return nil, err
+	}
+	for name, delay := range delays {
+		if delay < 0 {
+			return nil, fmt.Errorf("invalid hedge delay of %s: %d", name, delay)
+		}
+	}
+	return delays, nil
+}
+
+// GetDelay returns the hedge delay of the model if it has one, otherwise the one of
+// the group, 0 means the request is not hedged
+func GetDelay(group string, modelName string) time.Duration {
+	delaysLock.RLock()
+	defer delaysLock.RUnlock()
+	delay, ok := ModelHedgeDelay[modelName]
+	if !ok {
+		delay = GroupHedgeDelay[group]
+	}
+	return time.Duration(delay) * time.Millisecond
+}
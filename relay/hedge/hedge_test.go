@@ -0,0 +1,40 @@
+package hedge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetDelay(t *testing.T) {
+	if err := UpdateGroupHedgeDelayByJSONString(`{"vip": 1500}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateModelHedgeDelayByJSONString(`{"gpt-4o": 800, "o1": 0}`); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		GroupHedgeDelay = map[string]int{}
+		ModelHedgeDelay = map[string]int{}
+	}()
+
+	tests := []struct {
+		group string
+		model string
+		want  time.Duration
+	}{
+		{"vip", "gpt-4o", 800 * time.Millisecond},
+		{"default", "gpt-4o", 800 * time.Millisecond},
+		{"vip", "gpt-4o-mini", 1500 * time.Millisecond},
+		{"vip", "o1", 0},
+		{"default", "gpt-4o-mini", 0},
+	}
+	for _, tt := range tests {
+		if got := GetDelay(tt.group, tt.model); got != tt.want {
+			t.Errorf("GetDelay(%q, %q) = %s, want %s", tt.group, tt.model, got, tt.want)
+		}
+	}
+
+	if err := UpdateModelHedgeDelayByJSONString(`{"gpt-4o": -1}`); err == nil {
+		t.Error("negative delay should be rejected")
+	}
+}
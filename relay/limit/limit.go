@@ -0,0 +1,303 @@
+package limit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+const (
+	// windowTTL keeps the counts of the previous minute, which still weigh on the current one
+	windowTTL = 2 * time.Minute
+	// leaseTTL frees the requests in flight of a node which died before releasing them, the
+	// node renews the leases it holds until they are released
+	leaseTTL           = time.Minute
+	leaseRenewInterval = leaseTTL / 3
+	// waitInterval bounds a wait, since the other nodes and the passing of time free channels too
+	waitInterval = time.Second
+)
+
+// Limits are the limits of the upstream account of a channel, zero is unlimited
+type Limits struct {
+	// Concurrency is the number of requests in flight
+	Concurrency int
+	// RPM is the number of requests per minute
+	RPM int
+	// TPM is the number of tokens per minute
+	TPM int
+}
+
+func (limits Limits) unlimited() bool {
+	return limits.Concurrency <= 0 && limits.RPM <= 0 && limits.TPM <= 0
+}
+
+func (limits Limits) reached(concurrency int64, requests float64, tokens float64) bool {
+	return (limits.Concurrency > 0 && concurrency >= int64(limits.Concurrency)) ||
+		(limits.RPM > 0 && requests >= float64(limits.RPM)) ||
+		(limits.TPM > 0 && tokens >= float64(limits.TPM))
+}
+
+// window counts by minute, the count of the last minute is estimated from the current and
+// the previous one
+type window struct {
+	minute   int64
+	current  int64
+	previous int64
+}
+
+func (w *window) roll(minute int64) {
+	switch minute {
+	case w.minute:
+	case w.minute + 1:
+		w.previous, w.current = w.current, 0
+	default:
+		w.previous, w.current = 0, 0
+	}
+	w.minute = minute
+}
+
+// elapsed is the part of the current minute which has passed
+func elapsed(now time.Time) float64 {
+	return float64(now.UnixMilli()%60000) / 60000
+}
+
+func estimate(current int64, previous int64, now time.Time) float64 {
+	return float64(current) + float64(previous)*(1-elapsed(now))
+}
+
+type channelState struct {
+	concurrency int64
+	requests    window
+	tokens      window
+}
+
+var lock sync.Mutex
+var states = map[int]*channelState{}
+
+// released is closed when a request ends on this node, and replaced
+var released = make(chan struct{})
+
+// heldLeases are the leases this node holds in Redis, renewed until they are released
+var heldLeases = map[*Lease]struct{}{}
+var renewOnce sync.Once
+
+func getState(channelId int, minute int64) *channelState {
+	state, ok := states[channelId]
+	if !ok {
+		state = &channelState{}
+		states[channelId] = state
+	}
+	state.requests.roll(minute)
+	state.tokens.roll(minute)
+	return state
+}
+
+// the keys of a channel share a hash tag, so that the acquire script works on Redis Cluster
+
+func leasesKey(channelId int) string {
+	return fmt.Sprintf("channel_limit:{%d}:leases", channelId)
+}
+
+func windowKey(channelId int, kind string, minute int64) string {
+	return fmt.Sprintf("channel_limit:{%d}:%s:%d", channelId, kind, minute)
+}
+
+// acquireScript takes a lease of a channel when it is below its limits. The leases are a
+// sorted set by deadline, the ones past their deadline were left by a dead node.
+var acquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local concurrency, rpm, tpm = tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6])
+local weight = 1 - tonumber(ARGV[7])
+if concurrency > 0 and redis.call('ZCARD', KEYS[1]) >= concurrency then
+	return 0
+end
+if rpm > 0 and tonumber(redis.call('GET', KEYS[2]) or '0') + tonumber(redis.call('GET', KEYS[3]) or '0') * weight >= rpm then
+	return 0
+end
+if tpm > 0 and tonumber(redis.call('GET', KEYS[4]) or '0') + tonumber(redis.call('GET', KEYS[5]) or '0') * weight >= tpm then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[8])
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[9])
+return 1
+`)
+
+// Lease is a request in flight to a channel
+type Lease struct {
+	channelId int
+	// id is the member of the lease in Redis, empty when the lease is only counted in memory
+	id   string
+	once sync.Once
+}
+
+// TryAcquire counts a request to the channel unless the channel is at one of its limits,
+// in a single step so that concurrent requests cannot go beyond them. It returns a nil
+// lease for a channel without limits.
+func TryAcquire(channelId int, limits Limits) (*Lease, bool) {
+	if limits.unlimited() {
+		return nil, true
+	}
+	now := time.Now()
+	minute := now.Unix() / 60
+	if common.RedisEnabled {
+		renewOnce.Do(func() {
+			go renewLeases()
+		})
+		lease := &Lease{channelId: channelId, id: random.GetUUID()}
+		acquired, err := acquireScript.Run(context.Background(), common.RDB,
+			[]string{
+				leasesKey(channelId),
+				windowKey(channelId, "requests", minute), windowKey(channelId, "requests", minute-1),
+				windowKey(channelId, "tokens", minute), windowKey(channelId, "tokens", minute-1),
+			},
+			now.UnixMilli(), now.Add(leaseTTL).UnixMilli(), lease.id,
+			limits.Concurrency, limits.RPM, limits.TPM, elapsed(now),
+			leaseTTL.Milliseconds(), windowTTL.Milliseconds(),
+		).Int()
+		if err != nil {
+			// the limits are a protection of the upstream account, not worth failing the request
+			logger.SysError("failed to acquire channel limits: " + err.Error())
+			return nil, true
+		}
+		if acquired == 0 {
+			return nil, false
+		}
+		lock.Lock()
+		heldLeases[lease] = struct{}{}
+		lock.Unlock()
+		return lease, true
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	state := getState(channelId, minute)
+	if limits.reached(state.concurrency,
+		estimate(state.requests.current, state.requests.previous, now),
+		estimate(state.tokens.current, state.tokens.previous, now)) {
+		return nil, false
+	}
+	state.concurrency++
+	state.requests.current++
+	return &Lease{channelId: channelId}, true
+}
+
+// Acquire counts a request to the channel even beyond its limits, for the requests which
+// must not be turned away such as channel tests. It returns nil for a channel without limits.
+func Acquire(channelId int, limits Limits) *Lease {
+	if limits.unlimited() {
+		return nil
+	}
+	now := time.Now()
+	minute := now.Unix() / 60
+	if common.RedisEnabled {
+		renewOnce.Do(func() {
+			go renewLeases()
+		})
+		lease := &Lease{channelId: channelId, id: random.GetUUID()}
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		pipe.ZAdd(ctx, leasesKey(channelId), &redis.Z{Score: float64(now.Add(leaseTTL).UnixMilli()), Member: lease.id})
+		pipe.Expire(ctx, leasesKey(channelId), leaseTTL)
+		pipe.Incr(ctx, windowKey(channelId, "requests", minute))
+		pipe.Expire(ctx, windowKey(channelId, "requests", minute), windowTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.SysError("failed to acquire channel limits: " + err.Error())
+		}
+		lock.Lock()
+		heldLeases[lease] = struct{}{}
+		lock.Unlock()
+		return lease
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	state := getState(channelId, minute)
+	state.concurrency++
+	state.requests.current++
+	return &Lease{channelId: channelId}
+}
+
+// renewLeases pushes back the deadlines of the leases this node holds
+func renewLeases() {
+	for {
+		time.Sleep(leaseRenewInterval)
+		lock.Lock()
+		leases := make([]*Lease, 0, len(heldLeases))
+		for lease := range heldLeases {
+			leases = append(leases, lease)
+		}
+		lock.Unlock()
+		if len(leases) == 0 {
+			continue
+		}
+		ctx := context.Background()
+		deadline := float64(time.Now().Add(leaseTTL).UnixMilli())
+		pipe := common.RDB.Pipeline()
+		for _, lease := range leases {
+			// XX leaves out the leases released meanwhile
+			pipe.ZAddXX(ctx, leasesKey(lease.channelId), &redis.Z{Score: deadline, Member: lease.id})
+			pipe.Expire(ctx, leasesKey(lease.channelId), leaseTTL)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logger.SysError("failed to renew channel leases: " + err.Error())
+		}
+	}
+}
+
+// Release ends the request of the lease, counting the tokens it used. Releasing a nil or
+// released lease does nothing.
+func (l *Lease) Release(tokens int) {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		minute := time.Now().Unix() / 60
+		if l.id != "" {
+			ctx := context.Background()
+			pipe := common.RDB.TxPipeline()
+			pipe.ZRem(ctx, leasesKey(l.channelId), l.id)
+			if tokens > 0 {
+				pipe.IncrBy(ctx, windowKey(l.channelId, "tokens", minute), int64(tokens))
+				pipe.Expire(ctx, windowKey(l.channelId, "tokens", minute), windowTTL)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				logger.SysError("failed to release channel limits: " + err.Error())
+			}
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		if l.id != "" {
+			delete(heldLeases, l)
+		} else {
+			state := getState(l.channelId, minute)
+			state.concurrency--
+			state.tokens.current += int64(tokens)
+		}
+		close(released)
+		released = make(chan struct{})
+	})
+}
+
+// Wait returns when a request ends on this node, after at most d or a second
+func Wait(ctx context.Context, d time.Duration) {
+	if d > waitInterval {
+		d = waitInterval
+	}
+	lock.Lock()
+	ch := released
+	lock.Unlock()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ch:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,135 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func init() {
+	common.RedisEnabled = false
+}
+
+func TestLimits(t *testing.T) {
+	defer func() {
+		states = map[int]*channelState{}
+	}()
+	if lease, ok := TryAcquire(1, Limits{}); lease != nil || !ok {
+		t.Fatal("channels without limits should not be counted")
+	}
+
+	limits := Limits{Concurrency: 2}
+	first, _ := TryAcquire(1, limits)
+	second, _ := TryAcquire(1, limits)
+	if _, ok := TryAcquire(1, limits); ok {
+		t.Error("channel should be saturated at its concurrency")
+	}
+	first.Release(0)
+	first.Release(0)
+	third, ok := TryAcquire(1, limits)
+	if !ok {
+		t.Error("released request should free the channel")
+	}
+	if _, ok := TryAcquire(1, limits); ok {
+		t.Error("released request should free the channel only once")
+	}
+	second.Release(0)
+	third.Release(0)
+
+	limits = Limits{RPM: 3}
+	for i := 0; i < 3; i++ {
+		lease, ok := TryAcquire(2, limits)
+		if !ok {
+			t.Fatal("channel should not be saturated below its requests per minute")
+		}
+		lease.Release(0)
+	}
+	if _, ok := TryAcquire(2, limits); ok {
+		t.Error("channel should be saturated at its requests per minute")
+	}
+	if lease, ok := TryAcquire(2, Limits{RPM: 5}); !ok {
+		t.Error("channel should not be saturated below a higher limit")
+	} else {
+		lease.Release(0)
+	}
+
+	limits = Limits{TPM: 1000}
+	lease, _ := TryAcquire(3, limits)
+	lease.Release(600)
+	lease, ok = TryAcquire(3, limits)
+	if !ok {
+		t.Fatal("channel should not be saturated below its tokens per minute")
+	}
+	lease.Release(600)
+	if _, ok := TryAcquire(3, limits); ok {
+		t.Error("channel should be saturated at its tokens per minute")
+	}
+
+	// forced requests count beyond the limits
+	limits = Limits{Concurrency: 1}
+	forced := []*Lease{Acquire(5, limits), Acquire(5, limits)}
+	if _, ok := TryAcquire(5, limits); ok {
+		t.Error("forced requests should count against the limits")
+	}
+	forced[0].Release(0)
+	if _, ok := TryAcquire(5, limits); ok {
+		t.Error("channel should be saturated while a forced request is in flight")
+	}
+	forced[1].Release(0)
+}
+
+func TestTryAcquireConcurrent(t *testing.T) {
+	defer func() {
+		states = map[int]*channelState{}
+	}()
+	limits := Limits{Concurrency: 3, RPM: 100}
+	var wg sync.WaitGroup
+	var acquired atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := TryAcquire(6, limits); ok {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired.Load() != 3 {
+		t.Errorf("a burst should get exactly the concurrency of the channel, got %d", acquired.Load())
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := window{minute: 10, current: 6, previous: 2}
+	w.roll(11)
+	if w.current != 0 || w.previous != 6 {
+		t.Errorf("next minute should start from zero, got %+v", w)
+	}
+	w.roll(13)
+	if w.current != 0 || w.previous != 0 {
+		t.Errorf("counts older than a minute should be dropped, got %+v", w)
+	}
+	// 15 seconds into the minute, three quarters of the previous one are still in the window
+	now := time.Unix(60*100+15, 0)
+	if got := estimate(10, 8, now); got != 16 {
+		t.Errorf("estimate = %v, want 16", got)
+	}
+}
+
+func TestWait(t *testing.T) {
+	lease, _ := TryAcquire(4, Limits{Concurrency: 1})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lease.Release(0)
+	}()
+	start := time.Now()
+	Wait(context.Background(), 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("wait should end with the release, took %s", elapsed)
+	}
+}
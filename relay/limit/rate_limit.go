@@ -0,0 +1,198 @@
+package limit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	// dailyTTL keeps the requests of a day until it is over
+	dailyTTL = 25 * time.Hour
+	// rateLimitStateTTL is how long the counts of an idle token or user are kept in memory
+	rateLimitStateTTL = 25 * time.Hour
+)
+
+// RateLimits are the limits of a token or a user, zero is unlimited
+type RateLimits struct {
+	RPM int `json:"rpm"`
+	TPM int `json:"tpm"`
+	// RPD is the number of requests per day, days start at midnight UTC
+	RPD int `json:"rpd"`
+}
+
+func (limits RateLimits) Unlimited() bool {
+	return limits.RPM <= 0 && limits.TPM <= 0 && limits.RPD <= 0
+}
+
+var groupRateLimitsLock sync.RWMutex
+
+// GroupRateLimits are the limits of the users of a group who have none of their own
+var GroupRateLimits = map[string]RateLimits{}
+
+func GroupRateLimits2JSONString() string {
+	groupRateLimitsLock.RLock()
+	defer groupRateLimitsLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupRateLimits)
+	if err != nil {
+		logger.SysError("error marshalling group rate limits: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupRateLimitsByJSONString(jsonStr string) error {
+	rateLimits := make(map[string]RateLimits)
+	if err := json.Unmarshal([]byte(jsonStr), &rateLimits); err != nil {
+		return err
+	}
+	for group, limits := range rateLimits {
+		if limits.RPM < 0 || limits.TPM < 0 || limits.RPD < 0 {
+			return fmt.Errorf("rate limits of group %s cannot be negative", group)
+		}
+	}
+	groupRateLimitsLock.Lock()
+	defer groupRateLimitsLock.Unlock()
+	GroupRateLimits = rateLimits
+	return nil
+}
+
+func GetGroupRateLimits(group string) RateLimits {
+	groupRateLimitsLock.RLock()
+	defer groupRateLimitsLock.RUnlock()
+	return GroupRateLimits[group]
+}
+
+// RateLimitUsage is where a token or a user stands against its limits
+type RateLimitUsage struct {
+	// Requests and Tokens are estimated over the last minute
+	Requests      float64
+	Tokens        float64
+	DailyRequests int64
+}
+
+type rateLimitState struct {
+	requests window
+	tokens   window
+	day      int64
+	daily    int64
+	seenTime time.Time
+}
+
+var rateLimitLock sync.Mutex
+var rateLimitStates = map[string]*rateLimitState{}
+var rateLimitPruneTime = time.Now()
+
+func getRateLimitState(key string, now time.Time) *rateLimitState {
+	if now.Sub(rateLimitPruneTime) > time.Hour {
+		for key, state := range rateLimitStates {
+			if now.Sub(state.seenTime) > rateLimitStateTTL {
+				delete(rateLimitStates, key)
+			}
+		}
+		rateLimitPruneTime = now
+	}
+	state, ok := rateLimitStates[key]
+	if !ok {
+		state = &rateLimitState{}
+		rateLimitStates[key] = state
+	}
+	minute, day := now.Unix()/60, now.Unix()/86400
+	state.requests.roll(minute)
+	state.tokens.roll(minute)
+	if state.day != day {
+		state.day, state.daily = day, 0
+	}
+	state.seenTime = now
+	return state
+}
+
+func rateLimitKey(key string, kind string, bucket int64) string {
+	return fmt.Sprintf("rate_limit:%s:%s:%d", key, kind, bucket)
+}
+
+// GetRateLimitUsage returns the usage of the token or user of the key, e.g. token:1
+func GetRateLimitUsage(key string) RateLimitUsage {
+	now := time.Now()
+	minute, day := now.Unix()/60, now.Unix()/86400
+	if !common.RedisEnabled {
+		rateLimitLock.Lock()
+		defer rateLimitLock.Unlock()
+		state := getRateLimitState(key, now)
+		return RateLimitUsage{
+			Requests:      estimate(state.requests.current, state.requests.previous, now),
+			Tokens:        estimate(state.tokens.current, state.tokens.previous, now),
+			DailyRequests: state.daily,
+		}
+	}
+	values, err := common.RDB.MGet(context.Background(),
+		rateLimitKey(key, "requests", minute), rateLimitKey(key, "requests", minute-1),
+		rateLimitKey(key, "tokens", minute), rateLimitKey(key, "tokens", minute-1),
+		rateLimitKey(key, "daily", day),
+	).Result()
+	if err != nil {
+		logger.SysError("failed to get rate limit usage: " + err.Error())
+		return RateLimitUsage{}
+	}
+	counts := make([]int64, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return RateLimitUsage{
+		Requests:      estimate(counts[0], counts[1], now),
+		Tokens:        estimate(counts[2], counts[3], now),
+		DailyRequests: counts[4],
+	}
+}
+
+// CountRequest counts a request of the token or user of the key
+func CountRequest(key string) {
+	now := time.Now()
+	minute, day := now.Unix()/60, now.Unix()/86400
+	if !common.RedisEnabled {
+		rateLimitLock.Lock()
+		defer rateLimitLock.Unlock()
+		state := getRateLimitState(key, now)
+		state.requests.current++
+		state.daily++
+		return
+	}
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	pipe.Incr(ctx, rateLimitKey(key, "requests", minute))
+	pipe.Expire(ctx, rateLimitKey(key, "requests", minute), windowTTL)
+	pipe.Incr(ctx, rateLimitKey(key, "daily", day))
+	pipe.Expire(ctx, rateLimitKey(key, "daily", day), dailyTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.SysError("failed to count request: " + err.Error())
+	}
+}
+
+// CountTokens counts the tokens used by a request of the token or user of the key
+func CountTokens(key string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	now := time.Now()
+	minute := now.Unix() / 60
+	if !common.RedisEnabled {
+		rateLimitLock.Lock()
+		defer rateLimitLock.Unlock()
+		getRateLimitState(key, now).tokens.current += int64(tokens)
+		return
+	}
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	pipe.IncrBy(ctx, rateLimitKey(key, "tokens", minute), int64(tokens))
+	pipe.Expire(ctx, rateLimitKey(key, "tokens", minute), windowTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.SysError("failed to count tokens: " + err.Error())
+	}
+}
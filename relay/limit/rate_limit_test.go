@@ -0,0 +1,46 @@
+package limit
+
+import (
+	"testing"
+)
+
+func TestRateLimitUsage(t *testing.T) {
+	defer func() {
+		rateLimitStates = map[string]*rateLimitState{}
+	}()
+	if usage := GetRateLimitUsage("token:1"); usage != (RateLimitUsage{}) {
+		t.Fatalf("unused token should have no usage, got %+v", usage)
+	}
+	CountRequest("token:1")
+	CountRequest("token:1")
+	CountTokens("token:1", 300)
+	CountTokens("token:1", -1)
+	usage := GetRateLimitUsage("token:1")
+	if usage.Requests < 2 || usage.DailyRequests != 2 || usage.Tokens < 300 {
+		t.Errorf("expected 2 requests and 300 tokens, got %+v", usage)
+	}
+	if usage := GetRateLimitUsage("user:1"); usage != (RateLimitUsage{}) {
+		t.Errorf("usage of a token should not count for another key, got %+v", usage)
+	}
+}
+
+func TestGroupRateLimits(t *testing.T) {
+	defer func() {
+		GroupRateLimits = map[string]RateLimits{}
+	}()
+	if err := UpdateGroupRateLimitsByJSONString(`{"vip":{"rpm":-1}}`); err == nil {
+		t.Error("negative rate limits should be rejected")
+	}
+	if err := UpdateGroupRateLimitsByJSONString(`{"default":{"rpm":60,"rpd":1000}}`); err != nil {
+		t.Fatal(err)
+	}
+	if limits := GetGroupRateLimits("default"); limits != (RateLimits{RPM: 60, RPD: 1000}) {
+		t.Errorf("unexpected limits of the default group: %+v", limits)
+	}
+	if !GetGroupRateLimits("vip").Unlimited() {
+		t.Error("group without limits should be unlimited")
+	}
+	if GroupRateLimits2JSONString() != `{"default":{"rpm":60,"tpm":0,"rpd":1000}}` {
+		t.Errorf("unexpected group rate limits: %s", GroupRateLimits2JSONString())
+	}
+}
@@ -35,6 +35,17 @@ type Meta struct {
 	PromptTokens       int // only for DoResponse
 	ForcedSystemPrompt string
 	StartTime          time.Time
+	// BatchId is set when the request is executed as part of a batch
+	BatchId string
+	// ContextStrategy is the truncation strategy of the token, empty to use the one of the group
+	ContextStrategy string
+	// TruncatedMessages is the number of messages dropped to fit in the context window
+	TruncatedMessages int
+	// RequestAdapted is set when the request was changed to fit the capabilities of the
+	// model, so the body of the client cannot be sent as it is
+	RequestAdapted bool
+	// IsCacheHit is set when the response is served from the response cache
+	IsCacheHit bool
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -53,6 +64,8 @@ func GetByContext(c *gin.Context) *Meta {
 		RequestURLPath:     c.Request.URL.String(),
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
 		StartTime:          time.Now(),
+		BatchId:            c.GetString(ctxkey.BatchId),
+		ContextStrategy:    c.GetString(ctxkey.ContextStrategy),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
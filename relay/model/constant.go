@@ -5,7 +5,13 @@ const (
 	ContentTypeImageURL   = "image_url"
 	ContentTypeInputAudio = "input_audio"
 	// Responses API constants
-	ResponsesOutputTypeMessage    = "message"
-	ResponsesContentTypeOutputText = "output_text"
-	ResponsesIDPrefixLength        = 8
+	ResponsesOutputTypeMessage           = "message"
+	ResponsesOutputTypeReasoning         = "reasoning"
+	ResponsesOutputTypeFunctionCall      = "function_call"
+	ResponsesInputTypeFunctionCallOutput = "function_call_output"
+	ResponsesContentTypeInputText        = "input_text"
+	ResponsesContentTypeInputImage       = "input_image"
+	ResponsesContentTypeOutputText       = "output_text"
+	ResponsesContentTypeSummaryText      = "summary_text"
+	ResponsesIDPrefixLength              = 8
 )
@@ -9,4 +9,7 @@ type ImageRequest struct {
 	ResponseFormat string `json:"response_format,omitempty"`
 	Style          string `json:"style,omitempty"`
 	User           string `json:"user,omitempty"`
+	// Image and Mask are the uploaded files of edits and variations, as data URLs
+	Image string `json:"image,omitempty"`
+	Mask  string `json:"mask,omitempty"`
 }
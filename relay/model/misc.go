@@ -6,6 +6,8 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 
 	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	// Estimated is set when the usage is counted locally, the upstream reporting none
+	Estimated bool `json:"-"`
 }
 
 type CompletionTokensDetails struct {
@@ -0,0 +1,38 @@
+package model
+
+// https://platform.openai.com/docs/api-reference/realtime-server-events
+
+const RealtimeEventTypeResponseDone = "response.done"
+
+// RealtimeEvent holds the fields of a realtime server event needed for billing,
+// the event itself is forwarded to the client untouched
+type RealtimeEvent struct {
+	Type     string            `json:"type"`
+	Response *RealtimeResponse `json:"response,omitempty"`
+}
+
+type RealtimeResponse struct {
+	Id     string         `json:"id"`
+	Status string         `json:"status"`
+	Usage  *RealtimeUsage `json:"usage,omitempty"`
+}
+
+type RealtimeTokenDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+	TextTokens   int `json:"text_tokens"`
+	AudioTokens  int `json:"audio_tokens"`
+}
+
+type RealtimeUsage struct {
+	TotalTokens        int                  `json:"total_tokens"`
+	InputTokens        int                  `json:"input_tokens"`
+	OutputTokens       int                  `json:"output_tokens"`
+	InputTokenDetails  RealtimeTokenDetails `json:"input_token_details"`
+	OutputTokenDetails RealtimeTokenDetails `json:"output_token_details"`
+}
+
+// RealtimeErrorEvent is sent to the client before the relay closes a session
+type RealtimeErrorEvent struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
@@ -0,0 +1,69 @@
+package model
+
+// https://docs.cohere.com/reference/rerank
+// https://jina.ai/reranker/
+
+// RerankRequest is the request of the rerank endpoint, documents are either plain
+// strings or objects with a text field
+type RerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            int    `json:"top_n,omitempty"`
+	ReturnDocuments *bool  `json:"return_documents,omitempty"`
+	MaxChunksPerDoc int    `json:"max_chunks_per_doc,omitempty"`
+	OverlapTokens   int    `json:"overlap_tokens,omitempty"`
+}
+
+// DocumentTexts returns the text of every document of the request
+func (r RerankRequest) DocumentTexts() []string {
+	texts := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			texts = append(texts, v)
+		case map[string]any:
+			if text, ok := v["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankTokens struct {
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+type RerankBilledUnits struct {
+	SearchUnits  int `json:"search_units,omitempty"`
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+}
+
+// RerankMeta is how Cohere, SiliconFlow and Xinference report what a request cost
+type RerankMeta struct {
+	BilledUnits *RerankBilledUnits `json:"billed_units,omitempty"`
+	Tokens      *RerankTokens      `json:"tokens,omitempty"`
+}
+
+// RerankResponse covers the Cohere and the Jina shape of a rerank response, the
+// former reports usage in meta and the latter in usage
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Results []RerankResult `json:"results"`
+	Meta    *RerankMeta    `json:"meta,omitempty"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
@@ -1,16 +1,59 @@
 package model
 
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ResponsesTool is a tool the model may call, only function tools can be bridged to chat completions
+type ResponsesTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+	Strict      *bool  `json:"strict,omitempty"`
+}
+
+// ResponsesTextFormat is the text.format field, which replaces response_format
+type ResponsesTextFormat struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort  *string `json:"effort,omitempty"`
+	Summary *string `json:"summary,omitempty"`
+}
+
 // ResponsesRequest represents the OpenAI Responses API request format
-// Minimal implementation supporting input and messages fields
 type ResponsesRequest struct {
-	Model    string    `json:"model" binding:"required"`
-	Input    any       `json:"input,omitempty"`
-	Messages []Message `json:"messages,omitempty"`
-	Stream   bool      `json:"stream,omitempty"`
+	Model        string    `json:"model" binding:"required"`
+	Input        any       `json:"input,omitempty"`
+	Messages     []Message `json:"messages,omitempty"`
+	Instructions string    `json:"instructions,omitempty"`
+	Stream       bool      `json:"stream,omitempty"`
 	// Additional fields that may be passed through
-	MaxTokens   int      `json:"max_tokens,omitempty"`
-	Temperature *float64 `json:"temperature,omitempty"`
-	TopP        *float64 `json:"top_p,omitempty"`
+	MaxTokens         int                 `json:"max_tokens,omitempty"`
+	MaxOutputTokens   int                 `json:"max_output_tokens,omitempty"`
+	Temperature       *float64            `json:"temperature,omitempty"`
+	TopP              *float64            `json:"top_p,omitempty"`
+	Tools             []ResponsesTool     `json:"tools,omitempty"`
+	ToolChoice        any                 `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool               `json:"parallel_tool_calls,omitempty"`
+	Text              *ResponsesText      `json:"text,omitempty"`
+	Reasoning         *ResponsesReasoning `json:"reasoning,omitempty"`
+	Metadata          map[string]string   `json:"metadata,omitempty"`
+	User              string              `json:"user,omitempty"`
+	// Store keeps the response for retrieval and chaining, nil means the server default
+	Store              *bool  `json:"store,omitempty"`
+	PreviousResponseID string `json:"previous_response_id,omitempty"`
 }
 
 // ParseInput converts input field to messages format
@@ -40,11 +83,14 @@ func (r *ResponsesRequest) ParseInput() []Message {
 	case []any:
 		// Handle array of strings/objects
 		for _, item := range v {
-			if str, ok := item.(string); ok {
+			switch item := item.(type) {
+			case string:
 				messages = append(messages, Message{
 					Role:    "user",
-					Content: str,
+					Content: item,
 				})
+			case map[string]any:
+				messages = appendResponsesInputItem(messages, item)
 			}
 		}
 	}
@@ -52,52 +98,186 @@ func (r *ResponsesRequest) ParseInput() []Message {
 	return messages
 }
 
+// appendResponsesInputItem converts one input item to chat messages
+func appendResponsesInputItem(messages []Message, item map[string]any) []Message {
+	itemType, _ := item["type"].(string)
+	switch itemType {
+	case ResponsesOutputTypeFunctionCall:
+		callId, _ := item["call_id"].(string)
+		name, _ := item["name"].(string)
+		arguments, _ := item["arguments"].(string)
+		toolCall := Tool{
+			Id:       callId,
+			Type:     "function",
+			Function: Function{Name: name, Arguments: arguments},
+		}
+		// calls made in one turn belong to the same assistant message
+		if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+			messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, toolCall)
+			return messages
+		}
+		return append(messages, Message{Role: "assistant", ToolCalls: []Tool{toolCall}})
+	case ResponsesInputTypeFunctionCallOutput:
+		callId, _ := item["call_id"].(string)
+		output, ok := item["output"].(string)
+		if !ok {
+			encoded, _ := json.Marshal(item["output"])
+			output = string(encoded)
+		}
+		return append(messages, Message{Role: "tool", ToolCallId: callId, Content: output})
+	case ResponsesOutputTypeMessage, "":
+		role, _ := item["role"].(string)
+		if role == "developer" {
+			role = "system"
+		}
+		return append(messages, Message{Role: role, Content: convertResponsesInputContent(item["content"])})
+	}
+	// reasoning items and item references have no chat completion equivalent
+	return messages
+}
+
+// convertResponsesInputContent converts input_text, output_text and input_image
+// parts to chat content, plain text collapses into a string
+func convertResponsesInputContent(content any) any {
+	parts, ok := content.([]any)
+	if !ok {
+		return content
+	}
+	var converted []any
+	var text strings.Builder
+	onlyText := true
+	for _, part := range parts {
+		partMap, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch partMap["type"] {
+		case ResponsesContentTypeInputText, ResponsesContentTypeOutputText, "refusal":
+			partText, _ := partMap["text"].(string)
+			if partText == "" {
+				partText, _ = partMap["refusal"].(string)
+			}
+			text.WriteString(partText)
+			converted = append(converted, map[string]any{"type": ContentTypeText, "text": partText})
+		case ResponsesContentTypeInputImage:
+			onlyText = false
+			imageURL := map[string]any{"url": partMap["image_url"]}
+			if detail, ok := partMap["detail"].(string); ok && detail != "" {
+				imageURL["detail"] = detail
+			}
+			converted = append(converted, map[string]any{"type": ContentTypeImageURL, "image_url": imageURL})
+		}
+	}
+	if onlyText {
+		return text.String()
+	}
+	return converted
+}
+
 // ResponsesOutputContent represents a content item in the output
 type ResponsesOutputContent struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponsesSummaryText is a part of the summary of a reasoning item
+type ResponsesSummaryText struct {
 	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
+	Text string `json:"text"`
 }
 
-// ResponsesOutputItem represents an output item (message) in the response
+// ResponsesOutputItem represents an output item (message, reasoning or function call) in the response
 type ResponsesOutputItem struct {
-	ID      string                    `json:"id"`
-	Type    string                    `json:"type"`
-	Role    string                    `json:"role"`
-	Content []ResponsesOutputContent  `json:"content"`
+	ID      string                   `json:"id"`
+	Type    string                   `json:"type"`
+	Status  string                   `json:"status,omitempty"`
+	Role    string                   `json:"role,omitempty"`
+	Content []ResponsesOutputContent `json:"content,omitempty"`
+	Summary []ResponsesSummaryText   `json:"summary,omitempty"`
+	// function call fields
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// ResponsesUsage reports usage with the Responses API names, the chat completion
+// names are kept for clients written against the earlier format
+type ResponsesUsage struct {
+	Usage
+	InputTokens         int                           `json:"input_tokens"`
+	OutputTokens        int                           `json:"output_tokens"`
+	OutputTokensDetails *ResponsesOutputTokensDetails `json:"output_tokens_details,omitempty"`
+}
+
+func NewResponsesUsage(usage Usage) *ResponsesUsage {
+	responsesUsage := &ResponsesUsage{
+		Usage:        usage,
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	if usage.CompletionTokensDetails != nil {
+		responsesUsage.OutputTokensDetails = &ResponsesOutputTokensDetails{
+			ReasoningTokens: usage.CompletionTokensDetails.ReasoningTokens,
+		}
+	}
+	return responsesUsage
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
 }
 
 // ResponsesResponse represents the OpenAI Responses API response format
 type ResponsesResponse struct {
-	ID      string                 `json:"id"`
-	Object  string                 `json:"object"`
-	Created int64                  `json:"created,omitempty"`
-	Model   string                 `json:"model,omitempty"`
-	Output  []ResponsesOutputItem  `json:"output"`
-	Usage   *Usage                 `json:"usage,omitempty"`
-}
-
-// ResponsesStreamResponseOutputContent represents streaming output content
-type ResponsesStreamResponseOutputContent struct {
-	Type  string  `json:"type"`
-	Delta *string `json:"delta,omitempty"`
-	Text  *string `json:"text,omitempty"`
-}
-
-// ResponsesStreamResponseOutputItem represents a streaming output item
-type ResponsesStreamResponseOutputItem struct {
-	Index   int                                    `json:"index"`
-	ID      *string                                `json:"id,omitempty"`
-	Type    string                                 `json:"type"`
-	Role    *string                                `json:"role,omitempty"`
-	Content []ResponsesStreamResponseOutputContent `json:"content,omitempty"`
-}
-
-// ResponsesStreamResponse represents the streaming response format
-type ResponsesStreamResponse struct {
-	ID      string                              `json:"id"`
-	Object  string                              `json:"object"`
-	Created int64                               `json:"created,omitempty"`
-	Model   string                              `json:"model,omitempty"`
-	Output  []ResponsesStreamResponseOutputItem `json:"output,omitempty"`
-	Usage   *Usage                              `json:"usage,omitempty"`
+	ID                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	Created            int64                       `json:"created,omitempty"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status,omitempty"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Model              string                      `json:"model,omitempty"`
+	Output             []ResponsesOutputItem       `json:"output"`
+	Usage              *ResponsesUsage             `json:"usage,omitempty"`
+	Instructions       string                      `json:"instructions,omitempty"`
+	Tools              []ResponsesTool             `json:"tools"`
+	ToolChoice         any                         `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool                       `json:"parallel_tool_calls,omitempty"`
+	Temperature        *float64                    `json:"temperature,omitempty"`
+	TopP               *float64                    `json:"top_p,omitempty"`
+	MaxOutputTokens    int                         `json:"max_output_tokens,omitempty"`
+	Text               *ResponsesText              `json:"text,omitempty"`
+	Reasoning          *ResponsesReasoning         `json:"reasoning,omitempty"`
+	Metadata           map[string]string           `json:"metadata,omitempty"`
+	PreviousResponseID string                      `json:"previous_response_id,omitempty"`
+	Store              bool                        `json:"store"`
+}
+
+// StoredResponse is the conversation turn persisted for a stored response,
+// Input and Output are replayed when a later request names it as previous_response_id
+type StoredResponse struct {
+	Input    []Message          `json:"input"`
+	Output   []Message          `json:"output"`
+	Response *ResponsesResponse `json:"response"`
+}
+
+// ResponsesStreamEvent is one server-sent event of a streamed response,
+// only the fields belonging to its type are set
+type ResponsesStreamEvent struct {
+	Type           string                  `json:"type"`
+	SequenceNumber int                     `json:"sequence_number"`
+	Response       *ResponsesResponse      `json:"response,omitempty"`
+	OutputIndex    *int                    `json:"output_index,omitempty"`
+	ItemID         string                  `json:"item_id,omitempty"`
+	ContentIndex   *int                    `json:"content_index,omitempty"`
+	SummaryIndex   *int                    `json:"summary_index,omitempty"`
+	Item           *ResponsesOutputItem    `json:"item,omitempty"`
+	Part           *ResponsesOutputContent `json:"part,omitempty"`
+	Delta          string                  `json:"delta,omitempty"`
+	Text           *string                 `json:"text,omitempty"`
+	Arguments      *string                 `json:"arguments,omitempty"`
 }
@@ -15,4 +15,18 @@ const (
 	Proxy
 	// Responses is the OpenAI Responses API endpoint
 	Responses
+	// AnthropicMessages is the native Anthropic Messages API endpoint
+	AnthropicMessages
+	// GeminiGenerateContent is the native Gemini generateContent/streamGenerateContent endpoint
+	GeminiGenerateContent
+	ImagesEdits
+	ImagesVariations
+	// Realtime is the OpenAI Realtime API WebSocket endpoint
+	Realtime
+	// OllamaChat, OllamaGenerate and OllamaEmbed are the native Ollama API endpoints
+	OllamaChat
+	OllamaGenerate
+	OllamaEmbed
+	// Rerank is the Cohere and Jina style document rerank endpoint
+	Rerank
 )
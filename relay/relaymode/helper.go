@@ -16,6 +16,10 @@ func GetByPath(path string) int {
 		relayMode = Moderations
 	} else if strings.HasPrefix(path, "/v1/images/generations") {
 		relayMode = ImagesGenerations
+	} else if strings.HasPrefix(path, "/v1/images/edits") {
+		relayMode = ImagesEdits
+	} else if strings.HasPrefix(path, "/v1/images/variations") {
+		relayMode = ImagesVariations
 	} else if strings.HasPrefix(path, "/v1/edits") {
 		relayMode = Edits
 	} else if strings.HasPrefix(path, "/v1/audio/speech") {
@@ -28,6 +32,20 @@ func GetByPath(path string) int {
 		relayMode = Proxy
 	} else if strings.HasPrefix(path, "/v1/responses") {
 		relayMode = Responses
+	} else if strings.HasPrefix(path, "/v1/messages") {
+		relayMode = AnthropicMessages
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = Rerank
+	} else if strings.HasPrefix(path, "/v1/realtime") {
+		relayMode = Realtime
+	} else if strings.HasPrefix(path, "/api/chat") {
+		relayMode = OllamaChat
+	} else if strings.HasPrefix(path, "/api/generate") {
+		relayMode = OllamaGenerate
+	} else if strings.HasPrefix(path, "/api/embed") {
+		relayMode = OllamaEmbed
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayMode = GeminiGenerateContent
 	}
 	return relayMode
 }
@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// strategies choosing a channel among the channels of the highest priority
+const (
+	// Random chooses uniformly
+	Random = "random"
+	// Weighted chooses in proportion to the weights of the channels, which is the default
+	Weighted = "weighted"
+	// Adaptive draws two channels by weight and keeps the one with the lower expected latency
+	Adaptive = "adaptive"
+)
+
+var strategiesLock sync.RWMutex
+
+// ChannelRoutingStrategy is the strategy of the groups without their own
+var ChannelRoutingStrategy = Weighted
+
+// GroupRoutingStrategy maps a group to its strategy
+var GroupRoutingStrategy = map[string]string{}
+
+func validate(strategy string) error {
+	switch strategy {
+	case Random, Weighted, Adaptive:
+		return nil
+	}
+	return fmt.Errorf("unknown routing strategy: %s", strategy)
+}
+
+func UpdateChannelRoutingStrategy(strategy string) error {
+	if err := validate(strategy); err != nil {
+		return err
+	}
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	ChannelRoutingStrategy = strategy
+	return nil
+}
+
+func GroupRoutingStrategy2JSONString() string {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupRoutingStrategy)
+	if err != nil {
+		logger.SysError("error marshalling group routing strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupRoutingStrategyByJSONString(jsonStr string) error {
+	strategies := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &strategies); err != nil {
+		return err
+	}
+	for group, strategy := range strategies {
+		if err := validate(strategy); err != nil {
+			return fmt.Errorf("invalid routing strategy of group %s: %w", group, err)
+		}
+	}
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	GroupRoutingStrategy = strategies
+	return nil
+}
+
+// GetStrategy returns the strategy of the group, or the global one when it has none
+func GetStrategy(group string) string {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	if strategy, ok := GroupRoutingStrategy[group]; ok {
+		return strategy
+	}
+	return ChannelRoutingStrategy
+}
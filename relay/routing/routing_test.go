@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetStrategy(t *testing.T) {
+	if err := UpdateGroupRoutingStrategyByJSONString(`{"vip": "adaptive"}`); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ChannelRoutingStrategy = Weighted
+		GroupRoutingStrategy = map[string]string{}
+	}()
+	if got := GetStrategy("vip"); got != Adaptive {
+		t.Errorf("GetStrategy(vip) = %s, want %s", got, Adaptive)
+	}
+	if got := GetStrategy("default"); got != Weighted {
+		t.Errorf("GetStrategy(default) = %s, want %s", got, Weighted)
+	}
+	if err := UpdateChannelRoutingStrategy("fastest"); err == nil {
+		t.Error("unknown strategy should be rejected")
+	}
+	if err := UpdateGroupRoutingStrategyByJSONString(`{"vip": "fastest"}`); err == nil {
+		t.Error("unknown group strategy should be rejected")
+	}
+}
+
+func TestCost(t *testing.T) {
+	defer func() {
+		stats = map[statKey]*Stat{}
+	}()
+	for i := 0; i < 10; i++ {
+		RecordRequest(1, "gpt-4o", 2*time.Second, true)
+		RecordRequest(2, "gpt-4o", 500*time.Millisecond, true)
+		RecordRequest(3, "gpt-4o", 0, false)
+	}
+	// the time to the first byte matters more than the length of the answer
+	RecordTTFT(1, "gpt-4o", 300*time.Millisecond)
+
+	if Cost(4, "gpt-4o") != 0 || Cost(1, "gpt-4o-mini") != 0 {
+		t.Error("unknown channels should cost nothing")
+	}
+	if !(Cost(1, "gpt-4o") < Cost(2, "gpt-4o") && Cost(2, "gpt-4o") < Cost(3, "gpt-4o")) {
+		t.Errorf("unexpected costs: %+v", GetStats())
+	}
+	if stats := GetStats(); len(stats) != 3 || stats[0].ChannelId != 1 || stats[2].ChannelId != 3 {
+		t.Errorf("stats should be sorted by cost, got %+v", stats)
+	}
+
+	stats[statKey{3, "gpt-4o"}].UpdatedTime = time.Now().Add(-statsTTL - time.Second)
+	if Cost(3, "gpt-4o") != 0 {
+		t.Error("stale stats should be forgotten")
+	}
+}
@@ -0,0 +1,133 @@
+package routing
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ewmaAlpha is the weight of the latest request in the moving averages
+	ewmaAlpha = 0.2
+	// maxErrorRate keeps the cost of a failing channel finite
+	maxErrorRate = 0.95
+	// errorPenalty is what a failure costs the client, which has to wait for a retry, in milliseconds
+	errorPenalty = 10000.0
+	// statsTTL is how long a channel keeps its stats without requests, after which it
+	// is explored again as if it had never been used
+	statsTTL = 5 * time.Minute
+)
+
+// Stat is the moving average of the requests of a channel for a model
+type Stat struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+	Requests  int64  `json:"requests"`
+	// Latency and TTFT are in milliseconds, TTFT only comes from streams
+	Latency     float64   `json:"latency"`
+	TTFT        float64   `json:"ttft"`
+	ErrorRate   float64   `json:"error_rate"`
+	Cost        float64   `json:"cost"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+type statKey struct {
+	channelId int
+	model     string
+}
+
+var statsLock sync.RWMutex
+var stats = map[statKey]*Stat{}
+
+func ewma(average float64, value float64, first bool) float64 {
+	if first {
+		return value
+	}
+	return ewmaAlpha*value + (1-ewmaAlpha)*average
+}
+
+func getStat(channelId int, model string) *Stat {
+	key := statKey{channelId, model}
+	stat, ok := stats[key]
+	if !ok || time.Since(stat.UpdatedTime) > statsTTL {
+		stat = &Stat{ChannelId: channelId, Model: model}
+		stats[key] = stat
+	}
+	return stat
+}
+
+// RecordRequest records the outcome of a request relayed to a channel
+func RecordRequest(channelId int, model string, latency time.Duration, success bool) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stat := getStat(channelId, model)
+	failure := 0.0
+	if !success {
+		failure = 1
+	}
+	stat.ErrorRate = ewma(stat.ErrorRate, failure, stat.Requests == 0)
+	// failures return early and would make a channel look fast
+	if success {
+		stat.Latency = ewma(stat.Latency, float64(latency.Milliseconds()), stat.Latency == 0)
+	}
+	stat.Requests++
+	stat.UpdatedTime = time.Now()
+}
+
+// RecordTTFT records the time to the first byte of a stream relayed by a channel
+func RecordTTFT(channelId int, model string, ttft time.Duration) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stat := getStat(channelId, model)
+	stat.TTFT = ewma(stat.TTFT, float64(ttft.Milliseconds()), stat.TTFT == 0)
+	stat.UpdatedTime = time.Now()
+}
+
+// cost is the expected time to a successful answer in milliseconds. It takes the time to
+// the first byte when known, since the full latency mostly depends on the length of the
+// answer, and a channel failing at rate p fails p/(1-p) times on average before it answers.
+func (stat *Stat) cost() float64 {
+	latency := stat.TTFT
+	if latency == 0 {
+		latency = stat.Latency
+	}
+	errorRate := stat.ErrorRate
+	if errorRate > maxErrorRate {
+		errorRate = maxErrorRate
+	}
+	return latency + errorRate/(1-errorRate)*errorPenalty
+}
+
+// Cost returns the cost of the channel for the model, channels without recent requests
+// cost nothing so that they are tried
+func Cost(channelId int, model string) float64 {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	stat, ok := stats[statKey{channelId, model}]
+	if !ok || time.Since(stat.UpdatedTime) > statsTTL {
+		return 0
+	}
+	return stat.cost()
+}
+
+// GetStats returns the stats of every channel and model, the cheapest first
+func GetStats() []Stat {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	result := make([]Stat, 0, len(stats))
+	for _, stat := range stats {
+		if time.Since(stat.UpdatedTime) > statsTTL {
+			continue
+		}
+		it := *stat
+		it.Cost = stat.cost()
+		result = append(result, it)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Model != result[j].Model {
+			return result[i].Model < result[j].Model
+		}
+		return result[i].Cost < result[j].Cost
+	})
+	return result
+}
@@ -0,0 +1,102 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// the pre-tokenization patterns of the tokenizer.json of each model family, GLM-4 splits
+// text as Llama 3 does and only differs by its vocabulary
+const (
+	llama3Pattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+	qwenPattern   = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+)
+
+type bpeSpec struct {
+	file    string
+	pattern string
+}
+
+// bpeSpecs names the tokenizer data file of each family in config.TokenizerDataDir,
+// the files are in the tiktoken format of a base64 token and its rank per line,
+// as shipped with Llama 3 (tokenizer.model), Qwen (qwen.tiktoken) and GLM-4 (tokenizer.model).
+// No file is bundled, the licenses of the vocabularies are those of the models.
+var bpeSpecs = map[string]bpeSpec{
+	Llama: {file: "llama3.tiktoken", pattern: llama3Pattern},
+	Qwen:  {file: "qwen.tiktoken", pattern: qwenPattern},
+	GLM:   {file: "glm4.tiktoken", pattern: llama3Pattern},
+}
+
+type bpe struct {
+	encoder *tiktoken.Tiktoken
+}
+
+func (b *bpe) Name() string {
+	return "bpe"
+}
+
+func (b *bpe) Count(text string) int {
+	return len(b.encoder.EncodeOrdinary(text))
+}
+
+func loadBPE(path string, pattern string) (*bpe, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %d", lineNum)
+		}
+		token, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid token at line %d: %w", lineNum, err)
+		}
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank at line %d: %w", lineNum, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	core, err := tiktoken.NewCoreBPE(ranks, map[string]int{}, pattern)
+	if err != nil {
+		return nil, err
+	}
+	encoding := &tiktoken.Encoding{
+		Name:           path,
+		PatStr:         pattern,
+		MergeableRanks: ranks,
+		SpecialTokens:  map[string]int{},
+	}
+	return &bpe{encoder: tiktoken.NewTiktoken(core, encoding, map[string]any{})}, nil
+}
+
+// Tiktoken counts with an OpenAI encoding
+type Tiktoken struct {
+	*tiktoken.Tiktoken
+}
+
+func (t Tiktoken) Name() string {
+	return "tiktoken"
+}
+
+func (t Tiktoken) Count(text string) int {
+	return len(t.Encode(text, nil, nil))
+}
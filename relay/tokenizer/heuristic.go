@@ -0,0 +1,37 @@
+package tokenizer
+
+import (
+	"math"
+	"unicode"
+)
+
+// heuristic estimates tokens from characters for families whose tokenizer is
+// not available locally, CJK characters take about one token each while other
+// scripts are split into words and word pieces
+type heuristic struct {
+	charsPerToken    float64
+	cjkTokensPerChar float64
+}
+
+func newHeuristic(charsPerToken float64, cjkTokensPerChar float64) *heuristic {
+	return &heuristic{
+		charsPerToken:    charsPerToken,
+		cjkTokensPerChar: cjkTokensPerChar,
+	}
+}
+
+func (h *heuristic) Name() string {
+	return "heuristic"
+}
+
+func (h *heuristic) Count(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(other)/h.charsPerToken + float64(cjk)*h.cjkTokensPerChar))
+}
@@ -0,0 +1,74 @@
+package tokenizer
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Stat compares the estimated prompt tokens of a family with the usage reported upstream
+type Stat struct {
+	Family          string `json:"family"`
+	Tokenizer       string `json:"tokenizer"`
+	Samples         int64  `json:"samples"`
+	EstimatedTokens int64  `json:"estimated_tokens"`
+	ActualTokens    int64  `json:"actual_tokens"`
+	// MeanAbsoluteError is the mean of |estimated - actual| / actual over the samples
+	MeanAbsoluteError float64 `json:"mean_absolute_error"`
+	// Bias is (estimated - actual) / actual over all tokens, it is positive when the
+	// estimates are too high and more quota than needed is pre-consumed
+	Bias float64 `json:"bias"`
+
+	relativeErrorSum float64
+}
+
+var statsLock sync.Mutex
+var stats = map[string]*Stat{}
+
+// RecordUsage records the estimated prompt tokens of a request against the count
+// reported by the upstream
+func RecordUsage(model string, estimated int, actual int) {
+	if estimated <= 0 || actual <= 0 {
+		return
+	}
+	family := GetFamily(model)
+	name := "tiktoken"
+	if tokenizer := Get(model); tokenizer != nil {
+		name = tokenizer.Name()
+	}
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stat, ok := stats[family]
+	if !ok || stat.Tokenizer != name {
+		// the counts of a replaced tokenizer say nothing about the new one
+		stat = &Stat{Family: family, Tokenizer: name}
+		stats[family] = stat
+	}
+	stat.Samples++
+	stat.EstimatedTokens += int64(estimated)
+	stat.ActualTokens += int64(actual)
+	stat.relativeErrorSum += math.Abs(float64(estimated-actual)) / float64(actual)
+}
+
+// GetStats returns the accuracy of every family seen since the start or the last reset
+func GetStats() []Stat {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	result := make([]Stat, 0, len(stats))
+	for _, stat := range stats {
+		it := *stat
+		it.MeanAbsoluteError = it.relativeErrorSum / float64(it.Samples)
+		it.Bias = float64(it.EstimatedTokens-it.ActualTokens) / float64(it.ActualTokens)
+		result = append(result, it)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Family < result[j].Family
+	})
+	return result
+}
+
+func ResetStats() {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	stats = map[string]*Stat{}
+}
@@ -0,0 +1,119 @@
+package tokenizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Tokenizer counts tokens the way the models of one family do
+type Tokenizer interface {
+	// Name tells where the counts come from, e.g. tiktoken, bpe or heuristic
+	Name() string
+	Count(text string) int
+}
+
+// model families, each of them shares one tokenizer
+const (
+	OpenAI  = "openai"
+	Claude  = "claude"
+	Gemini  = "gemini"
+	Llama   = "llama"
+	Qwen    = "qwen"
+	GLM     = "glm"
+	Default = "default"
+)
+
+// familyKeywords maps a keyword found in a model name to its family, vendor
+// prefixes such as "meta-llama/" or "anthropic." are covered this way
+var familyKeywords = []struct {
+	keyword string
+	family  string
+}{
+	{"claude", Claude},
+	{"gemini", Gemini},
+	{"gemma", Gemini},
+	{"llama", Llama},
+	{"qwen", Qwen},
+	{"qwq", Qwen},
+	{"glm", GLM},
+	{"codegeex", GLM},
+}
+
+var openAIPrefixes = []string{
+	"gpt-", "chatgpt-", "o1", "o3", "o4", "text-", "davinci", "babbage", "curie", "ada", "code-", "ft:gpt-",
+}
+
+// GetFamily returns the tokenizer family of a model, Default when it is unknown
+func GetFamily(model string) string {
+	name := strings.ToLower(model)
+	for _, prefix := range openAIPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return OpenAI
+		}
+	}
+	for _, it := range familyKeywords {
+		if strings.Contains(name, it.keyword) {
+			return it.family
+		}
+	}
+	return Default
+}
+
+var registryLock sync.RWMutex
+
+// registry starts with the heuristics, Init replaces them with the tokenizer
+// data files found on disk
+var registry = map[string]Tokenizer{
+	Claude:  newHeuristic(3.5, 1.2),
+	Gemini:  newHeuristic(4.0, 0.8),
+	Llama:   newHeuristic(3.8, 1.1),
+	Qwen:    newHeuristic(3.8, 0.7),
+	GLM:     newHeuristic(3.8, 0.7),
+	Default: newHeuristic(3.6, 1.0),
+}
+
+// Register sets the tokenizer of a family
+func Register(family string, tokenizer Tokenizer) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[family] = tokenizer
+}
+
+// Get returns the tokenizer of the family of the model, nil for OpenAI models
+// which are counted with tiktoken by the openai adaptor
+func Get(model string) Tokenizer {
+	family := GetFamily(model)
+	if family == OpenAI {
+		return nil
+	}
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	if tokenizer, ok := registry[family]; ok {
+		return tokenizer
+	}
+	return registry[Default]
+}
+
+// Init loads the BPE tokenizer data files from config.TokenizerDataDir, families
+// without a file keep counting with the heuristic
+func Init() {
+	for family, spec := range bpeSpecs {
+		path := filepath.Join(config.TokenizerDataDir, spec.file)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		tokenizer, err := loadBPE(path, spec.pattern)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to load tokenizer of %s from %s: %s", family, path, err.Error()))
+			continue
+		}
+		Register(family, tokenizer)
+		logger.SysLog(fmt.Sprintf("loaded tokenizer of %s from %s", family, path))
+	}
+}
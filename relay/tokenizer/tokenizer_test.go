@@ -0,0 +1,85 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetFamily(t *testing.T) {
+	cases := map[string]string{
+		"gpt-4o-mini":                       OpenAI,
+		"o3-mini":                           OpenAI,
+		"claude-3-5-sonnet-20241022":        Claude,
+		"anthropic.claude-3-haiku":          Claude,
+		"gemini-1.5-pro":                    Gemini,
+		"meta-llama/Llama-3.3-70B-Instruct": Llama,
+		"Qwen/Qwen2.5-72B-Instruct":         Qwen,
+		"glm-4-plus":                        GLM,
+		"deepseek-chat":                     Default,
+	}
+	for model, want := range cases {
+		if got := GetFamily(model); got != want {
+			t.Errorf("GetFamily(%q) = %q, want %q", model, got, want)
+		}
+	}
+	if Get("gpt-4o") != nil {
+		t.Error("OpenAI models should be left to tiktoken")
+	}
+}
+
+func TestHeuristicCount(t *testing.T) {
+	h := newHeuristic(4, 1)
+	if got := h.Count("abcdefgh"); got != 2 {
+		t.Errorf("latin count = %d, want 2", got)
+	}
+	if got := h.Count("你好世界"); got != 4 {
+		t.Errorf("cjk count = %d, want 4", got)
+	}
+	if got := h.Count(""); got != 0 {
+		t.Errorf("empty count = %d, want 0", got)
+	}
+}
+
+func TestLoadBPE(t *testing.T) {
+	var lines []string
+	for i := 0; i < 256; i++ {
+		lines = append(lines, fmt.Sprintf("%s %d", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i))
+	}
+	lines = append(lines, base64.StdEncoding.EncodeToString([]byte("he"))+" 256")
+	lines = append(lines, base64.StdEncoding.EncodeToString([]byte("hel"))+" 257")
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tokenizer, err := loadBPE(path, llama3Pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "hello" merges into "hel", "l" and "o"
+	if got := tokenizer.Count("hello"); got != 3 {
+		t.Errorf("bpe count = %d, want 3", got)
+	}
+}
+
+func TestRecordUsage(t *testing.T) {
+	ResetStats()
+	defer ResetStats()
+	RecordUsage("claude-3-haiku", 110, 100)
+	RecordUsage("claude-3-haiku", 90, 100)
+	RecordUsage("claude-3-haiku", 0, 100)
+	stats := GetStats()
+	if len(stats) != 1 {
+		t.Fatalf("got %d stats, want 1", len(stats))
+	}
+	stat := stats[0]
+	if stat.Family != Claude || stat.Tokenizer != "heuristic" || stat.Samples != 2 {
+		t.Errorf("unexpected stat %+v", stat)
+	}
+	if stat.Bias != 0 || stat.MeanAbsoluteError < 0.099 || stat.MeanAbsoluteError > 0.101 {
+		t.Errorf("unexpected accuracy %+v", stat)
+	}
+}
@@ -0,0 +1,181 @@
+package truncation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// strategies applied when a conversation does not fit in the context window of the model
+const (
+	// Reject fails the request with context_length_exceeded, which is the default
+	Reject = "reject"
+	// DropOldest drops the oldest non-system messages until the conversation fits
+	DropOldest = "drop_oldest"
+	// KeepFirstLast keeps the first N and the last M non-system messages, written as keep_first_last:N,M
+	KeepFirstLast = "keep_first_last"
+)
+
+var ErrContextLengthExceeded = errors.New("the messages do not fit in the context window of the model")
+
+type Strategy struct {
+	Name  string
+	First int
+	Last  int
+}
+
+// Parse reads a strategy such as "drop_oldest" or "keep_first_last:1,6", the
+// empty string is the empty strategy which defers to the next level
+func Parse(spec string) (Strategy, error) {
+	spec = strings.TrimSpace(spec)
+	name, args, _ := strings.Cut(spec, ":")
+	switch name {
+	case "":
+		return Strategy{}, nil
+	case Reject, DropOldest:
+		if args != "" {
+			return Strategy{}, fmt.Errorf("strategy %s takes no arguments", name)
+		}
+		return Strategy{Name: name}, nil
+	case KeepFirstLast:
+		firstStr, lastStr, ok := strings.Cut(args, ",")
+		if !ok {
+			return Strategy{}, fmt.Errorf("strategy %s should be written as %s:N,M", name, name)
+		}
+		first, err := strconv.Atoi(strings.TrimSpace(firstStr))
+		if err != nil || first < 0 {
+			return Strategy{}, fmt.Errorf("invalid number of first messages: %s", firstStr)
+		}
+		last, err := strconv.Atoi(strings.TrimSpace(lastStr))
+		if err != nil || last < 1 {
+			return Strategy{}, fmt.Errorf("invalid number of last messages: %s", lastStr)
+		}
+		return Strategy{Name: name, First: first, Last: last}, nil
+	}
+	return Strategy{}, fmt.Errorf("unknown context strategy: %s", name)
+}
+
+func (s Strategy) String() string {
+	if s.Name == KeepFirstLast {
+		return fmt.Sprintf("%s:%d,%d", s.Name, s.First, s.Last)
+	}
+	return s.Name
+}
+
+// IsEmpty reports whether the strategy is unset
+func (s Strategy) IsEmpty() bool {
+	return s.Name == ""
+}
+
+// Truncate drops messages so that the sum of their costs is within the budget,
+// system messages are always kept and tool results are never kept without the
+// assistant message which called them. It returns the kept messages and the
+// sum of their costs, or ErrContextLengthExceeded when they cannot fit.
+func (s Strategy) Truncate(messages []model.Message, costs []int, budget int) ([]model.Message, int, error) {
+	total := 0
+	for _, cost := range costs {
+		total += cost
+	}
+	if total <= budget {
+		return messages, total, nil
+	}
+	var conversation []int // indexes of the non-system messages
+	for i, message := range messages {
+		if message.Role != "system" {
+			conversation = append(conversation, i)
+		}
+	}
+	dropped := make(map[int]bool)
+	drop := func(i int) {
+		if !dropped[i] {
+			dropped[i] = true
+			total -= costs[i]
+		}
+	}
+	switch s.Name {
+	case DropOldest:
+		// the last message is what the model has to answer
+		for n := 0; n < len(conversation)-1 && total > budget; n++ {
+			drop(conversation[n])
+		}
+	case KeepFirstLast:
+		for n := s.First; n < len(conversation)-s.Last; n++ {
+			drop(conversation[n])
+		}
+	default:
+		return nil, 0, ErrContextLengthExceeded
+	}
+	// a tool call is useless without its results and the results are orphans without the call
+	for n, i := range conversation {
+		if len(messages[i].ToolCalls) != 0 && n+1 < len(conversation) && dropped[conversation[n+1]] {
+			drop(i)
+		}
+	}
+	for n, i := range conversation {
+		if messages[i].Role == "tool" && !dropped[i] && (n == 0 || dropped[conversation[n-1]]) {
+			drop(i)
+		}
+	}
+	if total > budget {
+		return nil, 0, ErrContextLengthExceeded
+	}
+	kept := make([]model.Message, 0, len(messages)-len(dropped))
+	for i, message := range messages {
+		if !dropped[i] {
+			kept = append(kept, message)
+		}
+	}
+	return kept, total, nil
+}
+
+var groupStrategiesLock sync.RWMutex
+
+// GroupContextStrategy maps a group to its strategy, tokens with their own strategy override it
+var GroupContextStrategy = map[string]string{}
+
+func GroupContextStrategy2JSONString() string {
+	groupStrategiesLock.RLock()
+	defer groupStrategiesLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupContextStrategy)
+	if err != nil {
+		logger.SysError("error marshalling group context strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupContextStrategyByJSONString(jsonStr string) error {
+	strategies := make(map[string]string)
+	if err := json.Unmarshal([]byte(jsonStr), &strategies); err != nil {
+		return err
+	}
+	for group, spec := range strategies {
+		if _, err := Parse(spec); err != nil {
+			return fmt.Errorf("invalid context strategy of group %s: %w", group, err)
+		}
+	}
+	groupStrategiesLock.Lock()
+	defer groupStrategiesLock.Unlock()
+	GroupContextStrategy = strategies
+	return nil
+}
+
+// Get returns the strategy of the token if it has one, otherwise the one of its group
+func Get(tokenStrategy string, group string) Strategy {
+	if strategy, err := Parse(tokenStrategy); err == nil && !strategy.IsEmpty() {
+		return strategy
+	}
+	groupStrategiesLock.RLock()
+	spec := GroupContextStrategy[group]
+	groupStrategiesLock.RUnlock()
+	strategy, err := Parse(spec)
+	if err != nil || strategy.IsEmpty() {
+		return Strategy{Name: Reject}
+	}
+	return strategy
+}
@@ -0,0 +1,91 @@
+package truncation
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestParse(t *testing.T) {
+	valid := map[string]Strategy{
+		"":                    {},
+		"reject":              {Name: Reject},
+		"drop_oldest":         {Name: DropOldest},
+		"keep_first_last:1,6": {Name: KeepFirstLast, First: 1, Last: 6},
+	}
+	for spec, want := range valid {
+		got, err := Parse(spec)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", spec, got, err, want)
+		}
+	}
+	for _, spec := range []string{"drop_newest", "drop_oldest:1", "keep_first_last", "keep_first_last:1,0", "keep_first_last:a,2"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) should fail", spec)
+		}
+	}
+}
+
+func roles(messages []model.Message) string {
+	s := ""
+	for _, message := range messages {
+		s += message.Role[:1]
+	}
+	return s
+}
+
+func TestTruncate(t *testing.T) {
+	// system, user, assistant calling a tool, tool, assistant, user
+	messages := []model.Message{
+		{Role: "system"},
+		{Role: "user"},
+		{Role: "assistant", ToolCalls: []model.Tool{{Id: "call_1"}}},
+		{Role: "tool", ToolCallId: "call_1"},
+		{Role: "assistant"},
+		{Role: "user"},
+	}
+	costs := []int{10, 10, 10, 10, 10, 10}
+	cases := []struct {
+		strategy Strategy
+		budget   int
+		want     string
+		tokens   int
+		wantErr  bool
+	}{
+		{Strategy{Name: DropOldest}, 60, "suatau", 60, false},
+		{Strategy{Name: DropOldest}, 45, "sau", 30, false}, // the tool result goes with its call
+		{Strategy{Name: DropOldest}, 15, "", 0, true},
+		{Strategy{Name: KeepFirstLast, First: 1, Last: 1}, 40, "suu", 30, false},
+		{Strategy{Name: KeepFirstLast, First: 2, Last: 2}, 50, "suau", 40, false}, // the call without its result goes too
+		{Strategy{Name: Reject}, 50, "", 0, true},
+	}
+	for _, c := range cases {
+		kept, tokens, err := c.strategy.Truncate(messages, costs, c.budget)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s with budget %d: error %v", c.strategy, c.budget, err)
+			continue
+		}
+		if err == nil && (roles(kept) != c.want || tokens != c.tokens) {
+			t.Errorf("%s with budget %d: kept %s with %d tokens, want %s with %d", c.strategy, c.budget, roles(kept), tokens, c.want, c.tokens)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	defer func() { _ = UpdateGroupContextStrategyByJSONString("{}") }()
+	if err := UpdateGroupContextStrategyByJSONString(`{"vip": "drop_oldest"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := Get("", "vip"); got.Name != DropOldest {
+		t.Errorf("group strategy = %s, want %s", got, DropOldest)
+	}
+	if got := Get("reject", "vip"); got.Name != Reject {
+		t.Errorf("token strategy = %s, want %s", got, Reject)
+	}
+	if got := Get("", "default"); got.Name != Reject {
+		t.Errorf("default strategy = %s, want %s", got, Reject)
+	}
+	if err := UpdateGroupContextStrategyByJSONString(`{"vip": "drop_all"}`); err == nil {
+		t.Error("unknown strategies should be rejected")
+	}
+}
@@ -75,6 +75,11 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ListAllModels)
 			channelRoute.GET("/:id", controller.GetChannel)
+			channelRoute.GET("/:id/abilities", controller.GetChannelAbilities)
+			channelRoute.PUT("/abilities/weight", controller.UpdateAbilityWeight)
+			channelRoute.GET("/routing/stats", controller.GetChannelRoutingStats)
+			channelRoute.GET("/breakers", controller.GetChannelBreakers)
+			channelRoute.DELETE("/breakers/:id", controller.ResetChannelBreakers)
 			channelRoute.GET("/test", controller.TestChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
@@ -125,5 +130,11 @@ func SetApiRouter(router *gin.Engine) {
 			metricsRoute.GET("/", controller.GetMetrics)
 			metricsRoute.POST("/reset", controller.ResetMetrics)
 		}
+		tokenizerRoute := apiRouter.Group("/tokenizer")
+		tokenizerRoute.Use(middleware.AdminAuth())
+		{
+			tokenizerRoute.GET("/stats", controller.GetTokenizerStats)
+			tokenizerRoute.POST("/stats/reset", controller.ResetTokenizerStats)
+		}
 	}
 }